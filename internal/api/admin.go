@@ -0,0 +1,54 @@
+package api
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// WithAdminToken sets the bearer token for listing every link, updates,
+// export, import and /debug/vars. Without one those endpoints are never
+// registered, listing stays up for owners when WithOwnerTokens sets any.
+func (h *Handler) WithAdminToken(token string) *Handler {
+	h.adminToken = token
+	return h
+}
+
+// WithOwnerTokens maps bearer tokens to owners. Links shortened with one
+// belong to its owner, who can list them and no one else's.
+func (h *Handler) WithOwnerTokens(tokens map[string]string) *Handler {
+	h.ownerTokens = tokens
+	return h
+}
+
+func (h *Handler) requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !h.isAdmin(r) {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// False for everyone when no admin token is configured
+func (h *Handler) isAdmin(r *http.Request) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && h.adminToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(h.adminToken)) == 1
+}
+
+// The owner whose token the request carries, "" for anonymous callers. Every
+// token is compared so the time taken doesn't tell which one was close.
+func (h *Handler) ownerOf(r *http.Request) string {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return ""
+	}
+	owner := ""
+	for candidate, name := range h.ownerTokens {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(candidate)) == 1 {
+			owner = name
+		}
+	}
+	return owner
+}
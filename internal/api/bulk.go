@@ -0,0 +1,154 @@
+package api
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"goprl/internal/domain"
+	"goprl/internal/service"
+)
+
+// Items accepted per bulk request unless WithBulkLimit says otherwise
+const defaultBulkLimit = 1000
+
+// Generous for a CSV of defaultBulkLimit long URLs
+const maxBulkBody = 8 << 20
+
+type bulkResult struct {
+	URL       string     `json:"url"`
+	ShortURL  string     `json:"short_url,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	Error     string     `json:"error,omitempty"`
+}
+
+// WithBulkLimit caps the items in one bulk request
+func (h *Handler) WithBulkLimit(limit int) *Handler {
+	h.bulkLimit = limit
+	return h
+}
+
+// Accepts a JSON array of {url, alias, expires_at, tags, metadata}, or CSV
+// with all but metadata as columns, as the body (text/csv) or as the "file"
+// field of a multipart upload. Each item gets its own result, in request order.
+func (h *Handler) handleBulkShorten(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxBulkBody)
+	items, err := decodeBulk(r)
+	if err != nil {
+		http.Error(w, "invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(items) == 0 {
+		http.Error(w, "invalid request: no URLs", http.StatusBadRequest)
+		return
+	}
+	if len(items) > h.bulkLimit {
+		http.Error(w, fmt.Sprintf("%s, limit is %d", domain.ErrBatchTooLarge, h.bulkLimit), http.StatusRequestEntityTooLarge)
+		return
+	}
+	owner := h.ownerOf(r)
+	for i := range items {
+		items[i].Owner = owner
+	}
+	// Every password is a deliberately slow hash, so protected items are for
+	// the operator only and each one counts as a request of its own
+	protected := 0
+	for _, item := range items {
+		if item.Password != "" {
+			protected++
+		}
+	}
+	if protected > 0 {
+		if !h.isAdmin(r) {
+			http.Error(w, "password protected links in bulk requests need the admin token", http.StatusForbidden)
+			return
+		}
+		if err := chargeRateLimit(r, protected); errors.Is(err, domain.ErrRateLimitExceeded) {
+			http.Error(w, "Rate limit exceeded", http.StatusTooManyRequests)
+			return
+		}
+	}
+
+	results := h.service.ShortenBulk(r.Context(), items)
+	resp := struct {
+		Results   []bulkResult `json:"results"`
+		Succeeded int          `json:"succeeded"`
+		Failed    int          `json:"failed"`
+	}{Results: make([]bulkResult, len(results))}
+	for i, result := range results {
+		out := bulkResult{URL: items[i].URL}
+		if result.URL != nil {
+			out.ShortURL = result.URL.ShortURL
+			out.ExpiresAt = &result.URL.ExpiresAt
+		}
+		if result.Err != nil {
+			out.Error = result.Err.Error()
+			resp.Failed++
+		} else {
+			resp.Succeeded++
+		}
+		resp.Results[i] = out
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func decodeBulk(r *http.Request) ([]service.BulkItem, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "text/csv":
+		return decodeBulkCSV(r.Body)
+	case "multipart/form-data":
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		return decodeBulkCSV(file)
+	}
+	var items []service.BulkItem
+	if err := json.NewDecoder(r.Body).Decode(&items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// Columns are url, alias, expires_at (RFC 3339) and tags (comma separated,
+// quoted), all but url optional. A header row is skipped.
+func decodeBulkCSV(body io.Reader) ([]service.BulkItem, error) {
+	reader := csv.NewReader(body)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	var items []service.BulkItem
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return items, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if line == 1 && strings.EqualFold(record[0], "url") {
+			continue
+		}
+		item := service.BulkItem{URL: record[0]}
+		if len(record) > 1 {
+			item.Alias = record[1]
+		}
+		if len(record) > 2 && record[2] != "" {
+			if item.ExpiresAt, err = time.Parse(time.RFC3339, record[2]); err != nil {
+				return nil, fmt.Errorf("line %d: expires_at must be RFC 3339", line)
+			}
+		}
+		if len(record) > 3 && record[3] != "" {
+			item.Tags = strings.Split(record[3], ",")
+		}
+		items = append(items, item)
+	}
+}
@@ -0,0 +1,150 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"goprl/internal/config"
+	"goprl/internal/domain"
+	"goprl/internal/service"
+	"goprl/internal/store/memory"
+	"io"
+	"log/slog"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type bulkResponse struct {
+	Results   []bulkResult `json:"results"`
+	Succeeded int          `json:"succeeded"`
+	Failed    int          `json:"failed"`
+}
+
+func newBulkHandler() *Handler {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	svc := service.NewURLService(memory.NewStore(), memory.NewCache(time.Hour, 100), &mockBloom{data: make(map[string]bool)}, logger, mockBaseURL)
+	return NewHandler(svc).WithBulkLimit(3)
+}
+
+func TestHandler_HandleBulkShorten(t *testing.T) {
+	multipartBody := func() (*bytes.Buffer, string) {
+		var body bytes.Buffer
+		form := multipart.NewWriter(&body)
+		file, _ := form.CreateFormFile("file", "links.csv")
+		file.Write([]byte("url,alias\nhttps://google.com,search\n"))
+		form.Close()
+		return &body, form.FormDataContentType()
+	}
+
+	t.Run("JSON", func(t *testing.T) {
+		body := `[{"url":"https://google.com"},{"url":"nope nope"},{"url":"https://go.dev","alias":"gopher","expires_at":"2099-01-01T00:00:00Z"}]`
+		req := httptest.NewRequest("POST", "/api/urls/bulk", strings.NewReader(body))
+		rr := httptest.NewRecorder()
+
+		newBulkHandler().handleBulkShorten(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+		}
+		var resp bulkResponse
+		json.NewDecoder(rr.Body).Decode(&resp)
+		if resp.Succeeded != 2 || resp.Failed != 1 || len(resp.Results) != 3 {
+			t.Fatalf("expected 2 succeeded and 1 failed, got %+v", resp)
+		}
+		if resp.Results[1].Error == "" || resp.Results[1].URL != "nope nope" {
+			t.Errorf("expected the invalid URL reported in place, got %+v", resp.Results[1])
+		}
+		if resp.Results[2].ShortURL != mockBaseURL+"/gopher" || resp.Results[2].ExpiresAt.Year() != 2099 {
+			t.Errorf("expected the alias with its expiry, got %+v", resp.Results[2])
+		}
+	})
+
+	t.Run("CSV", func(t *testing.T) {
+		body := "url,alias,expires_at\nhttps://google.com,,\nhttps://go.dev,gopher,2099-01-01T00:00:00Z\n"
+		req := httptest.NewRequest("POST", "/api/urls/bulk", strings.NewReader(body))
+		req.Header.Set("Content-Type", "text/csv")
+		rr := httptest.NewRecorder()
+
+		newBulkHandler().handleBulkShorten(rr, req)
+
+		var resp bulkResponse
+		json.NewDecoder(rr.Body).Decode(&resp)
+		if rr.Code != http.StatusOK || resp.Succeeded != 2 {
+			t.Errorf("expected 2 links from CSV, got %d %+v", rr.Code, resp)
+		}
+	})
+
+	t.Run("Upload", func(t *testing.T) {
+		body, contentType := multipartBody()
+		req := httptest.NewRequest("POST", "/api/urls/bulk", body)
+		req.Header.Set("Content-Type", contentType)
+		rr := httptest.NewRecorder()
+
+		newBulkHandler().handleBulkShorten(rr, req)
+
+		var resp bulkResponse
+		json.NewDecoder(rr.Body).Decode(&resp)
+		if rr.Code != http.StatusOK || resp.Succeeded != 1 || resp.Results[0].ShortURL != mockBaseURL+"/search" {
+			t.Errorf("expected the uploaded alias, got %d %+v", rr.Code, resp)
+		}
+	})
+
+	t.Run("TooLarge", func(t *testing.T) {
+		body := `[{"url":"a.com"},{"url":"b.com"},{"url":"c.com"},{"url":"d.com"}]`
+		req := httptest.NewRequest("POST", "/api/urls/bulk", strings.NewReader(body))
+		rr := httptest.NewRecorder()
+
+		newBulkHandler().handleBulkShorten(rr, req)
+
+		if rr.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("expected 413, got %d", rr.Code)
+		}
+	})
+
+	t.Run("BadExpiry", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/api/urls/bulk", strings.NewReader("https://go.dev,,tomorrow\n"))
+		req.Header.Set("Content-Type", "text/csv")
+		rr := httptest.NewRecorder()
+
+		newBulkHandler().handleBulkShorten(rr, req)
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected 400, got %d", rr.Code)
+		}
+	})
+
+	t.Run("Passwords", func(t *testing.T) {
+		body := `[{"url":"https://go.dev","password":"hunter22"},{"url":"https://google.com","password":"hunter22"}]`
+		send := func(token string, allowed int) *httptest.ResponseRecorder {
+			calls := 0
+			cache := &mockRateLimitCache{allowFunc: func(ctx context.Context, key string, limit int, window time.Duration) error {
+				if calls++; calls > allowed {
+					return domain.ErrRateLimitExceeded
+				}
+				return nil
+			}}
+			handler := RateLimitMiddleware(cache, &config.Config{RateLimit: 20})(http.HandlerFunc(newBulkHandler().WithAdminToken("secret").handleBulkShorten))
+			req := httptest.NewRequest("POST", "/api/urls/bulk", strings.NewReader(body))
+			req.RemoteAddr = "127.0.0.1:1234"
+			req.Header.Set("Authorization", "Bearer "+token)
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			return rr
+		}
+
+		if rr := send("wrong", 10); rr.Code != http.StatusForbidden {
+			t.Errorf("expected 403 without the admin token, got %d", rr.Code)
+		}
+		// The request itself and one of the two hashes fit
+		if rr := send("secret", 2); rr.Code != http.StatusTooManyRequests {
+			t.Errorf("expected 429 once the hashes exceed the limit, got %d", rr.Code)
+		}
+		if rr := send("secret", 3); rr.Code != http.StatusOK {
+			t.Errorf("expected 200 for the admin within the limit, got %d: %s", rr.Code, rr.Body.String())
+		}
+	})
+}
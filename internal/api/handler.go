@@ -2,22 +2,57 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
+	"expvar"
 	"net/http"
+	"net/netip"
+	"time"
 
+	"goprl/internal/domain"
+	"goprl/internal/passcode"
 	"goprl/internal/service"
+	"goprl/internal/transfer"
 )
 
 type Handler struct {
-	service *service.URLService
+	service    *service.URLService
+	bulkLimit  int
+	transfer   *transfer.Links
+	adminToken string
+	// Bearer token to owner
+	ownerTokens map[string]string
+	signer      *passcode.Signer
+	unlockTTL   time.Duration
+	comingSoon  string
+	trusted     []netip.Prefix
 }
 
 func NewHandler(service *service.URLService) *Handler {
-	return &Handler{service: service}
+	return &Handler{
+		service:   service,
+		bulkLimit: defaultBulkLimit,
+		signer:    passcode.NewRandomSigner(),
+		unlockTTL: defaultUnlockTTL,
+	}
 }
 
 func (h *Handler) RegisterRoutes(mux *http.ServeMux) {
 	mux.HandleFunc("POST /shorten", h.handleShorten)
+	mux.HandleFunc("POST /api/urls/bulk", h.handleBulkShorten)
+	if h.adminToken != "" || len(h.ownerTokens) > 0 {
+		mux.HandleFunc("GET /api/urls", h.handleList)
+	}
+	if h.adminToken != "" {
+		mux.HandleFunc("PATCH /api/urls/{code}", h.requireAdmin(h.handleUpdate))
+		// Exposes the command line, memory stats and breaker and bloom internals
+		mux.HandleFunc("GET /debug/vars", h.requireAdmin(expvar.Handler().ServeHTTP))
+		if h.transfer != nil {
+			mux.HandleFunc("GET /api/urls/export", h.requireAdmin(h.handleExport))
+			mux.HandleFunc("POST /api/urls/import", h.requireAdmin(h.handleImport))
+		}
+	}
 	mux.HandleFunc("GET /{code}", h.handleResolve)
+	mux.HandleFunc("POST /{code}", h.handleUnlock)
 	mux.HandleFunc("GET /health", h.handleHealth)
 }
 
@@ -29,16 +64,18 @@ func (h *Handler) handleHealth(w http.ResponseWriter, _ *http.Request) {
 func (h *Handler) handleShorten(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		URL string `json:"url"`
+		service.LinkOptions
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "invalid request", http.StatusBadRequest)
 		return
 	}
+	req.Owner = h.ownerOf(r)
 
-	url, err := h.service.Shorten(r.Context(), req.URL)
+	url, err := h.service.ShortenWith(r.Context(), req.URL, req.LinkOptions)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		shortenError(w, err)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -52,11 +89,48 @@ func (h *Handler) handleShorten(w http.ResponseWriter, r *http.Request) {
 func (h *Handler) handleResolve(w http.ResponseWriter, r *http.Request) {
 	code := r.PathValue("code")
 
-	url, err := h.service.Resolve(r.Context(), code)
+	url, err := h.service.Resolve(h.visitorContext(r), code)
+	if errors.Is(err, domain.ErrURLNotActive) {
+		h.serveScheduled(w, r, url)
+		return
+	}
 	if err != nil {
-		http.Error(w, "not found", http.StatusNotFound)
+		resolveError(w, err)
+		return
+	}
+	if url.Protected() {
+		h.serveProtected(w, r, url)
+		return
+	}
+	// A cached 301 would skip the click count and send every visitor where the
+	// first one went, limited and targeted links redirect every time
+	if url.Limited() || url.Targeted() {
+		w.Header().Set("Cache-Control", "no-store")
+		http.Redirect(w, r, url.OriginalURL, http.StatusFound)
 		return
 	}
 	// 301 StatusMovedPermanently, caches redirect and skips server entirely on subsequent requests
 	http.Redirect(w, r, url.OriginalURL, http.StatusMovedPermanently)
 }
+
+// Options the caller got wrong are theirs to fix, anything else is ours
+func shortenError(w http.ResponseWriter, err error) {
+	for _, invalid := range []error{
+		domain.ErrInvalidURL, domain.ErrInvalidScheme, domain.ErrInvalidTags, domain.ErrMetadataTooLarge,
+		domain.ErrInvalidPassword, domain.ErrInvalidMaxClicks, domain.ErrInvalidActivation, domain.ErrInvalidRules,
+	} {
+		if errors.Is(err, invalid) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
+
+func resolveError(w http.ResponseWriter, err error) {
+	if errors.Is(err, domain.ErrURLExhausted) {
+		http.Error(w, "gone", http.StatusGone)
+		return
+	}
+	http.Error(w, "not found", http.StatusNotFound)
+}
@@ -6,10 +6,12 @@ import (
 	"encoding/json"
 	"goprl/internal/domain"
 	"goprl/internal/service"
+	"goprl/internal/store/memory"
 	"io"
 	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 )
@@ -45,17 +47,35 @@ func (m *apiMockStore) GetMaxID(ctx context.Context) (int64, error) {
 	return 0, nil
 }
 
+func (m *apiMockStore) ListURLs(ctx context.Context, filter domain.ListFilter) ([]*domain.URL, error) {
+	return nil, nil
+}
+
+func (m *apiMockStore) UpdateURL(ctx context.Context, code string, update domain.URLUpdate) (*domain.URL, error) {
+	return nil, nil
+}
+
+func (m *apiMockStore) UseClick(ctx context.Context, code string) error {
+	return nil
+}
+
 type apiMockCache struct{}
 
 func (m *apiMockCache) Get(ctx context.Context, key string) (*domain.URL, error) {
 	return nil, domain.ErrURLNotFound
 }
-func (m *apiMockCache) Set(ctx context.Context, key string, value *domain.URL) error { return nil }
+func (m *apiMockCache) Set(ctx context.Context, key string, value *domain.URL, ttl time.Duration) error {
+	return nil
+}
+func (m *apiMockCache) Delete(ctx context.Context, keys ...string) error { return nil }
 func (m *apiMockCache) Allow(ctx context.Context, key string, limit int, window time.Duration) error {
 	return nil
 }
 func (m *apiMockCache) Increment(ctx context.Context, key string) (int64, error)      { return 0, nil }
 func (m *apiMockCache) SetCounter(ctx context.Context, key string, value int64) error { return nil }
+func (m *apiMockCache) Countdown(ctx context.Context, key string, start, delta int64, ttl time.Duration) (int64, error) {
+	return start + delta, nil
+}
 
 type mockBloom struct {
 	data map[string]bool
@@ -171,6 +191,49 @@ func TestHandler_HandleShorten(t *testing.T) {
 			t.Errorf("expected 400, got %d", rr.Code)
 		}
 	})
+
+	t.Run("InvalidOptions", func(t *testing.T) {
+		svc := service.NewURLService(&apiMockStore{}, &apiMockCache{}, &mockBloom{data: make(map[string]bool)}, logger, mockBaseURL)
+		h := NewHandler(svc)
+
+		for name, body := range map[string]string{
+			"URL":       `{"url": "https://localhost"}`,
+			"Tags":      `{"url": "https://google.com", "tags": ["Not Valid"]}`,
+			"Password":  `{"url": "https://google.com", "password": "abc"}`,
+			"MaxClicks": `{"url": "https://google.com", "max_clicks": -1}`,
+			"Fallback":  `{"url": "https://google.com", "activates_at": "2999-01-01T00:00:00Z", "fallback_url": "not a url"}`,
+			"Rules":     `{"url": "https://google.com", "rules": [{"url": "https://google.com/de"}]}`,
+			"Metadata":  `{"url": "https://google.com", "metadata": {"note": "` + strings.Repeat("x", 5000) + `"}}`,
+		} {
+			req := httptest.NewRequest("POST", "/shorten", bytes.NewBufferString(body))
+			rr := httptest.NewRecorder()
+
+			h.handleShorten(rr, req)
+
+			if rr.Code != http.StatusBadRequest {
+				t.Errorf("%s: expected 400, got %d: %s", name, rr.Code, rr.Body.String())
+			}
+		}
+	})
+
+	t.Run("StoreError", func(t *testing.T) {
+		store := &apiMockStore{
+			createURLFunc: func(ctx context.Context, url *domain.URL) error {
+				return context.DeadlineExceeded
+			},
+		}
+		svc := service.NewURLService(store, &apiMockCache{}, &mockBloom{data: make(map[string]bool)}, logger, mockBaseURL)
+		h := NewHandler(svc)
+
+		req := httptest.NewRequest("POST", "/shorten", bytes.NewBufferString(`{"url": "https://google.com"}`))
+		rr := httptest.NewRecorder()
+
+		h.handleShorten(rr, req)
+
+		if rr.Code != http.StatusInternalServerError {
+			t.Errorf("expected 500, got %d", rr.Code)
+		}
+	})
 }
 
 func TestHandler_HandleResolve(t *testing.T) {
@@ -247,3 +310,49 @@ func TestHandler_HandleResolve(t *testing.T) {
 		}
 	})
 }
+
+func TestHandler_LimitedLink(t *testing.T) {
+	store := memory.NewStore()
+	store.CreateURL(context.Background(), &domain.URL{ShortURL: "once", OriginalURL: "https://invite.example.com", ExpiresAt: time.Now().Add(time.Hour), MaxClicks: 1})
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	svc := service.NewURLService(store, memory.NewCache(time.Hour, 10), &mockBloom{data: make(map[string]bool)}, logger, mockBaseURL)
+	mux := http.NewServeMux()
+	NewHandler(svc).RegisterRoutes(mux)
+
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest("GET", "/once", nil))
+	if rr.Code != http.StatusFound || rr.Header().Get("Cache-Control") != "no-store" {
+		t.Errorf("expected an uncached 302, got %d %q", rr.Code, rr.Header().Get("Cache-Control"))
+	}
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest("GET", "/once", nil))
+	if rr.Code != http.StatusGone {
+		t.Errorf("expected 410 once the link is used up, got %d", rr.Code)
+	}
+}
+
+func TestHandler_TargetedLink(t *testing.T) {
+	store := memory.NewStore()
+	store.CreateURL(context.Background(), &domain.URL{ShortURL: "app", OriginalURL: "https://example.com/app", ExpiresAt: time.Now().Add(time.Hour), Rules: []domain.Rule{
+		{OS: "ios", URL: "https://apps.apple.com/app/id1"},
+		{OS: "android", URL: "https://play.google.com/store/apps/details?id=app"},
+	}})
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	svc := service.NewURLService(store, memory.NewCache(time.Hour, 10), &mockBloom{data: make(map[string]bool)}, logger, mockBaseURL)
+	mux := http.NewServeMux()
+	NewHandler(svc).RegisterRoutes(mux)
+
+	for ua, want := range map[string]string{
+		"Mozilla/5.0 (iPhone; CPU iPhone OS 17_4 like Mac OS X) Mobile/15E148":           "https://apps.apple.com/app/id1",
+		"Mozilla/5.0 (Linux; Android 14; Pixel 8) Chrome/124.0.0.0 Mobile Safari/537.36": "https://play.google.com/store/apps/details?id=app",
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) Chrome/124.0.0.0 Safari/537.36":       "https://example.com/app",
+	} {
+		req := httptest.NewRequest("GET", "/app", nil)
+		req.Header.Set("User-Agent", ua)
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		if rr.Code != http.StatusFound || rr.Header().Get("Location") != want || rr.Header().Get("Cache-Control") != "no-store" {
+			t.Errorf("%s: expected an uncached 302 to %s, got %d %q", ua, want, rr.Code, rr.Header().Get("Location"))
+		}
+	}
+}
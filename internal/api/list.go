@@ -0,0 +1,122 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"goprl/internal/domain"
+)
+
+type listedURL struct {
+	*domain.URL
+	Link      string `json:"short_url"`
+	Protected bool   `json:"protected,omitempty"`
+}
+
+func (h *Handler) listed(url *domain.URL) listedURL {
+	return listedURL{URL: url, Link: h.service.Link(url.ShortURL), Protected: url.Protected()}
+}
+
+// Query parameters: cursor, limit, owner, created_after, created_before
+// (RFC 3339), status (live, expired or all), domain, q for a substring of the
+// destination and tag, repeated for links carrying all of them. The admin
+// sees every link, an owner only their own whatever owner says.
+func (h *Handler) handleList(w http.ResponseWriter, r *http.Request) {
+	admin, owner := h.isAdmin(r), h.ownerOf(r)
+	if !admin && owner == "" {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	filter, err := parseListFilter(r)
+	if err != nil {
+		http.Error(w, "invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !admin {
+		filter.Owner = owner
+	}
+	page, err := h.service.List(r.Context(), filter)
+	if err != nil {
+		http.Error(w, "listing failed", http.StatusInternalServerError)
+		return
+	}
+	resp := struct {
+		URLs       []listedURL `json:"urls"`
+		NextCursor string      `json:"next_cursor,omitempty"`
+	}{URLs: make([]listedURL, len(page.URLs))}
+	for i, url := range page.URLs {
+		resp.URLs[i] = h.listed(url)
+	}
+	if page.NextCursor > 0 {
+		resp.NextCursor = strconv.FormatInt(page.NextCursor, 10)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// Body is {tags, metadata}, an omitted field is left as it is
+func (h *Handler) handleUpdate(w http.ResponseWriter, r *http.Request) {
+	var update domain.URLUpdate
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&update); err != nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	url, err := h.service.Update(r.Context(), r.PathValue("code"), update)
+	switch {
+	case errors.Is(err, domain.ErrURLNotFound):
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	case errors.Is(err, domain.ErrInvalidTags), errors.Is(err, domain.ErrMetadataTooLarge):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case err != nil:
+		http.Error(w, "update failed", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.listed(url))
+}
+
+func parseListFilter(r *http.Request) (domain.ListFilter, error) {
+	q := r.URL.Query()
+	filter := domain.ListFilter{
+		Owner:  q.Get("owner"),
+		Domain: q.Get("domain"),
+		Search: q.Get("q"),
+	}
+	var err error
+	if tags := q["tag"]; len(tags) > 0 {
+		if filter.Tags, err = domain.NormalizeTags(tags); err != nil {
+			return filter, err
+		}
+	}
+	if value := q.Get("cursor"); value != "" {
+		if filter.Before, err = strconv.ParseInt(value, 10, 64); err != nil || filter.Before < 1 {
+			return filter, fmt.Errorf("cursor is not valid")
+		}
+	}
+	if value := q.Get("limit"); value != "" {
+		if filter.Limit, err = strconv.Atoi(value); err != nil || filter.Limit < 1 {
+			return filter, fmt.Errorf("limit is not a valid integer")
+		}
+	}
+	for name, dst := range map[string]*time.Time{"created_after": &filter.CreatedFrom, "created_before": &filter.CreatedTo} {
+		if value := q.Get(name); value != "" {
+			if *dst, err = time.Parse(time.RFC3339, value); err != nil {
+				return filter, fmt.Errorf("%s must be RFC 3339", name)
+			}
+		}
+	}
+	switch status := q.Get("status"); status {
+	case "", "all":
+	case "live", "expired":
+		filter.Status = domain.ExpiryStatus(status)
+	default:
+		return filter, fmt.Errorf("status must be live, expired or all")
+	}
+	return filter, nil
+}
@@ -0,0 +1,174 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"goprl/internal/domain"
+	"goprl/internal/service"
+	"goprl/internal/store/memory"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHandler_HandleList(t *testing.T) {
+	store := memory.NewStore()
+	for _, code := range []string{"a", "b", "c"} {
+		store.CreateURL(context.Background(), &domain.URL{ShortURL: code, OriginalURL: "https://example.com/" + code, ExpiresAt: time.Now().Add(time.Hour)})
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	svc := service.NewURLService(store, memory.NewCache(time.Hour, 10), &mockBloom{data: make(map[string]bool)}, logger, mockBaseURL)
+	mux := http.NewServeMux()
+	NewHandler(svc).WithAdminToken("secret").RegisterRoutes(mux)
+
+	list := func(query string) (int, listResponse) {
+		req := httptest.NewRequest("GET", "/api/urls"+query, nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		var resp listResponse
+		json.NewDecoder(rr.Body).Decode(&resp)
+		return rr.Code, resp
+	}
+
+	code, resp := list("?limit=2&domain=example.com")
+	if code != http.StatusOK || len(resp.URLs) != 2 || resp.NextCursor != "2" {
+		t.Fatalf("expected 2 links and cursor 2, got %d %+v", code, resp)
+	}
+	if resp.URLs[0].ShortCode != "c" || resp.URLs[0].ShortURL != mockBaseURL+"/c" {
+		t.Errorf("expected the newest link with its short URL first, got %+v", resp.URLs[0])
+	}
+	code, resp = list("?limit=2&cursor=" + resp.NextCursor)
+	if code != http.StatusOK || len(resp.URLs) != 1 || resp.NextCursor != "" {
+		t.Errorf("expected the last link and no cursor, got %d %+v", code, resp)
+	}
+
+	for _, query := range []string{"?status=soon", "?cursor=x", "?limit=0", "?created_after=yesterday"} {
+		if code, _ := list(query); code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", query, code)
+		}
+	}
+}
+
+func TestHandler_HandleList_Owners(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	svc := service.NewURLService(memory.NewStore(), memory.NewCache(time.Hour, 10), &mockBloom{data: make(map[string]bool)}, logger, mockBaseURL)
+	mux := http.NewServeMux()
+	NewHandler(svc).WithOwnerTokens(map[string]string{"g-token": "growth", "d-token": "docs"}).RegisterRoutes(mux)
+	send := func(method, path, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// Each owner's shorten is theirs even for the same URL, anonymous ones stay public
+	send("POST", "/shorten", "g-token", `{"url":"https://example.com"}`)
+	send("POST", "/shorten", "d-token", `{"url":"https://example.com"}`)
+	send("POST", "/shorten", "", `{"url":"https://example.com/public"}`)
+	send("POST", "/api/urls/bulk", "g-token", `[{"url":"https://example.com/bulk"}]`)
+
+	rr := send("GET", "/api/urls?owner=docs", "g-token", "")
+	var resp listResponse
+	json.NewDecoder(rr.Body).Decode(&resp)
+	if rr.Code != http.StatusOK || len(resp.URLs) != 2 {
+		t.Fatalf("expected growth's 2 links whatever the owner filter says, got %d %+v", rr.Code, resp)
+	}
+	for _, url := range resp.URLs {
+		if url.Owner != "growth" {
+			t.Errorf("expected only growth's links, got %+v", url)
+		}
+	}
+	if rr := send("GET", "/api/urls", "", ""); rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 for an anonymous listing, got %d", rr.Code)
+	}
+	if rr := send("GET", "/api/urls", "wrong", ""); rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 for an unknown token, got %d", rr.Code)
+	}
+	if rr := send("PATCH", "/api/urls/abc", "g-token", `{"tags":[]}`); rr.Code == http.StatusOK {
+		t.Errorf("expected updates to stay admin only, got %d", rr.Code)
+	}
+}
+
+type listResponse struct {
+	URLs []struct {
+		ShortCode string `json:"short_code"`
+		ShortURL  string `json:"short_url"`
+		Owner     string `json:"owner"`
+	} `json:"urls"`
+	NextCursor string `json:"next_cursor"`
+}
+
+func TestHandler_HandleUpdate(t *testing.T) {
+	store := memory.NewStore()
+	store.CreateURL(context.Background(), &domain.URL{ShortURL: "abc", OriginalURL: "https://example.com", ExpiresAt: time.Now().Add(time.Hour)})
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	svc := service.NewURLService(store, memory.NewCache(time.Hour, 10), &mockBloom{data: make(map[string]bool)}, logger, mockBaseURL)
+	mux := http.NewServeMux()
+	NewHandler(svc).WithAdminToken("secret").RegisterRoutes(mux)
+
+	patch := func(code, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("PATCH", "/api/urls/"+code, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer secret")
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := patch("abc", `{"tags":["Spring","email"],"metadata":{"campaign":"q2"}}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var url domain.URL
+	json.NewDecoder(rr.Body).Decode(&url)
+	if len(url.Tags) != 2 || url.Tags[1] != "spring" || url.Metadata["campaign"] != "q2" {
+		t.Errorf("expected normalized tags and metadata, got %+v", url)
+	}
+	if rr := patch("abc", `{"tags":["no spaces"]}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an invalid tag, got %d", rr.Code)
+	}
+	if rr := patch("missing", `{"tags":[]}`); rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", rr.Code)
+	}
+
+	req := httptest.NewRequest("GET", "/api/urls?tag=SPRING", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	var resp listResponse
+	json.NewDecoder(rr.Body).Decode(&resp)
+	if len(resp.URLs) != 1 {
+		t.Errorf("expected the tagged link listed, got %+v", resp)
+	}
+}
+
+func TestHandler_DebugVars(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	svc := service.NewURLService(memory.NewStore(), memory.NewCache(time.Hour, 10), &mockBloom{data: make(map[string]bool)}, logger, mockBaseURL)
+	get := func(h *Handler, token string) int {
+		mux := http.NewServeMux()
+		h.RegisterRoutes(mux)
+		req := httptest.NewRequest("GET", "/debug/vars", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	if code := get(NewHandler(svc), ""); code != http.StatusNotFound {
+		t.Errorf("expected 404 without an admin token configured, got %d", code)
+	}
+	if code := get(NewHandler(svc).WithAdminToken("secret"), "wrong"); code != http.StatusUnauthorized {
+		t.Errorf("expected 401 for the wrong token, got %d", code)
+	}
+	if code := get(NewHandler(svc).WithAdminToken("secret"), "secret"); code != http.StatusOK {
+		t.Errorf("expected 200 for the admin, got %d", code)
+	}
+}
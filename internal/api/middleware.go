@@ -17,6 +17,10 @@ type contextKey string
 
 const RequestIDKey contextKey = "request_id"
 
+// Charges the caller's rate limit once more, for handlers whose requests
+// cost more than one
+const rateLimitKey contextKey = "rate_limit"
+
 func RequestIDMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		id := generateRandomID()
@@ -51,11 +55,29 @@ func RateLimitMiddleware(cache domain.URLCache, config *config.Config) func(http
 				http.Error(w, "Rate limit exceeded", http.StatusTooManyRequests)
 				return
 			}
-			next.ServeHTTP(w, r)
+			charge := func(ctx context.Context) error {
+				return cache.Allow(ctx, ip, config.RateLimit, time.Minute)
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), rateLimitKey, charge)))
 		})
 	}
 }
 
+// Counts n more requests against the caller's limit, stopping at the first
+// refusal. Without RateLimitMiddleware in front it allows everything.
+func chargeRateLimit(r *http.Request, n int) error {
+	charge, ok := r.Context().Value(rateLimitKey).(func(context.Context) error)
+	if !ok {
+		return nil
+	}
+	for range n {
+		if err := charge(r.Context()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func generateRandomID() string {
 	return uuid.NewString()
 }
@@ -0,0 +1,60 @@
+package api
+
+import (
+	"html/template"
+	"net/http"
+	"strconv"
+	"time"
+
+	"goprl/internal/domain"
+)
+
+// Longest a coming soon answer may be cached, shorter as the launch nears
+const maxComingSoonAge = time.Minute
+
+var comingSoonPage = template.Must(template.New("soon").Parse(`<!doctype html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>Coming soon</title>
+<style>
+body { font-family: system-ui, sans-serif; max-width: 22rem; margin: 15vh auto; padding: 0 1rem; }
+</style>
+</head>
+<body>
+<h1>Coming soon</h1>
+<p>This link isn't live yet, check back later.</p>
+</body>
+</html>
+`))
+
+// WithComingSoon sets where visitors are sent before a link launches when the
+// link has no fallback of its own. Empty serves a coming soon page.
+func (h *Handler) WithComingSoon(fallbackURL string) *Handler {
+	h.comingSoon = fallbackURL
+	return h
+}
+
+// Links that haven't launched send visitors to a fallback or the coming soon
+// page. Caches may keep the answer until the launch but never past it.
+func (h *Handler) serveScheduled(w http.ResponseWriter, r *http.Request, url *domain.URL) {
+	age := min(time.Until(url.ActivatesAt), maxComingSoonAge)
+	if age < time.Second {
+		w.Header().Set("Cache-Control", "no-store")
+	} else {
+		w.Header().Set("Cache-Control", "max-age="+strconv.Itoa(int(age.Seconds())))
+	}
+	fallback := url.FallbackURL
+	if fallback == "" {
+		fallback = h.comingSoon
+	}
+	if fallback != "" {
+		http.Redirect(w, r, fallback, http.StatusFound)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusNotFound)
+	comingSoonPage.Execute(w, nil)
+}
@@ -0,0 +1,51 @@
+package api
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"goprl/internal/domain"
+	"goprl/internal/service"
+	"goprl/internal/store/memory"
+)
+
+func TestHandler_ScheduledLink(t *testing.T) {
+	store := memory.NewStore()
+	expires, launch := time.Now().Add(2*time.Hour), time.Now().Add(time.Hour)
+	store.CreateURL(context.Background(), &domain.URL{ShortURL: "soon", OriginalURL: "https://launch.example.com", ExpiresAt: expires, ActivatesAt: launch})
+	store.CreateURL(context.Background(), &domain.URL{ShortURL: "teaser", OriginalURL: "https://launch.example.com", ExpiresAt: expires, ActivatesAt: launch, FallbackURL: "https://example.com/teaser"})
+	store.CreateURL(context.Background(), &domain.URL{ShortURL: "close", OriginalURL: "https://launch.example.com", ExpiresAt: expires, ActivatesAt: time.Now().Add(10 * time.Second)})
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	svc := service.NewURLService(store, memory.NewCache(time.Hour, 10), &mockBloom{data: make(map[string]bool)}, logger, mockBaseURL)
+
+	serve := func(h *Handler, path string) *httptest.ResponseRecorder {
+		mux := http.NewServeMux()
+		h.RegisterRoutes(mux)
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+		return rr
+	}
+
+	rr := serve(NewHandler(svc), "/soon")
+	if rr.Code != http.StatusNotFound || !strings.Contains(rr.Body.String(), "Coming soon") || rr.Header().Get("Cache-Control") != "max-age=60" {
+		t.Errorf("expected the coming soon page cached a minute, got %d %q", rr.Code, rr.Header().Get("Cache-Control"))
+	}
+	rr = serve(NewHandler(svc).WithComingSoon("https://example.com/launch"), "/soon")
+	if rr.Code != http.StatusFound || rr.Header().Get("Location") != "https://example.com/launch" {
+		t.Errorf("expected a 302 to the default fallback, got %d %q", rr.Code, rr.Header().Get("Location"))
+	}
+	rr = serve(NewHandler(svc).WithComingSoon("https://example.com/launch"), "/teaser")
+	if rr.Code != http.StatusFound || rr.Header().Get("Location") != "https://example.com/teaser" {
+		t.Errorf("expected a 302 to the link's own fallback, got %d %q", rr.Code, rr.Header().Get("Location"))
+	}
+	rr = serve(NewHandler(svc), "/close")
+	if cc := rr.Header().Get("Cache-Control"); cc != "max-age=9" && cc != "max-age=10" {
+		t.Errorf("expected caching to stop at the launch, got %q", cc)
+	}
+}
@@ -0,0 +1,63 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"goprl/internal/transfer"
+)
+
+// WithTransfer enables the export and import endpoints, which also need
+// WithAdminToken
+func (h *Handler) WithTransfer(links *transfer.Links) *Handler {
+	h.transfer = links
+	return h
+}
+
+// Streams every link, expired ones included, as JSONL or CSV (?format=csv)
+func (h *Handler) handleExport(w http.ResponseWriter, r *http.Request) {
+	format, err := transfer.ParseFormat(r.URL.Query().Get("format"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", format.ContentType())
+	w.Header().Set("Content-Disposition", `attachment; filename="links.`+string(format)+`"`)
+	// Headers are gone by the time a store error shows up, a truncated body
+	// is all the client will see
+	if _, err := h.transfer.Export(r.Context(), w, format); err != nil {
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// Bodies past this are cut off with a 413, larger exports go in parts
+var maxImportBody int64 = 256 << 20
+
+// Reads a body in the export format and answers with the import report
+func (h *Handler) handleImport(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportBody)
+	format, err := transfer.ParseFormat(r.URL.Query().Get("format"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	report, err := h.transfer.Import(r.Context(), r.Body, format)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		// Links before the failing batch are in, the report says how many
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(struct {
+			*transfer.Report
+			Error string `json:"error"`
+		}{report, err.Error()})
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
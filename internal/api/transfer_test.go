@@ -0,0 +1,84 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"goprl/internal/domain"
+	"goprl/internal/store/memory"
+	"goprl/internal/transfer"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHandler_Transfer(t *testing.T) {
+	store := memory.NewStore()
+	store.CreateURL(context.Background(), &domain.URL{ShortURL: "abc", OriginalURL: "https://a.com", ExpiresAt: time.Now().Add(time.Hour)})
+	mux := http.NewServeMux()
+	newBulkHandler().WithTransfer(&transfer.Links{Store: store, Exporter: store}).WithAdminToken("secret").RegisterRoutes(mux)
+
+	t.Run("Unauthorized", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/api/urls/export", nil)
+		req.Header.Set("Authorization", "Bearer wrong")
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		if rr.Code != http.StatusUnauthorized {
+			t.Errorf("expected 401, got %d", rr.Code)
+		}
+	})
+
+	t.Run("Export", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/api/urls/export?format=csv", nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "text/csv" {
+			t.Fatalf("expected 200 CSV, got %d %s", rr.Code, rr.Header().Get("Content-Type"))
+		}
+		if !strings.HasPrefix(rr.Body.String(), "short_code,") || !strings.Contains(rr.Body.String(), "abc,https://a.com") {
+			t.Errorf("expected a header and the link, got %q", rr.Body.String())
+		}
+	})
+
+	t.Run("Import", func(t *testing.T) {
+		body := `{"short_code":"abc","original_url":"https://b.com","expires_at":"2099-01-01T00:00:00Z"}
+{"short_code":"xyz","original_url":"https://c.com","expires_at":"2099-01-01T00:00:00Z"}`
+		req := httptest.NewRequest("POST", "/api/urls/import", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer secret")
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+		}
+		var report transfer.Report
+		json.NewDecoder(rr.Body).Decode(&report)
+		if report.Imported != 1 || report.Conflicts != 1 || report.Problems[0].ShortCode != "abc" {
+			t.Errorf("expected one import and one conflict on abc, got %+v", report)
+		}
+	})
+
+	t.Run("TooLarge", func(t *testing.T) {
+		defer func(limit int64) { maxImportBody = limit }(maxImportBody)
+		maxImportBody = 64
+		body := strings.Repeat(`{"short_code":"big","original_url":"https://big.com","expires_at":"2099-01-01T00:00:00Z"}`+"\n", 2)
+		req := httptest.NewRequest("POST", "/api/urls/import", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer secret")
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		if rr.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("expected 413, got %d: %s", rr.Code, rr.Body.String())
+		}
+	})
+
+	t.Run("DisabledWithoutToken", func(t *testing.T) {
+		mux := http.NewServeMux()
+		newBulkHandler().WithTransfer(&transfer.Links{Store: store, Exporter: store}).RegisterRoutes(mux)
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, httptest.NewRequest("GET", "/api/urls/export", nil))
+		if rr.Code == http.StatusOK {
+			t.Errorf("expected export disabled, got %d", rr.Code)
+		}
+	})
+}
@@ -0,0 +1,111 @@
+package api
+
+import (
+	"errors"
+	"html/template"
+	"net/http"
+	"time"
+
+	"goprl/internal/domain"
+	"goprl/internal/passcode"
+)
+
+// How long a visitor who entered the password is let through without one
+const defaultUnlockTTL = time.Hour
+
+const unlockCookie = "goprl_unlock"
+
+var promptPage = template.Must(template.New("prompt").Parse(`<!doctype html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>Password required</title>
+<style>
+body { font-family: system-ui, sans-serif; max-width: 22rem; margin: 15vh auto; padding: 0 1rem; }
+input, button { font: inherit; padding: .5rem; width: 100%; box-sizing: border-box; margin-top: .5rem; }
+.error { color: #b00020; }
+</style>
+</head>
+<body>
+<h1>Password required</h1>
+<p>This link is protected.</p>
+{{if .}}<p class="error">{{.}}</p>{{end}}
+<form method="post">
+<input type="password" name="password" autocomplete="current-password" aria-label="Password" required autofocus>
+<button type="submit">Continue</button>
+</form>
+</body>
+</html>
+`))
+
+// WithUnlockCookies sets the key unlock cookies are signed with and how long
+// they last. The default key is random, so cookies don't survive a restart
+// and only work on the instance that issued them.
+func (h *Handler) WithUnlockCookies(signer *passcode.Signer, ttl time.Duration) *Handler {
+	h.signer = signer
+	if ttl > 0 {
+		h.unlockTTL = ttl
+	}
+	return h
+}
+
+// Protected links redirect visitors holding a cookie for them and prompt
+// everyone else. Neither answer may be cached, the next visitor could be
+// someone else.
+func (h *Handler) serveProtected(w http.ResponseWriter, r *http.Request, url *domain.URL) {
+	w.Header().Set("Cache-Control", "no-store")
+	if cookie, err := r.Cookie(unlockCookie); err == nil && h.signer.Check(cookie.Value, url.ShortURL, url.PasswordHash, time.Now()) {
+		if err := h.service.Visit(r.Context(), url); err != nil {
+			resolveError(w, err)
+			return
+		}
+		http.Redirect(w, r, url.OriginalURL, http.StatusFound)
+		return
+	}
+	prompt(w, http.StatusOK, "")
+}
+
+// Checks the password posted from the prompt
+func (h *Handler) handleUnlock(w http.ResponseWriter, r *http.Request) {
+	code := r.PathValue("code")
+	r.Body = http.MaxBytesReader(w, r.Body, 4<<10)
+	w.Header().Set("Cache-Control", "no-store")
+
+	url, err := h.service.Unlock(h.visitorContext(r), code, r.PostFormValue("password"))
+	switch {
+	case errors.Is(err, domain.ErrRateLimitExceeded):
+		prompt(w, http.StatusTooManyRequests, "Too many attempts, try again in a minute.")
+		return
+	case errors.Is(err, domain.ErrWrongPassword):
+		prompt(w, http.StatusUnauthorized, "Wrong password.")
+		return
+	case errors.Is(err, domain.ErrURLNotActive):
+		h.serveScheduled(w, r, url)
+		return
+	case err != nil:
+		resolveError(w, err)
+		return
+	}
+	if url.Protected() {
+		expires := time.Now().Add(h.unlockTTL)
+		http.SetCookie(w, &http.Cookie{
+			Name:     unlockCookie,
+			Value:    h.signer.Sign(url.ShortURL, url.PasswordHash, expires),
+			Path:     "/" + code,
+			Expires:  expires,
+			MaxAge:   int(h.unlockTTL.Seconds()),
+			HttpOnly: true,
+			Secure:   r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https",
+			SameSite: http.SameSiteLaxMode,
+		})
+	}
+	http.Redirect(w, r, url.OriginalURL, http.StatusSeeOther)
+}
+
+func prompt(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	promptPage.Execute(w, message)
+}
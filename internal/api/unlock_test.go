@@ -0,0 +1,76 @@
+package api
+
+import (
+	"context"
+	"goprl/internal/passcode"
+	"goprl/internal/service"
+	"goprl/internal/store/memory"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHandler_ProtectedLink(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	svc := service.NewURLService(memory.NewStore(), memory.NewCache(time.Hour, 10), &mockBloom{data: make(map[string]bool)}, logger, mockBaseURL).
+		WithUnlockLimit(2)
+	link, err := svc.ShortenWith(context.Background(), "https://docs.example.com", service.LinkOptions{Password: "hunter22"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	code := strings.TrimPrefix(link.ShortURL, mockBaseURL+"/")
+	mux := http.NewServeMux()
+	NewHandler(svc).WithUnlockCookies(passcode.NewSigner([]byte("key")), time.Hour).RegisterRoutes(mux)
+
+	visit := func(cookie *http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/"+code, nil)
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		return rr
+	}
+	unlock := func(password string) *httptest.ResponseRecorder {
+		form := url.Values{"password": {password}}
+		req := httptest.NewRequest("POST", "/"+code, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := visit(nil)
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `type="password"`) || rr.Header().Get("Cache-Control") != "no-store" {
+		t.Fatalf("expected an uncached password prompt, got %d %q", rr.Code, rr.Body.String())
+	}
+	if rr := unlock("wrong"); rr.Code != http.StatusUnauthorized || !strings.Contains(rr.Body.String(), "Wrong password") {
+		t.Errorf("expected 401 with the prompt again, got %d", rr.Code)
+	}
+
+	rr = unlock("hunter22")
+	if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "https://docs.example.com" {
+		t.Fatalf("expected 303 to the destination, got %d %q", rr.Code, rr.Header().Get("Location"))
+	}
+	cookies := rr.Result().Cookies()
+	if len(cookies) != 1 || !cookies[0].HttpOnly || cookies[0].Path != "/"+code {
+		t.Fatalf("expected one HttpOnly cookie scoped to the link, got %+v", cookies)
+	}
+	if rr := visit(cookies[0]); rr.Code != http.StatusFound || rr.Header().Get("Location") != "https://docs.example.com" {
+		t.Errorf("expected the cookie to skip the prompt, got %d", rr.Code)
+	}
+	forged := *cookies[0]
+	forged.Value = "x" + forged.Value[1:]
+	if rr := visit(&forged); rr.Code != http.StatusOK {
+		t.Errorf("expected a damaged cookie to prompt again, got %d", rr.Code)
+	}
+
+	if rr := unlock("hunter22"); rr.Code != http.StatusTooManyRequests {
+		t.Errorf("expected attempts limited per code, got %d", rr.Code)
+	}
+}
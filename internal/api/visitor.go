@@ -0,0 +1,54 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"goprl/internal/domain"
+	"goprl/internal/useragent"
+)
+
+// WithTrustedProxies sets the load balancers and proxies whose
+// X-Forwarded-For entries are believed when finding the client address
+func (h *Handler) WithTrustedProxies(prefixes []netip.Prefix) *Handler {
+	h.trusted = prefixes
+	return h
+}
+
+// The request context carrying who's following the link, for its rules
+func (h *Handler) visitorContext(r *http.Request) context.Context {
+	visitor := useragent.Parse(r.UserAgent())
+	visitor.IP = h.clientIP(r)
+	return domain.WithVisitor(r.Context(), visitor)
+}
+
+// X-Forwarded-For is read right to left while the hop that added the entry is
+// a trusted proxy. Anything further left was written by the client and could
+// say anything.
+func (h *Handler) clientIP(r *http.Request) netip.Addr {
+	addr, err := netip.ParseAddrPort(r.RemoteAddr)
+	if err != nil {
+		return netip.Addr{}
+	}
+	ip := addr.Addr().Unmap()
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0 && h.trustedProxy(ip); i-- {
+		next, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		ip = next.Unmap()
+	}
+	return ip
+}
+
+func (h *Handler) trustedProxy(ip netip.Addr) bool {
+	for _, prefix := range h.trusted {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
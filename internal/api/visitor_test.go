@@ -0,0 +1,74 @@
+package api
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+
+	"goprl/internal/domain"
+	"goprl/internal/service"
+	"goprl/internal/store/memory"
+)
+
+func TestHandler_ClientIP(t *testing.T) {
+	h := (&Handler{}).WithTrustedProxies([]netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")})
+	for _, tc := range []struct {
+		remote string
+		xff    []string
+		want   string
+	}{
+		{"203.0.113.7:5000", nil, "203.0.113.7"},
+		// Only trusted proxies get to speak for the client
+		{"203.0.113.7:5000", []string{"81.2.69.142"}, "203.0.113.7"},
+		{"10.0.0.2:5000", []string{"81.2.69.142"}, "81.2.69.142"},
+		{"10.0.0.2:5000", []string{"6.6.6.6, 81.2.69.142, 10.0.0.5"}, "81.2.69.142"},
+		{"10.0.0.2:5000", []string{"6.6.6.6", "81.2.69.142"}, "81.2.69.142"},
+		{"10.0.0.2:5000", []string{"garbage"}, "10.0.0.2"},
+		{"[::ffff:10.0.0.2]:5000", []string{"2a02::1"}, "2a02::1"},
+	} {
+		req := httptest.NewRequest("GET", "/abc", nil)
+		req.RemoteAddr = tc.remote
+		for _, value := range tc.xff {
+			req.Header.Add("X-Forwarded-For", value)
+		}
+		if got := h.clientIP(req); got.String() != tc.want {
+			t.Errorf("%s %v: got %s, want %s", tc.remote, tc.xff, got, tc.want)
+		}
+	}
+}
+
+type mockLocator map[netip.Addr]string
+
+func (m mockLocator) Country(ip netip.Addr) string {
+	return m[ip]
+}
+
+func TestHandler_CountryRule(t *testing.T) {
+	store := memory.NewStore()
+	store.CreateURL(context.Background(), &domain.URL{ShortURL: "shop", OriginalURL: "https://example.com/shop", ExpiresAt: time.Now().Add(time.Hour),
+		Rules: []domain.Rule{{Countries: []string{"GB"}, URL: "https://example.co.uk/shop"}}})
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	svc := service.NewURLService(store, memory.NewCache(time.Hour, 10), &mockBloom{data: make(map[string]bool)}, logger, mockBaseURL).
+		WithCountries(mockLocator{netip.MustParseAddr("81.2.69.142"): "GB"})
+	mux := http.NewServeMux()
+	NewHandler(svc).WithTrustedProxies([]netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}).RegisterRoutes(mux)
+
+	for remote, want := range map[string]string{
+		"10.0.0.2:5000":    "https://example.co.uk/shop",
+		"203.0.113.7:5000": "https://example.com/shop",
+	} {
+		req := httptest.NewRequest("GET", "/shop", nil)
+		req.RemoteAddr = remote
+		req.Header.Set("X-Forwarded-For", "81.2.69.142")
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		if rr.Code != http.StatusFound || rr.Header().Get("Location") != want {
+			t.Errorf("via %s: expected a 302 to %s, got %d %q", remote, want, rr.Code, rr.Header().Get("Location"))
+		}
+	}
+}
@@ -5,57 +5,182 @@ import (
 	"fmt"
 	"goprl/internal/api"
 	"goprl/internal/config"
+	"goprl/internal/domain"
+	"goprl/internal/geoip"
+	"goprl/internal/passcode"
 	"goprl/internal/service"
 	"goprl/internal/store"
-	"goprl/internal/store/postgres"
+	"goprl/internal/store/breaker"
 	"goprl/internal/store/redis"
+	"goprl/internal/transfer"
 	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
+	"sync"
 	"syscall"
 	"time"
 )
 
+// Consecutive failures before a breaker opens and how long it stays open
+const (
+	breakerThreshold = 5
+	breakerCooldown  = 5 * time.Second
+)
+
+// Initial bloom filter sizing and the bitmap key when shared through Redis
+const (
+	bloomExpectedItems = 1000000
+	bloomFalsePositive = 0.01
+	// Versioned with the probe layout, a new key rebuilds from the store
+	bloomRedisKey = "{bloom}:urls:v2"
+)
+
 type app struct {
-	postgresStore *postgres.Store
-	redisStore    *redis.Cache
-	logger        *slog.Logger
-	handler       *api.Handler
-	config        *config.Config
+	stores     *stores
+	redisStore *redis.Cache
+	cache      domain.URLCache
+	logger     *slog.Logger
+	handler    *api.Handler
+	links      *transfer.Links
+	config     *config.Config
+	bloom      *store.WarmingBloom
+	// Exactly one of these backs bloom
+	localBloom  localBloom
+	sharedBloom *redis.Bloom
+	// Nil without GEOIP_DB
+	countries *geoip.Locator
+
+	// Background jobs started by Run, stopped by Close
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
 }
 
 func NewApp(config *config.Config) (*app, error) {
-	postgresStore, err := store.NewPostgresStore(config.DatabaseURL)
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	stores, err := openStores(config, logger)
 	if err != nil {
-		return nil, fmt.Errorf("POSTGRES: %w", err)
+		return nil, fmt.Errorf("%s: %w", strings.ToUpper(store.DatabaseKind(config.DatabaseURL)), err)
 	}
 
-	redisStore, err := store.NewRedisStore(config.RedisURL)
+	// Fail fast on a hung dependency instead of stacking its latency onto every request
+	urlStore := breaker.NewStore(stores.primary, breaker.New(stores.kind, breaker.Options{
+		Timeout:          config.StoreTimeout,
+		FailureThreshold: breakerThreshold,
+		Cooldown:         breakerCooldown,
+	}, logger))
+	var cache domain.URLCache
+	redisStore, err := openRedis(config)
 	if err != nil {
+		stores.Close()
 		return nil, fmt.Errorf("REDIS: %w", err)
 	}
+	if redisStore != nil {
+		cache = breaker.NewCache(redisStore, breaker.New("redis", breaker.Options{
+			Timeout:          config.CacheTimeout,
+			FailureThreshold: breakerThreshold,
+			Cooldown:         breakerCooldown,
+		}, logger))
+	} else {
+		cache = newLocalCache(config, stores.primary, logger)
+	}
 
-	bloom := store.NewBloomFilter(1000000, 3)
-	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
-	service := service.NewURLService(postgresStore, redisStore, bloom, logger, config.BaseURL)
-	handler := api.NewHandler(service)
+	localBloom, sharedBloom := newBloom(config, redisStore)
+	var bloom *store.WarmingBloom
+	if sharedBloom != nil {
+		bloom = store.NewWarmingBloom(sharedBloom)
+	} else {
+		bloom = store.NewWarmingBloom(localBloom)
+	}
+	publishBloomStats(bloom)
+	service := service.NewURLService(urlStore, cache, bloom, logger, config.BaseURL).
+		WithUnlockLimit(config.UnlockLimit)
+	var countries *geoip.Locator
+	if config.GeoIPPath != "" {
+		countries = geoip.NewLocator(config.GeoIPPath, logger)
+		service.WithCountries(countries)
+	}
+	links := &transfer.Links{
+		Store:    urlStore,
+		Exporter: stores.primary,
+		OnImported: func(url *domain.URL) {
+			bloom.Add(url.OriginalURL)
+		},
+	}
+	handler := api.NewHandler(service).
+		WithBulkLimit(config.BulkLimit).
+		WithAdminToken(config.AdminToken).
+		WithOwnerTokens(config.OwnerTokens).
+		WithTransfer(links).
+		WithUnlockCookies(newSigner(config, logger), config.UnlockTTL).
+		WithComingSoon(config.ComingSoonURL).
+		WithTrustedProxies(config.Trusted)
 
+	ctx, cancel := context.WithCancel(context.Background())
 	return &app{
-		postgresStore: postgresStore,
-		redisStore:    redisStore,
-		logger:        logger,
-		handler:       handler,
-		config:        config,
+		stores:      stores,
+		redisStore:  redisStore,
+		cache:       cache,
+		logger:      logger,
+		handler:     handler,
+		links:       links,
+		config:      config,
+		bloom:       bloom,
+		localBloom:  localBloom,
+		sharedBloom: sharedBloom,
+		countries:   countries,
+		ctx:         ctx,
+		cancel:      cancel,
 	}, nil
 }
 
+// Bounded by the configured deadline so a slow Postgres can't hold up serving
+func (a *app) WarmUp(size int) {
+	if size <= 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), a.config.WarmUpLimit)
+	defer cancel()
+	start := time.Now()
+	warmed, err := warmUp(ctx, a.stores.primary, a.cache, size, a.logger)
+	if err != nil {
+		a.logger.Warn("Cache warm-up incomplete", "warmed", warmed, "error", err, "elapsed", time.Since(start))
+		return
+	}
+	a.logger.Info("Cache warm-up complete", "warmed", warmed, "elapsed", time.Since(start))
+}
+
 func (a *app) Run() error {
+	if a.config.AutoMigrate && a.stores.postgres != nil {
+		applied, err := a.stores.postgres.Migrate(a.ctx)
+		if err != nil {
+			return fmt.Errorf("MIGRATE: %w", err)
+		}
+		a.logger.Info("Schema up to date", "applied", applied)
+	}
+	if !a.restoreBloom(a.ctx) {
+		a.goBackground(a.loadBloom)
+	}
+	if len(a.config.ReplicaURLs) > 0 {
+		a.stores.postgres.CheckReplicas(a.ctx)
+		a.goBackground(a.checkReplicas)
+	}
+	if a.countries != nil {
+		a.goBackground(func(ctx context.Context) { a.countries.Run(ctx, a.config.GeoIPReload) })
+	}
+	if a.config.ReaperMode != "off" {
+		r := a.newReaper()
+		a.goBackground(func(ctx context.Context) { r.run(ctx, a.config.ReaperEvery) })
+	}
+	a.WarmUp(a.config.WarmUpSize)
+
 	mux := http.NewServeMux()
 	a.handler.RegisterRoutes(mux)
 	srv := &http.Server{
 		Addr:    ":" + a.config.Port,
-		Handler: api.RequestIDMiddleware(api.LoggingMiddleware(a.logger)(api.RateLimitMiddleware(a.redisStore, a.config)(mux))),
+		Handler: api.RequestIDMiddleware(api.LoggingMiddleware(a.logger)(api.RateLimitMiddleware(a.cache, a.config)(mux))),
 	}
 	srvErrors := make(chan error, 1)
 	signalChan := make(chan os.Signal, 1)
@@ -93,7 +218,54 @@ func (a *app) Run() error {
 	return nil
 }
 
+func (a *app) newReaper() *reaper {
+	return &reaper{
+		store:   a.stores.reaper,
+		cache:   a.cache,
+		bloom:   a.bloom,
+		logger:  a.logger,
+		grace:   a.config.ReaperGrace,
+		batch:   a.config.ReaperBatch,
+		archive: a.config.ReaperMode == "archive",
+	}
+}
+
+func (a *app) checkReplicas(ctx context.Context) {
+	ticker := time.NewTicker(a.config.ReplicaCheck)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			a.stores.postgres.CheckReplicas(ctx)
+		}
+	}
+}
+
+func (a *app) goBackground(job func(ctx context.Context)) {
+	a.wg.Add(1)
+	go func() {
+		defer a.wg.Done()
+		job(a.ctx)
+	}()
+}
+
 func (a *app) Close() {
-	a.postgresStore.Close()
-	a.redisStore.Close()
+	a.cancel()
+	a.wg.Wait()
+	a.saveBloom()
+	a.stores.Close()
+	if a.redisStore != nil {
+		a.redisStore.Close()
+	}
+}
+
+// Replicas only honour each other's unlock cookies when they share LINK_SECRET
+func newSigner(config *config.Config, logger *slog.Logger) *passcode.Signer {
+	if config.LinkSecret == "" {
+		logger.Warn("LINK_SECRET is not set, unlock cookies won't survive a restart")
+		return passcode.NewRandomSigner()
+	}
+	return passcode.NewSigner([]byte(config.LinkSecret))
 }
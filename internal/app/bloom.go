@@ -0,0 +1,138 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"goprl/internal/config"
+	"goprl/internal/domain"
+	"goprl/internal/store"
+	"goprl/internal/store/redis"
+	"io"
+	"io/fs"
+	"time"
+)
+
+// In-process filters that can be snapshotted to disk
+type localBloom interface {
+	domain.Bloom
+	io.WriterTo
+	io.ReaderFrom
+}
+
+// Filters that count adds rebuild into fresh counters, replaying on top of a
+// restored snapshot would count every link twice and pin the counters
+type recountingBloom interface {
+	Rebuild(fill func(add func(item string)) error) error
+}
+
+type originalURLSource interface {
+	EachOriginalURL(ctx context.Context, fn func(originalURL string)) error
+}
+
+// Exactly one of local or shared is returned, depending on config.BloomBackend
+func newBloom(config *config.Config, redisStore *redis.Cache) (localBloom, *redis.Bloom) {
+	switch config.BloomBackend {
+	case "redis":
+		m, k := store.EstimateParameters(bloomExpectedItems, bloomFalsePositive)
+		return nil, redisStore.Bloom(bloomRedisKey, m, k, config.CacheTimeout)
+	case "counting":
+		return store.NewCountingBloomFilterWithEstimates(bloomExpectedItems, bloomFalsePositive), nil
+	}
+	return store.NewScalableBloomFilter(bloomExpectedItems, bloomFalsePositive), nil
+}
+
+func publishBloomStats(bloom domain.BloomReporter) {
+	if expvar.Get("bloom") == nil {
+		expvar.Publish("bloom", expvar.Func(func() any { return bloom.Stats() }))
+	}
+}
+
+func rebuildBloom(ctx context.Context, src originalURLSource, bloom domain.Bloom) (int, error) {
+	if recounting, ok := bloom.(recountingBloom); ok {
+		n := 0
+		err := recounting.Rebuild(func(add func(item string)) error {
+			var err error
+			n, err = replayURLs(ctx, src, add)
+			return err
+		})
+		return n, err
+	}
+	return replayURLs(ctx, src, bloom.Add)
+}
+
+func replayURLs(ctx context.Context, src originalURLSource, add func(item string)) (int, error) {
+	n := 0
+	err := src.EachOriginalURL(ctx, func(originalURL string) {
+		add(originalURL)
+		n++
+	})
+	return n, err
+}
+
+// A shared filter another replica already populated is used as is. Otherwise
+// the last snapshot is restored so dedupe works straight away, and Run follows
+// up with a rebuild to catch up on anything it missed. Runs before serving so
+// a restore never races with new links being added. Reports whether the
+// rebuild can be skipped.
+func (a *app) restoreBloom(ctx context.Context) bool {
+	if a.sharedBloom != nil {
+		ready, err := a.sharedBloom.Ready(ctx)
+		if err != nil {
+			a.logger.Warn("Shared bloom filter check failed, rebuilding", "error", err)
+		}
+		if ready {
+			a.bloom.SetReady()
+			a.logger.Info("Shared bloom filter ready")
+		}
+		return ready
+	}
+	path := a.config.BloomSnapshot
+	if path == "" {
+		return false
+	}
+	err := store.LoadSnapshot(path, a.localBloom)
+	switch {
+	case err == nil:
+		a.bloom.SetReady()
+		a.logger.Info("Bloom filter restored from snapshot", "path", path)
+	case errors.Is(err, fs.ErrNotExist):
+	default:
+		a.logger.Warn("Bloom filter snapshot unusable, rebuilding", "path", path, "error", err)
+	}
+	return false
+}
+
+// Replays every live link from Postgres. Without a restored snapshot the
+// filter stays warming until this finishes. Goes to the local filter directly
+// so a counting filter can recount rather than add on top of its snapshot.
+func (a *app) loadBloom(ctx context.Context) {
+	start := time.Now()
+	var bloom domain.Bloom = a.bloom
+	if a.localBloom != nil {
+		bloom = a.localBloom
+	}
+	n, err := rebuildBloom(ctx, a.stores.primary, bloom)
+	if err != nil {
+		a.logger.Error("Bloom filter rebuild failed", "added", n, "error", err)
+		return
+	}
+	a.bloom.SetReady()
+	a.logger.Info("Bloom filter rebuilt", "added", n, "elapsed", time.Since(start))
+	if a.sharedBloom != nil {
+		if err := a.sharedBloom.MarkReady(ctx); err != nil {
+			a.logger.Error("Shared bloom filter mark ready failed", "error", err)
+		}
+	}
+	a.saveBloom()
+}
+
+// Partial filters are never written, they would look complete on the next restore
+func (a *app) saveBloom() {
+	if a.localBloom == nil || a.config.BloomSnapshot == "" || !a.bloom.Ready() {
+		return
+	}
+	if err := store.SaveSnapshot(a.config.BloomSnapshot, a.localBloom); err != nil {
+		a.logger.Error("Bloom filter snapshot failed", "path", a.config.BloomSnapshot, "error", err)
+	}
+}
@@ -0,0 +1,58 @@
+package app
+
+import (
+	"context"
+	"goprl/internal/store"
+	"path/filepath"
+	"testing"
+)
+
+type mockURLSource struct {
+	urls []string
+}
+
+func (m *mockURLSource) EachOriginalURL(ctx context.Context, fn func(originalURL string)) error {
+	for _, url := range m.urls {
+		fn(url)
+	}
+	return nil
+}
+
+func TestRebuildBloom(t *testing.T) {
+	bloom := store.NewBloomFilter(1000, 3)
+	n, err := rebuildBloom(context.Background(), &mockURLSource{urls: []string{"https://google.com", "https://yahoo.com"}}, bloom)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n != 2 || !bloom.Contains("https://google.com") || !bloom.Contains("https://yahoo.com") {
+		t.Errorf("got %d added, want both urls in the filter", n)
+	}
+}
+
+func TestRebuildBloom_RestoredCountingFilter(t *testing.T) {
+	urls := []string{"https://google.com", "https://yahoo.com"}
+	saved := store.NewCountingBloomFilter(1000, 3)
+	for _, url := range urls {
+		saved.Add(url)
+	}
+	path := filepath.Join(t.TempDir(), "bloom.snapshot")
+	if err := store.SaveSnapshot(path, saved); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	bloom := store.NewCountingBloomFilter(1000, 3)
+	if err := store.LoadSnapshot(path, bloom); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	n, err := rebuildBloom(context.Background(), &mockURLSource{urls: urls}, bloom)
+	if err != nil || n != 2 {
+		t.Fatalf("got %d added, %v, want 2 added", n, err)
+	}
+	bloom.Remove("https://google.com")
+	if bloom.Contains("https://google.com") {
+		t.Error("got removed url still in the filter, want the rebuild not to count it twice")
+	}
+	if !bloom.Contains("https://yahoo.com") {
+		t.Error("got live url missing after the rebuild")
+	}
+}
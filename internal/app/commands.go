@@ -0,0 +1,150 @@
+package app
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"goprl/internal/transfer"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// RunCommand runs a one-off maintenance command instead of the server
+func (a *app) RunCommand(name string, args []string) error {
+	switch name {
+	case "warmup":
+		fs := flag.NewFlagSet("warmup", flag.ContinueOnError)
+		size := fs.Int("n", a.config.WarmUpSize, "number of links to preload")
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+		a.WarmUp(*size)
+		return nil
+	case "reap":
+		if a.config.ReaperMode == "off" {
+			return fmt.Errorf("REAPER_MODE is off")
+		}
+		_, err := a.newReaper().reap(a.ctx)
+		return err
+	case "migrate":
+		return a.migrate(args)
+	case "export":
+		return a.export(args)
+	case "import":
+		return a.importLinks(args)
+	}
+	return fmt.Errorf("unknown command %q", name)
+}
+
+// migrate [up | down [steps] | status]
+func (a *app) migrate(args []string) error {
+	if a.stores.postgres == nil {
+		return fmt.Errorf("migrations only apply to Postgres, %s stores create their schema on open", a.stores.kind)
+	}
+	action := "up"
+	if len(args) > 0 {
+		action = args[0]
+	}
+	switch action {
+	case "up":
+		applied, err := a.stores.postgres.Migrate(a.ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("applied %d migrations\n", applied)
+		return nil
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				return fmt.Errorf("invalid step count %q", args[1])
+			}
+			steps = n
+		}
+		reverted, err := a.stores.postgres.Rollback(a.ctx, steps)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("reverted %d migrations\n", reverted)
+		return nil
+	case "status":
+		status, err := a.stores.postgres.MigrationStatus(a.ctx)
+		if err != nil {
+			return err
+		}
+		for _, m := range status {
+			state := "pending"
+			if m.Applied {
+				state = "applied"
+			}
+			fmt.Printf("%04d %-40s %s\n", m.Version, m.Name, state)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown migrate action %q", action)
+}
+
+// export [-format jsonl|csv] [-o file], stdout by default
+func (a *app) export(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	formatName := fs.String("format", "jsonl", "jsonl or csv")
+	output := fs.String("o", "", "file to write instead of stdout")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	format, err := transfer.ParseFormat(*formatName)
+	if err != nil {
+		return err
+	}
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	n, err := a.links.Export(a.ctx, w, format)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "exported %d links\n", n)
+	return nil
+}
+
+// import [-format jsonl|csv] [file], stdin by default. The report goes to
+// stdout as JSON.
+func (a *app) importLinks(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	formatName := fs.String("format", "", "jsonl or csv, guessed from the file extension when unset")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	var r io.Reader = os.Stdin
+	if path := fs.Arg(0); path != "" && path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+		if *formatName == "" && strings.HasSuffix(strings.ToLower(path), ".csv") {
+			*formatName = "csv"
+		}
+	}
+	format, err := transfer.ParseFormat(*formatName)
+	if err != nil {
+		return err
+	}
+	report, err := a.links.Import(a.ctx, r, format)
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if encodeErr := enc.Encode(report); encodeErr != nil && err == nil {
+		err = encodeErr
+	}
+	return err
+}
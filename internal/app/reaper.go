@@ -0,0 +1,67 @@
+package app
+
+import (
+	"context"
+	"expvar"
+	"goprl/internal/domain"
+	"log/slog"
+	"time"
+)
+
+var reapedTotal = expvar.NewInt("reaper_reaped_total")
+
+type expiredReaper interface {
+	ReapExpired(ctx context.Context, cutoff time.Time, batchSize int, archive bool, onBatch func([]domain.ReapedURL)) (int, bool, error)
+}
+
+type reaper struct {
+	store   expiredReaper
+	cache   domain.URLCache
+	bloom   domain.RemovableBloom
+	logger  *slog.Logger
+	grace   time.Duration
+	batch   int
+	archive bool
+}
+
+// Runs one pass, returns how many links it removed. Only one replica reaps
+// at a time, the others skip the round.
+func (r *reaper) reap(ctx context.Context) (int, error) {
+	start := time.Now()
+	reaped, locked, err := r.store.ReapExpired(ctx, start.Add(-r.grace), r.batch, r.archive, func(batch []domain.ReapedURL) {
+		keys := make([]string, 0, 2*len(batch))
+		for _, url := range batch {
+			keys = append(keys, url.ShortURL, url.OriginalURL)
+			if url.Deduped {
+				r.bloom.Remove(url.OriginalURL)
+			}
+		}
+		if err := r.cache.Delete(ctx, keys...); err != nil {
+			r.logger.Warn("Reaper cache purge failed", "error", err)
+		}
+	})
+	reapedTotal.Add(int64(reaped))
+	if !locked && err == nil {
+		r.logger.Info("Reaper skipped, another replica holds the lock")
+		return 0, nil
+	}
+	if err != nil {
+		r.logger.Error("Reaper failed", "reaped", reaped, "error", err)
+		return reaped, err
+	}
+	r.logger.Info("Reaper finished", "reaped", reaped, "archive", r.archive, "elapsed", time.Since(start))
+	return reaped, nil
+}
+
+func (r *reaper) run(ctx context.Context, every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.reap(ctx)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package app
+
+import (
+	"context"
+	"goprl/internal/domain"
+	"goprl/internal/store"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+type mockReaper struct {
+	batches [][]domain.ReapedURL
+	locked  bool
+	cutoff  time.Time
+}
+
+func (m *mockReaper) ReapExpired(ctx context.Context, cutoff time.Time, batchSize int, archive bool, onBatch func([]domain.ReapedURL)) (int, bool, error) {
+	m.cutoff = cutoff
+	if !m.locked {
+		return 0, false, nil
+	}
+	n := 0
+	for _, batch := range m.batches {
+		onBatch(batch)
+		n += len(batch)
+	}
+	return n, true, nil
+}
+
+type deleteCache struct {
+	domain.URLCache
+	deleted []string
+}
+
+func (m *deleteCache) Delete(ctx context.Context, keys ...string) error {
+	m.deleted = append(m.deleted, keys...)
+	return nil
+}
+
+func TestReaper(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	expired := domain.ReapedURL{URL: &domain.URL{ShortURL: "abc", OriginalURL: "https://google.com"}, Deduped: true}
+	// Never added to the filter, the live link for the same URL was
+	tagged := domain.ReapedURL{URL: &domain.URL{ShortURL: "abd", OriginalURL: "https://yahoo.com", Tags: []string{"spring"}}}
+
+	t.Run("PurgesCacheAndBloom", func(t *testing.T) {
+		cache := &deleteCache{}
+		bloom := store.NewWarmingBloom(store.NewCountingBloomFilter(1000, 3))
+		bloom.SetReady()
+		bloom.Add(expired.OriginalURL)
+		bloom.Add(tagged.OriginalURL)
+		r := &reaper{
+			store:  &mockReaper{locked: true, batches: [][]domain.ReapedURL{{expired, tagged}}},
+			cache:  cache,
+			bloom:  bloom,
+			logger: logger,
+			grace:  time.Hour,
+			batch:  100,
+		}
+
+		reaped, err := r.reap(context.Background())
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if reaped != 2 {
+			t.Errorf("got %d reaped, want 2", reaped)
+		}
+		if len(cache.deleted) != 4 || cache.deleted[0] != "abc" || cache.deleted[1] != "https://google.com" {
+			t.Errorf("got deleted keys %v, want codes and original urls", cache.deleted)
+		}
+		if bloom.Contains(expired.OriginalURL) {
+			t.Error("expected reaped url to be removed from the bloom filter")
+		}
+		if !bloom.Contains(tagged.OriginalURL) {
+			t.Error("expected a link that never deduped to leave the bloom filter alone")
+		}
+	})
+
+	t.Run("GracePeriod", func(t *testing.T) {
+		expiredStore := &mockReaper{locked: true}
+		r := &reaper{store: expiredStore, cache: &deleteCache{}, bloom: plainBloom(), logger: logger, grace: 24 * time.Hour, batch: 100}
+		r.reap(context.Background())
+		if since := time.Since(expiredStore.cutoff); since < 24*time.Hour || since > 25*time.Hour {
+			t.Errorf("got cutoff %v ago, want 24h", since)
+		}
+	})
+
+	t.Run("OtherReplicaHoldsLock", func(t *testing.T) {
+		cache := &deleteCache{}
+		r := &reaper{store: &mockReaper{locked: false}, cache: cache, bloom: plainBloom(), logger: logger, batch: 100}
+		reaped, err := r.reap(context.Background())
+		if err != nil || reaped != 0 || len(cache.deleted) != 0 {
+			t.Errorf("got %d %v %v, want a skipped pass", reaped, err, cache.deleted)
+		}
+	})
+}
+
+func plainBloom() *store.WarmingBloom {
+	return store.NewWarmingBloom(store.NewBloomFilter(1000, 3))
+}
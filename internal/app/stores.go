@@ -0,0 +1,111 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"goprl/internal/config"
+	"goprl/internal/domain"
+	"goprl/internal/store"
+	"goprl/internal/store/memory"
+	"goprl/internal/store/postgres"
+	"goprl/internal/store/redis"
+	"log/slog"
+
+	goredis "github.com/go-redis/redis/v8"
+)
+
+// Serves the request path, warm-up, bloom rebuilds and the reaper
+type primaryStore interface {
+	domain.URLStore
+	recentLister
+	originalURLSource
+	domain.URLExporter
+	Close() error
+}
+
+type stores struct {
+	kind    string
+	primary primaryStore
+	reaper  expiredReaper
+	// Only set for Postgres, owns migrations and replica health checks
+	postgres *postgres.Store
+}
+
+func openStores(config *config.Config, logger *slog.Logger) (*stores, error) {
+	kind := store.DatabaseKind(config.DatabaseURL)
+	if kind != "postgres" && (config.DBDriver != "sql" || len(config.ReplicaURLs) > 0) {
+		return nil, fmt.Errorf("DB_DRIVER and DATABASE_REPLICA_URLS only apply to Postgres")
+	}
+	switch kind {
+	case "memory":
+		s := store.NewMemoryStore()
+		return &stores{kind: kind, primary: s, reaper: s}, nil
+	case "sqlite":
+		s, err := store.NewSQLiteStore(config.DatabaseURL)
+		if err != nil {
+			return nil, err
+		}
+		return &stores{kind: kind, primary: s, reaper: s}, nil
+	}
+
+	postgresStore, err := store.NewReplicatedPostgresStore(config.DatabaseURL, config.ReplicaURLs, postgres.ReplicaOptions{
+		MaxLag: config.ReplicaLag,
+		// Leaves room for the primary retry inside DB_TIMEOUT
+		Timeout: config.StoreTimeout / 2,
+		Logger:  logger,
+	})
+	if err != nil {
+		return nil, err
+	}
+	s := &stores{kind: kind, primary: postgresStore, reaper: postgresStore, postgres: postgresStore}
+	if config.DBDriver == "pgxpool" {
+		// Migrations and the reaper stay on database/sql
+		s.primary, err = store.NewPostgresPoolStore(config.DatabaseURL, postgres.PoolOptions{
+			MaxConns:               int32(config.DBMaxConns),
+			MaxConnLifetime:        config.DBLifetime,
+			StatementCacheCapacity: config.DBStmtCache,
+		})
+		if err != nil {
+			postgresStore.Close()
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// Without Redis the counter starts where the store left off, otherwise every
+// code issued after a restart would collide once before resyncing
+func newLocalCache(config *config.Config, urlStore domain.URLStore, logger *slog.Logger) *memory.Cache {
+	cache := store.NewLocalCache(config.CacheTTL, config.CacheSize)
+	ctx, cancel := context.WithTimeout(context.Background(), config.StoreTimeout)
+	defer cancel()
+	if maxID, err := urlStore.GetMaxID(ctx); err != nil {
+		logger.Warn("Counter not seeded, first codes will resync", "error", err)
+	} else {
+		cache.SetCounter(ctx, "counter", maxID)
+	}
+	return cache
+}
+
+// REDIS_ADDRS configures Sentinel or Cluster explicitly, REDIS_URL covers
+// everything else. Nil when neither is set.
+func openRedis(config *config.Config) (*redis.Cache, error) {
+	if len(config.RedisAddrs) > 0 {
+		return store.NewRedisStoreFromOptions(&goredis.UniversalOptions{
+			Addrs:      config.RedisAddrs,
+			MasterName: config.RedisMaster,
+			Password:   config.RedisPassword,
+		}, config.CacheTTL)
+	}
+	if config.RedisURL != "" {
+		return store.NewRedisStore(config.RedisURL, config.CacheTTL)
+	}
+	return nil, nil
+}
+
+func (s *stores) Close() {
+	s.primary.Close()
+	if s.postgres != nil && s.primary != s.postgres {
+		s.postgres.Close()
+	}
+}
@@ -0,0 +1,56 @@
+package app
+
+import (
+	"context"
+	"goprl/internal/domain"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+)
+
+// Parallel cache writes during warm-up, keeps Redis from being flooded after a deploy
+const warmUpConcurrency = 16
+
+type recentLister interface {
+	ListRecent(ctx context.Context, limit int) ([]*domain.URL, error)
+}
+
+// Preloads the newest live links into the cache so the first wave of redirects
+// after a deploy or flush doesn't all land on Postgres. There's no click data
+// yet, so recency stands in for popularity. Stops early when ctx is done.
+func warmUp(ctx context.Context, store recentLister, cache domain.URLCache, limit int, logger *slog.Logger) (int64, error) {
+	urls, err := store.ListRecent(ctx, limit)
+	if err != nil {
+		return 0, err
+	}
+
+	var warmed atomic.Int64
+	var wg sync.WaitGroup
+	jobs := make(chan *domain.URL)
+	for range min(warmUpConcurrency, len(urls)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for url := range jobs {
+				if err := cache.Set(ctx, url.ShortURL, url, 0); err != nil {
+					logger.Warn("Warm-up cache set failed", "code", url.ShortURL, "error", err)
+					continue
+				}
+				warmed.Add(1)
+			}
+		}()
+	}
+
+feed:
+	for _, url := range urls {
+		select {
+		case jobs <- url:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	return warmed.Load(), ctx.Err()
+}
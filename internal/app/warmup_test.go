@@ -0,0 +1,91 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"goprl/internal/domain"
+	"io"
+	"log/slog"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+type mockLister struct {
+	urls []*domain.URL
+	err  error
+}
+
+func (m *mockLister) ListRecent(ctx context.Context, limit int) ([]*domain.URL, error) {
+	return m.urls[:min(limit, len(m.urls))], m.err
+}
+
+type mockCache struct {
+	domain.URLCache
+	mu    sync.Mutex
+	data  map[string]*domain.URL
+	delay time.Duration
+}
+
+func (m *mockCache) Set(ctx context.Context, key string, value *domain.URL, ttl time.Duration) error {
+	select {
+	case <-time.After(m.delay):
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.data[key] = value
+	return nil
+}
+
+func testURLs(n int) []*domain.URL {
+	urls := make([]*domain.URL, n)
+	for i := range urls {
+		code := strconv.Itoa(i)
+		urls[i] = &domain.URL{ShortURL: code, OriginalURL: "https://example.com/" + code}
+	}
+	return urls
+}
+
+func TestWarmUp(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	t.Run("Preloads", func(t *testing.T) {
+		cache := &mockCache{data: make(map[string]*domain.URL)}
+		warmed, err := warmUp(context.Background(), &mockLister{urls: testURLs(100)}, cache, 50, logger)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if warmed != 50 || len(cache.data) != 50 {
+			t.Errorf("got %d warmed, %d cached, want 50", warmed, len(cache.data))
+		}
+	})
+
+	t.Run("Deadline", func(t *testing.T) {
+		cache := &mockCache{data: make(map[string]*domain.URL), delay: 10 * time.Millisecond}
+		ctx, cancel := context.WithTimeout(context.Background(), 25*time.Millisecond)
+		defer cancel()
+
+		start := time.Now()
+		warmed, err := warmUp(ctx, &mockLister{urls: testURLs(1000)}, cache, 1000, logger)
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("got %v, want deadline exceeded", err)
+		}
+		if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+			t.Errorf("warm-up took %v, want it bounded by the deadline", elapsed)
+		}
+		if warmed == 0 || warmed == 1000 {
+			t.Errorf("got %d warmed, want a partial warm-up", warmed)
+		}
+	})
+
+	t.Run("StoreError", func(t *testing.T) {
+		cache := &mockCache{data: make(map[string]*domain.URL)}
+		_, err := warmUp(context.Background(), &mockLister{err: errors.New("db down")}, cache, 10, logger)
+		if err == nil {
+			t.Fatal("expected error, but got nil")
+		}
+	})
+}
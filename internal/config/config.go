@@ -2,32 +2,82 @@ package config
 
 import (
 	"fmt"
+	"net/netip"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
 type Config struct {
-	DatabaseURL string
-	RedisURL    string
-	Port        string
-	BaseURL     string
-	RateLimit   int
-	Env         string
+	DatabaseURL   string
+	RedisURL      string
+	RedisAddrs    []string
+	RedisMaster   string
+	RedisPassword string
+	Port          string
+	BaseURL       string
+	RateLimit     int
+	BulkLimit     int
+	AdminToken    string
+	OwnerTokens   map[string]string
+	LinkSecret    string
+	UnlockTTL     time.Duration
+	UnlockLimit   int
+	ComingSoonURL string
+	GeoIPPath     string
+	GeoIPReload   time.Duration
+	Trusted       []netip.Prefix
+	CacheTTL      time.Duration
+	CacheTimeout  time.Duration
+	CacheSize     int
+	StoreTimeout  time.Duration
+	DBDriver      string
+	DBMaxConns    int
+	DBLifetime    time.Duration
+	DBStmtCache   int
+	ReplicaURLs   []string
+	ReplicaLag    time.Duration
+	ReplicaCheck  time.Duration
+	WarmUpSize    int
+	WarmUpLimit   time.Duration
+	BloomSnapshot string
+	BloomBackend  string
+	AutoMigrate   bool
+	ReaperMode    string
+	ReaperEvery   time.Duration
+	ReaperGrace   time.Duration
+	ReaperBatch   int
+	Env           string
 }
 
 func NewConfig() (*Config, error) {
 	_ = godotenv.Load()
-	var databaseURL, redisURL, port, baseURL, rateLimit, env string
+	var databaseURL, redisURL, port, baseURL, rateLimit, dbDriver, dbMaxConns, dbStmtCache, warmUpSize, bloomBackend, reaperMode, reaperBatch, env string
 	if port = os.Getenv("PORT"); port == "" {
 		port = "8080"
 	}
 	if databaseURL = os.Getenv("DATABASE_URL"); databaseURL == "" {
 		return nil, fmt.Errorf("DATABASE_URL is not set")
 	}
-	if redisURL = os.Getenv("REDIS_URL"); redisURL == "" {
-		return nil, fmt.Errorf("REDIS_URL is not set")
+	// Unset runs the cache, counter and rate limiter in process
+	redisURL = os.Getenv("REDIS_URL")
+	// Sentinel or Cluster configured explicitly instead of by URL: several
+	// addresses are cluster seeds, a master name makes them sentinels
+	var redisAddrs []string
+	for _, addr := range strings.Split(os.Getenv("REDIS_ADDRS"), ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			redisAddrs = append(redisAddrs, addr)
+		}
+	}
+	redisMaster := os.Getenv("REDIS_SENTINEL_MASTER")
+	if len(redisAddrs) > 0 && redisURL != "" {
+		return nil, fmt.Errorf("REDIS_URL and REDIS_ADDRS are mutually exclusive")
+	}
+	if redisMaster != "" && len(redisAddrs) == 0 {
+		return nil, fmt.Errorf("REDIS_SENTINEL_MASTER requires REDIS_ADDRS")
 	}
 	if baseURL = os.Getenv("BASE_URL"); baseURL == "" {
 		baseURL = "http://localhost:" + port
@@ -39,15 +89,237 @@ func NewConfig() (*Config, error) {
 	if err != nil {
 		return nil, fmt.Errorf("RATE_LIMIT is not a valid integer")
 	}
+	// URLs accepted per POST /api/urls/bulk request
+	bulkLimit := 1000
+	if value := os.Getenv("BULK_LIMIT"); value != "" {
+		if bulkLimit, err = strconv.Atoi(value); err != nil || bulkLimit < 1 {
+			return nil, fmt.Errorf("BULK_LIMIT is not a valid integer")
+		}
+	}
+	// Upper bound on cache entry lifetime, entries also never outlive the link
+	ttl, err := parseDuration("CACHE_TTL", "1h")
+	if err != nil {
+		return nil, err
+	}
+	cacheTimeout, err := parseDuration("CACHE_TIMEOUT", "100ms")
+	if err != nil {
+		return nil, err
+	}
+	storeTimeout, err := parseDuration("DB_TIMEOUT", "2s")
+	if err != nil {
+		return nil, err
+	}
+	// sql goes through database/sql, pgxpool uses pgx natively on the request path
+	if dbDriver = os.Getenv("DB_DRIVER"); dbDriver == "" {
+		dbDriver = "sql"
+	}
+	if dbDriver != "sql" && dbDriver != "pgxpool" {
+		return nil, fmt.Errorf("DB_DRIVER must be sql or pgxpool")
+	}
+	// Pool sizing for pgxpool, 0 keeps the driver default
+	if dbMaxConns = os.Getenv("DB_MAX_CONNS"); dbMaxConns == "" {
+		dbMaxConns = "0"
+	}
+	maxConns, err := strconv.Atoi(dbMaxConns)
+	if err != nil || maxConns < 0 {
+		return nil, fmt.Errorf("DB_MAX_CONNS is not a valid integer")
+	}
+	// 0, the default, keeps the driver default or the URL's pool_max_conn_lifetime
+	var dbLifetime time.Duration
+	if value := os.Getenv("DB_CONN_LIFETIME"); value != "" {
+		if dbLifetime, err = time.ParseDuration(value); err != nil || dbLifetime < 0 {
+			return nil, fmt.Errorf("DB_CONN_LIFETIME is not a valid duration")
+		}
+	}
+	if dbStmtCache = os.Getenv("DB_STATEMENT_CACHE"); dbStmtCache == "" {
+		dbStmtCache = "512"
+	}
+	stmtCache, err := strconv.Atoi(dbStmtCache)
+	if err != nil || stmtCache < 1 {
+		return nil, fmt.Errorf("DB_STATEMENT_CACHE is not a valid integer")
+	}
+	// Comma separated, link lookups are spread over these when set
+	var replicaURLs []string
+	for _, replicaURL := range strings.Split(os.Getenv("DATABASE_REPLICA_URLS"), ",") {
+		if replicaURL = strings.TrimSpace(replicaURL); replicaURL != "" {
+			replicaURLs = append(replicaURLs, replicaURL)
+		}
+	}
+	if len(replicaURLs) > 0 && dbDriver != "sql" {
+		return nil, fmt.Errorf("DATABASE_REPLICA_URLS requires DB_DRIVER=sql")
+	}
+	replicaLag, err := parseDuration("DB_REPLICA_MAX_LAG", "5s")
+	if err != nil {
+		return nil, err
+	}
+	replicaCheck, err := parseDuration("DB_REPLICA_CHECK_INTERVAL", "5s")
+	if err != nil {
+		return nil, err
+	}
+	// Links preloaded into the cache on startup, 0 disables
+	if warmUpSize = os.Getenv("WARMUP_SIZE"); warmUpSize == "" {
+		warmUpSize = "1000"
+	}
+	warmUpN, err := strconv.Atoi(warmUpSize)
+	if err != nil || warmUpN < 0 {
+		return nil, fmt.Errorf("WARMUP_SIZE is not a valid integer")
+	}
+	// Longest startup waits on warm-up before serving
+	warmUpLimit, err := parseDuration("WARMUP_TIMEOUT", "5s")
+	if err != nil {
+		return nil, err
+	}
+	// memory keeps a growing filter per instance, counting also supports
+	// removal, redis shares one filter across replicas
+	if bloomBackend = os.Getenv("BLOOM_BACKEND"); bloomBackend == "" {
+		bloomBackend = "memory"
+	}
+	if bloomBackend != "memory" && bloomBackend != "counting" && bloomBackend != "redis" {
+		return nil, fmt.Errorf("BLOOM_BACKEND must be memory, counting or redis")
+	}
+	if bloomBackend == "redis" && redisURL == "" && len(redisAddrs) == 0 {
+		return nil, fmt.Errorf("BLOOM_BACKEND=redis requires REDIS_URL or REDIS_ADDRS")
+	}
+	// Entries the in-process cache holds without Redis
+	cacheSize := 100000
+	if value := os.Getenv("CACHE_SIZE"); value != "" {
+		if cacheSize, err = strconv.Atoi(value); err != nil || cacheSize < 1 {
+			return nil, fmt.Errorf("CACHE_SIZE is not a valid integer")
+		}
+	}
+	// Apply pending schema migrations on startup, otherwise run `migrate up`
+	autoMigrate := true
+	if value := os.Getenv("AUTO_MIGRATE"); value != "" {
+		if autoMigrate, err = strconv.ParseBool(value); err != nil {
+			return nil, fmt.Errorf("AUTO_MIGRATE is not a valid boolean")
+		}
+	}
+	// Expired link cleanup: archive moves rows to urls_archive, delete drops them
+	if reaperMode = os.Getenv("REAPER_MODE"); reaperMode == "" {
+		reaperMode = "archive"
+	}
+	if reaperMode != "off" && reaperMode != "delete" && reaperMode != "archive" {
+		return nil, fmt.Errorf("REAPER_MODE must be off, delete or archive")
+	}
+	reaperEvery, err := parseDuration("REAPER_INTERVAL", "10m")
+	if err != nil {
+		return nil, err
+	}
+	reaperGrace, err := parseDuration("REAPER_GRACE", "24h")
+	if err != nil {
+		return nil, err
+	}
+	if reaperBatch = os.Getenv("REAPER_BATCH"); reaperBatch == "" {
+		reaperBatch = "500"
+	}
+	batch, err := strconv.Atoi(reaperBatch)
+	if err != nil || batch < 1 {
+		return nil, fmt.Errorf("REAPER_BATCH is not a valid integer")
+	}
+	// Lifetime of the cookie that lets a visitor back into a protected link
+	unlockTTL, err := parseDuration("UNLOCK_COOKIE_TTL", "1h")
+	if err != nil {
+		return nil, err
+	}
+	// Password attempts per protected link per minute
+	unlockLimit := 5
+	if value := os.Getenv("UNLOCK_LIMIT"); value != "" {
+		if unlockLimit, err = strconv.Atoi(value); err != nil || unlockLimit < 1 {
+			return nil, fmt.Errorf("UNLOCK_LIMIT is not a valid integer")
+		}
+	}
+	// Where visitors to links that haven't launched go, unset serves a page
+	comingSoonURL := os.Getenv("COMING_SOON_URL")
+	if comingSoonURL != "" && !strings.HasPrefix(comingSoonURL, "http://") && !strings.HasPrefix(comingSoonURL, "https://") {
+		return nil, fmt.Errorf("COMING_SOON_URL must be an http or https URL")
+	}
+	// Country database for geo rules, unset leaves country rules unmatched
+	geoIPReload, err := parseDuration("GEOIP_RELOAD_INTERVAL", "1m")
+	if err != nil {
+		return nil, err
+	}
+	// Proxies whose X-Forwarded-For entries are believed, as IPs or CIDRs
+	var trusted []netip.Prefix
+	for _, value := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if value = strings.TrimSpace(value); value == "" {
+			continue
+		}
+		prefix, err := netip.ParsePrefix(value)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(value)
+			if addrErr != nil {
+				return nil, fmt.Errorf("TRUSTED_PROXIES must be a comma separated list of IPs or CIDRs")
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		trusted = append(trusted, prefix.Masked())
+	}
+	// owner:token pairs, each token shortens and lists links as its owner
+	ownerTokens := make(map[string]string)
+	for _, value := range strings.Split(os.Getenv("OWNER_TOKENS"), ",") {
+		if value = strings.TrimSpace(value); value == "" {
+			continue
+		}
+		owner, token, ok := strings.Cut(value, ":")
+		if !ok || owner == "" || token == "" || ownerTokens[token] != "" {
+			return nil, fmt.Errorf("OWNER_TOKENS must be a comma separated list of distinct owner:token pairs")
+		}
+		ownerTokens[token] = owner
+	}
 	if env = os.Getenv("ENV"); env == "" {
 		env = "dev"
 	}
 	return &Config{
-		DatabaseURL: databaseURL,
-		RedisURL:    redisURL,
-		Port:        port,
-		BaseURL:     baseURL,
-		RateLimit:   limit,
-		Env:         env,
+		DatabaseURL:   databaseURL,
+		RedisURL:      redisURL,
+		RedisAddrs:    redisAddrs,
+		RedisMaster:   redisMaster,
+		RedisPassword: os.Getenv("REDIS_PASSWORD"),
+		Port:          port,
+		BaseURL:       baseURL,
+		RateLimit:     limit,
+		BulkLimit:     bulkLimit,
+		AdminToken:    os.Getenv("ADMIN_TOKEN"),
+		OwnerTokens:   ownerTokens,
+		LinkSecret:    os.Getenv("LINK_SECRET"),
+		UnlockTTL:     unlockTTL,
+		UnlockLimit:   unlockLimit,
+		ComingSoonURL: comingSoonURL,
+		GeoIPPath:     os.Getenv("GEOIP_DB"),
+		GeoIPReload:   geoIPReload,
+		Trusted:       trusted,
+		CacheTTL:      ttl,
+		CacheTimeout:  cacheTimeout,
+		CacheSize:     cacheSize,
+		StoreTimeout:  storeTimeout,
+		DBDriver:      dbDriver,
+		DBMaxConns:    maxConns,
+		DBLifetime:    dbLifetime,
+		DBStmtCache:   stmtCache,
+		ReplicaURLs:   replicaURLs,
+		ReplicaLag:    replicaLag,
+		ReplicaCheck:  replicaCheck,
+		WarmUpSize:    warmUpN,
+		WarmUpLimit:   warmUpLimit,
+		BloomSnapshot: os.Getenv("BLOOM_SNAPSHOT"),
+		BloomBackend:  bloomBackend,
+		AutoMigrate:   autoMigrate,
+		ReaperMode:    reaperMode,
+		ReaperEvery:   reaperEvery,
+		ReaperGrace:   reaperGrace,
+		ReaperBatch:   batch,
+		Env:           env,
 	}, nil
 }
+
+func parseDuration(name string, fallback string) (time.Duration, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		value = fallback
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("%s is not a valid duration", name)
+	}
+	return d, nil
+}
@@ -0,0 +1,102 @@
+package domain
+
+import (
+	"context"
+	"net/netip"
+	"slices"
+	"strings"
+)
+
+const maxRules = 20
+
+// Values Visitor.OS and Visitor.Device take, empty when the agent isn't
+// recognised
+var (
+	ruleOS      = map[string]bool{"ios": true, "android": true, "windows": true, "macos": true, "linux": true, "chromeos": true}
+	ruleDevices = map[string]bool{"mobile": true, "tablet": true, "desktop": true}
+)
+
+// Rule sends visitors matching every condition it sets to URL. A link's
+// rules are tried in order and the first match wins, visitors matching none
+// go to OriginalURL.
+type Rule struct {
+	OS     string `json:"os,omitempty"`
+	Device string `json:"device,omitempty"`
+	// ISO 3166 alpha-2 codes, the visitor's country must be one of them
+	Countries []string `json:"countries,omitempty"`
+	// Matches crawlers and link preview fetchers only
+	Bot bool   `json:"bot,omitempty"`
+	URL string `json:"url"`
+}
+
+func (r Rule) Matches(v Visitor) bool {
+	return (r.OS == "" || r.OS == v.OS) && (r.Device == "" || r.Device == v.Device) && (!r.Bot || v.Bot) &&
+		(len(r.Countries) == 0 || slices.Contains(r.Countries, v.Country))
+}
+
+// What rules know about whoever followed a link. Country is filled in from
+// IP by a CountryLocator, and only for links with country rules.
+type Visitor struct {
+	OS      string
+	Device  string
+	Bot     bool
+	IP      netip.Addr
+	Country string
+}
+
+// Maps client addresses to ISO 3166 alpha-2 country codes, "" when unknown
+type CountryLocator interface {
+	Country(ip netip.Addr) string
+}
+
+type visitorKey struct{}
+
+func WithVisitor(ctx context.Context, v Visitor) context.Context {
+	return context.WithValue(ctx, visitorKey{}, v)
+}
+
+// The zero Visitor when none was attached, it only matches rules without
+// conditions
+func VisitorFrom(ctx context.Context) Visitor {
+	v, _ := ctx.Value(visitorKey{}).(Visitor)
+	return v
+}
+
+// NormalizeRules lowercases conditions, uppercases countries and checks
+// every rule sets at least one known condition and a destination.
+// Destinations are checked by the caller.
+func NormalizeRules(rules []Rule) ([]Rule, error) {
+	if len(rules) == 0 {
+		return nil, nil
+	}
+	if len(rules) > maxRules {
+		return nil, ErrInvalidRules
+	}
+	normalized := make([]Rule, len(rules))
+	for i, rule := range rules {
+		rule.OS = strings.ToLower(strings.TrimSpace(rule.OS))
+		rule.Device = strings.ToLower(strings.TrimSpace(rule.Device))
+		rule.URL = strings.TrimSpace(rule.URL)
+		if rule.OS != "" && !ruleOS[rule.OS] || rule.Device != "" && !ruleDevices[rule.Device] {
+			return nil, ErrInvalidRules
+		}
+		if rule.Countries != nil {
+			countries := make([]string, len(rule.Countries))
+			for j, country := range rule.Countries {
+				if countries[j] = strings.ToUpper(strings.TrimSpace(country)); !countryCode(countries[j]) {
+					return nil, ErrInvalidRules
+				}
+			}
+			rule.Countries = countries
+		}
+		if rule.OS == "" && rule.Device == "" && len(rule.Countries) == 0 && !rule.Bot || rule.URL == "" {
+			return nil, ErrInvalidRules
+		}
+		normalized[i] = rule
+	}
+	return normalized, nil
+}
+
+func countryCode(code string) bool {
+	return len(code) == 2 && 'A' <= code[0] && code[0] <= 'Z' && 'A' <= code[1] && code[1] <= 'Z'
+}
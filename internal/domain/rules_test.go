@@ -0,0 +1,54 @@
+package domain
+
+import (
+	"context"
+	"testing"
+)
+
+func TestURL_Destination(t *testing.T) {
+	url := &URL{OriginalURL: "https://example.com/app", Rules: []Rule{
+		{Bot: true, URL: "https://example.com/preview"},
+		{OS: "ios", URL: "https://apps.apple.com/app/id1"},
+		{OS: "android", Device: "mobile", URL: "https://play.google.com/store/apps/details?id=app"},
+		{Countries: []string{"DE", "AT"}, URL: "https://example.com/de/app"},
+	}}
+	for _, tc := range []struct {
+		visitor Visitor
+		want    string
+	}{
+		{Visitor{OS: "ios", Device: "mobile"}, "https://apps.apple.com/app/id1"},
+		{Visitor{OS: "ios", Device: "mobile", Bot: true}, "https://example.com/preview"},
+		{Visitor{OS: "android", Device: "mobile"}, "https://play.google.com/store/apps/details?id=app"},
+		{Visitor{OS: "android", Device: "tablet"}, "https://example.com/app"},
+		{Visitor{OS: "android", Device: "tablet", Country: "AT"}, "https://example.com/de/app"},
+		{Visitor{OS: "ios", Device: "mobile", Country: "AT"}, "https://apps.apple.com/app/id1"},
+		{Visitor{}, "https://example.com/app"},
+	} {
+		if got := url.Destination(tc.visitor); got != tc.want {
+			t.Errorf("%+v: got %s, want %s", tc.visitor, got, tc.want)
+		}
+	}
+}
+
+func TestNormalizeRules(t *testing.T) {
+	got, err := NormalizeRules([]Rule{{OS: " iOS ", URL: "https://apps.apple.com/app/id1"}, {Countries: []string{"gb "}, URL: "https://a.com/uk"}})
+	if err != nil || got[0].OS != "ios" || got[1].Countries[0] != "GB" {
+		t.Errorf("got %+v, %v, want the os lowercased and the country uppercased", got, err)
+	}
+	for _, rules := range [][]Rule{
+		{{URL: "https://a.com"}},
+		{{OS: "ios"}},
+		{{OS: "symbian", URL: "https://a.com"}},
+		{{Device: "watch", URL: "https://a.com"}},
+		{{Countries: []string{"GBR"}, URL: "https://a.com"}},
+		{{Countries: []string{}, URL: "https://a.com"}},
+		make([]Rule, 21),
+	} {
+		if _, err := NormalizeRules(rules); err != ErrInvalidRules {
+			t.Errorf("%+v: got %v, want ErrInvalidRules", rules, err)
+		}
+	}
+	if got := VisitorFrom(WithVisitor(context.Background(), Visitor{OS: "linux"})); got.OS != "linux" {
+		t.Errorf("got %+v, want the visitor back from the context", got)
+	}
+}
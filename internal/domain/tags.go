@@ -0,0 +1,52 @@
+package domain
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+)
+
+const (
+	maxTags        = 20
+	maxTagLength   = 64
+	maxMetadataLen = 4 << 10
+)
+
+// NormalizeTags lowercases, sorts and dedupes tags so they compare and filter
+// the same everywhere. Commas are ruled out by the charset, CSV exports join
+// on them.
+func NormalizeTags(tags []string) ([]string, error) {
+	if tags == nil {
+		return nil, nil
+	}
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || len(tag) > maxTagLength {
+			return nil, ErrInvalidTags
+		}
+		for _, c := range tag {
+			if !('a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-' || c == '_' || c == ':' || c == '.') {
+				return nil, ErrInvalidTags
+			}
+		}
+		normalized = append(normalized, tag)
+	}
+	slices.Sort(normalized)
+	normalized = slices.Compact(normalized)
+	if len(normalized) > maxTags {
+		return nil, ErrInvalidTags
+	}
+	return normalized, nil
+}
+
+func ValidateMetadata(metadata map[string]any) error {
+	if metadata == nil {
+		return nil
+	}
+	data, err := json.Marshal(metadata)
+	if err != nil || len(data) > maxMetadataLen {
+		return ErrMetadataTooLarge
+	}
+	return nil
+}
@@ -0,0 +1,29 @@
+package domain
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeTags(t *testing.T) {
+	got, err := NormalizeTags([]string{" Spring-Sale ", "email", "spring-sale", "utm:q2"})
+	if err != nil || !slices.Equal(got, []string{"email", "spring-sale", "utm:q2"}) {
+		t.Errorf("got %v, %v, want sorted lowercase tags without repeats", got, err)
+	}
+	if got, err := NormalizeTags(nil); got != nil || err != nil {
+		t.Errorf("got %v, %v, want nil kept as nil", got, err)
+	}
+	for _, tags := range [][]string{{""}, {"a,b"}, {"with space"}, {strings.Repeat("x", 65)}} {
+		if _, err := NormalizeTags(tags); err != ErrInvalidTags {
+			t.Errorf("%q: got %v, want ErrInvalidTags", tags, err)
+		}
+	}
+	many := make([]string, 21)
+	for i := range many {
+		many[i] = strings.Repeat("t", i+1)
+	}
+	if _, err := NormalizeTags(many); err != ErrInvalidTags {
+		t.Errorf("got %v, want ErrInvalidTags past 20 tags", err)
+	}
+}
@@ -3,6 +3,8 @@ package domain
 import (
 	"context"
 	"errors"
+	"net/url"
+	"strings"
 	"time"
 )
 
@@ -12,6 +14,20 @@ var ErrRateLimitExceeded = errors.New("rate limit exceeded")
 var ErrInvalidURL = errors.New("invalid URL")
 var ErrInvalidScheme = errors.New("invalid host")
 var ErrURLAlreadyExists = errors.New("URL already exists")
+var ErrOriginalURLExists = errors.New("original URL already shortened")
+var ErrInvalidAlias = errors.New("invalid alias")
+var ErrAliasTaken = errors.New("alias already taken")
+var ErrInvalidExpiry = errors.New("expiry must be in the future")
+var ErrBatchTooLarge = errors.New("too many URLs in batch")
+var ErrInvalidTags = errors.New("tags must be 1 to 64 of a-z, 0-9, -, _, : or ., at most 20 per link")
+var ErrMetadataTooLarge = errors.New("metadata must be at most 4KB of JSON")
+var ErrInvalidPassword = errors.New("password must be 4 to 128 characters")
+var ErrWrongPassword = errors.New("wrong password")
+var ErrURLExhausted = errors.New("URL click limit reached")
+var ErrInvalidMaxClicks = errors.New("max_clicks must not be negative")
+var ErrURLNotActive = errors.New("URL not active yet")
+var ErrInvalidActivation = errors.New("activates_at must be before expires_at")
+var ErrInvalidRules = errors.New("rules need a known os, device, country or bot condition and a url, at most 20")
 
 type URL struct {
 	ID          int64     `json:"id"`
@@ -19,6 +35,108 @@ type URL struct {
 	ShortURL    string    `json:"short_code"`
 	CreatedAt   time.Time `json:"created_at"`
 	ExpiresAt   time.Time `json:"expires_at,omitempty"`
+	Owner       string    `json:"owner,omitempty"`
+	// Sorted and lowercase, see NormalizeTags
+	Tags     []string       `json:"tags,omitempty"`
+	Metadata map[string]any `json:"metadata,omitempty"`
+	// Empty for public links, see passcode.Hash
+	PasswordHash string `json:"-"`
+	// Uses before the link stops resolving, 0 for unlimited. Clicks only
+	// counts uses of limited links.
+	MaxClicks int64 `json:"max_clicks,omitempty"`
+	Clicks    int64 `json:"clicks,omitempty"`
+	// Zero for links that are live from the start. Until then visitors are
+	// sent to FallbackURL, or a coming soon page when it's empty.
+	ActivatesAt time.Time `json:"activates_at,omitzero"`
+	FallbackURL string    `json:"fallback_url,omitempty"`
+	// Per visitor destinations, see Rule
+	Rules []Rule `json:"rules,omitempty"`
+}
+
+// Protected links prompt for a password instead of redirecting
+func (u *URL) Protected() bool {
+	return u.PasswordHash != ""
+}
+
+func (u *URL) Limited() bool {
+	return u.MaxClicks > 0
+}
+
+// Exhausted is a hint from however fresh u is, only URLStore.UseClick decides
+func (u *URL) Exhausted() bool {
+	return u.Limited() && u.Clicks >= u.MaxClicks
+}
+
+// Scheduled links haven't gone live at now
+func (u *URL) Scheduled(now time.Time) bool {
+	return u.ActivatesAt.After(now)
+}
+
+// Targeted links send visitors to different places
+func (u *URL) Targeted() bool {
+	return len(u.Rules) > 0
+}
+
+// Where v goes, the first rule v matches or OriginalURL
+func (u *URL) Destination(v Visitor) string {
+	for _, rule := range u.Rules {
+		if rule.Matches(v) {
+			return rule.URL
+		}
+	}
+	return u.OriginalURL
+}
+
+// Links handed to one audience are never given out again to someone who
+// shortens the same URL, neither a password, a click budget, a launch time
+// nor targeting rules are shared. Tags and metadata describe one campaign's
+// link, so a tagged shorten gets a link of its own too. Owned links are
+// listed by their owner and never handed to anyone else.
+func (u *URL) Dedupes() bool {
+	return u.Owner == "" && !u.Protected() && !u.Limited() && u.ActivatesAt.IsZero() && !u.Targeted() &&
+		len(u.Tags) == 0 && len(u.Metadata) == 0
+}
+
+// ReapedURL is a link the reaper removed. Deduped reports whether it still
+// held its place in the dedupe index, only those links are in the bloom
+// filter.
+type ReapedURL struct {
+	*URL
+	Deduped bool
+}
+
+// URLUpdate changes the descriptive fields of a link. Nil leaves a field as
+// it is, an empty value clears it.
+type URLUpdate struct {
+	Tags     []string       `json:"tags"`
+	Metadata map[string]any `json:"metadata"`
+}
+
+// Paths the mux serves itself, a link with one of these codes would never resolve
+var reservedCodes = map[string]bool{"api": true, "debug": true, "health": true, "shorten": true}
+
+func ReservedCode(code string) bool {
+	return reservedCodes[code]
+}
+
+// CanonicalURL normalises the parts of a URL that don't change where it
+// points, so trivially different spellings dedupe to the same link
+func CanonicalURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return raw
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	if port := u.Port(); (u.Scheme == "https" && port == "443") || (u.Scheme == "http" && port == "80") {
+		u.Host = u.Hostname()
+	}
+	if u.Path == "" {
+		u.Path = "/"
+	}
+	u.Fragment = ""
+	u.RawFragment = ""
+	return u.String()
 }
 
 type URLStore interface {
@@ -26,17 +144,105 @@ type URLStore interface {
 	GetByShortURL(ctx context.Context, code string) (*URL, error)
 	GetByOriginalURL(ctx context.Context, originalURL string) (*URL, error)
 	GetMaxID(ctx context.Context) (int64, error)
+	// Newest first, at most filter.Limit links
+	ListURLs(ctx context.Context, filter ListFilter) ([]*URL, error)
+	// ErrURLNotFound when no link has the code, expired links included
+	UpdateURL(ctx context.Context, code string, update URLUpdate) (*URL, error)
+	// Counts one use of a limited link, atomically across every caller.
+	// ErrURLExhausted once Clicks has reached MaxClicks.
+	UseClick(ctx context.Context, code string) error
+}
+
+type ExpiryStatus string
+
+const (
+	StatusAny     ExpiryStatus = ""
+	StatusLive    ExpiryStatus = "live"
+	StatusExpired ExpiryStatus = "expired"
+)
+
+// ListFilter narrows a listing, zero values match everything
+type ListFilter struct {
+	// Cursor, only links with a lower id
+	Before      int64
+	Owner       string
+	CreatedFrom time.Time
+	CreatedTo   time.Time
+	Status      ExpiryStatus
+	// Destination host, exact and case-insensitive
+	Domain string
+	// Case-insensitive substring of the destination
+	Search string
+	// Links carrying every one of these
+	Tags  []string
+	Limit int
+}
+
+// URLHost is the lowercased host a link points at, the same value the stores
+// filter on for ListFilter.Domain
+func URLHost(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
+}
+
+// Stores that can insert many links in one round trip. errs[i] is the
+// outcome for urls[i], err fails the whole batch.
+type URLBatchStore interface {
+	CreateURLs(ctx context.Context, urls []*URL) (errs []error, err error)
+}
+
+// Stores that can stream every link, expired ones included, oldest first
+type URLExporter interface {
+	EachURL(ctx context.Context, fn func(url *URL) error) error
+}
+
+type primaryKey struct{}
+
+// WithPrimary marks reads that must observe the caller's own writes, stores
+// backed by replicas serve them from the primary
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryKey{}, true)
+}
+
+func ReadsPrimary(ctx context.Context) bool {
+	primary, _ := ctx.Value(primaryKey{}).(bool)
+	return primary
 }
 
 type URLCache interface {
 	Get(ctx context.Context, key string) (*URL, error)
-	Set(ctx context.Context, key string, value *URL) error
+	// ttl <= 0 uses the cache default, entries never outlive value.ExpiresAt
+	Set(ctx context.Context, key string, value *URL, ttl time.Duration) error
+	Delete(ctx context.Context, keys ...string) error
 	SetCounter(ctx context.Context, key string, value int64) error
 	Allow(ctx context.Context, key string, limit int, window time.Duration) error
 	Increment(ctx context.Context, key string) (int64, error)
+	// Adds delta to the countdown at key, first setting it to start when it
+	// is missing. ttl only applies when the countdown is created.
+	Countdown(ctx context.Context, key string, start, delta int64, ttl time.Duration) (int64, error)
 }
 
 type Bloom interface {
 	Add(item string)
 	Contains(item string) bool
 }
+
+// Filters that can forget items, e.g. links that expired or were deleted
+type RemovableBloom interface {
+	Bloom
+	Remove(item string)
+}
+
+type BloomStats struct {
+	Layers            int     `json:"layers"`
+	FillRatio         float64 `json:"fill_ratio"`
+	FalsePositiveRate float64 `json:"false_positive_rate"`
+}
+
+// Filters that can report how saturated they are
+type BloomReporter interface {
+	Stats() BloomStats
+}
@@ -0,0 +1,22 @@
+package domain
+
+import "testing"
+
+func TestCanonicalURL(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"https://google.com", "https://google.com/"},
+		{"HTTPS://Google.COM/Search?q=Go", "https://google.com/Search?q=Go"},
+		{"https://google.com:443/a", "https://google.com/a"},
+		{"http://google.com:80/a", "http://google.com/a"},
+		{"http://google.com:8080/a", "http://google.com:8080/a"},
+		{"https://google.com/a#section", "https://google.com/a"},
+	}
+	for _, tt := range tests {
+		if got := CanonicalURL(tt.in); got != tt.want {
+			t.Errorf("CanonicalURL(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
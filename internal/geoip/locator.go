@@ -0,0 +1,78 @@
+package geoip
+
+import (
+	"context"
+	"log/slog"
+	"net/netip"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// Locator answers country lookups from the database at path and reloads it
+// when the file is replaced. Until a database loads every lookup answers "".
+type Locator struct {
+	path   string
+	logger *slog.Logger
+	db     atomic.Pointer[Database]
+	// Size and modification time of the file last tried, loaded or not
+	seen    os.FileInfo
+	missing bool
+}
+
+// NewLocator loads path once. A missing or broken file is logged rather than
+// returned, Run picks it up once it's fixed.
+func NewLocator(path string, logger *slog.Logger) *Locator {
+	l := &Locator{path: path, logger: logger}
+	l.Reload()
+	return l
+}
+
+func (l *Locator) Country(ip netip.Addr) string {
+	db := l.db.Load()
+	if db == nil || !ip.IsValid() {
+		return ""
+	}
+	return db.Country(ip)
+}
+
+// Reload loads the file if it changed since the last attempt and reports
+// whether a new database is in use. A file that fails to load leaves the
+// previous database serving. Calls must not overlap, lookups may.
+func (l *Locator) Reload() bool {
+	info, err := os.Stat(l.path)
+	if err != nil {
+		if !l.missing {
+			l.logger.Warn("GeoIP database unavailable", "path", l.path, "error", err)
+		}
+		l.seen, l.missing = nil, true
+		return false
+	}
+	l.missing = false
+	if l.seen != nil && info.ModTime().Equal(l.seen.ModTime()) && info.Size() == l.seen.Size() {
+		return false
+	}
+	l.seen = info
+	db, err := Load(l.path)
+	if err != nil {
+		l.logger.Error("GeoIP database failed to load", "path", l.path, "error", err)
+		return false
+	}
+	l.db.Store(db)
+	l.logger.Info("GeoIP database loaded", "path", l.path, "nodes", db.nodeCount)
+	return true
+}
+
+// Run checks the file every interval until ctx is done
+func (l *Locator) Run(ctx context.Context, every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			l.Reload()
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package geoip
+
+import (
+	"io"
+	"log/slog"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLocator_Reload(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	path := filepath.Join(t.TempDir(), "country.mmdb")
+	ip := netip.MustParseAddr("81.2.69.142")
+
+	l := NewLocator(path, logger)
+	if got := l.Country(ip); got != "" {
+		t.Errorf("got %q, want no country without a database", got)
+	}
+
+	// Replaced the way deploys do it, written aside and renamed over
+	replace := func(buf []byte, modTime time.Time) {
+		tmp := path + ".tmp"
+		if err := os.WriteFile(tmp, buf, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		os.Chtimes(tmp, modTime, modTime)
+		if err := os.Rename(tmp, path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	now := time.Now()
+	replace(buildDatabase(t, 24, map[string]string{"81.2.69.0/24": "GB"}), now)
+	if !l.Reload() || l.Country(ip) != "GB" {
+		t.Fatalf("got %q, want the new database picked up", l.Country(ip))
+	}
+	if l.Reload() {
+		t.Error("got a reload, want an unchanged file left alone")
+	}
+
+	replace([]byte("half written"), now.Add(time.Second))
+	if l.Reload() || l.Country(ip) != "GB" {
+		t.Errorf("got %q, want the previous database kept over a broken file", l.Country(ip))
+	}
+
+	replace(buildDatabase(t, 28, map[string]string{"81.2.69.0/24": "IE"}), now.Add(2*time.Second))
+	if !l.Reload() || l.Country(ip) != "IE" {
+		t.Errorf("got %q, want the fixed database picked up", l.Country(ip))
+	}
+}
@@ -0,0 +1,315 @@
+// Package geoip maps client addresses to countries with a local MaxMind DB
+// (MMDB) file such as GeoLite2-Country. Only what a country lookup needs is
+// implemented: the search tree and enough of the data section to read the
+// country record.
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"net/netip"
+	"os"
+)
+
+var ErrInvalidDatabase = errors.New("invalid MaxMind database")
+
+var metadataMarker = []byte("\xAB\xCD\xEFMaxMind.com")
+
+// The 16 zero bytes between the search tree and the data section
+const dataSeparator = 16
+
+// Pointers are followed at most this deep, a corrupt file can't loop forever
+const maxDepth = 32
+
+// Database is a parsed MMDB file, safe for concurrent lookups
+type Database struct {
+	tree       []byte
+	data       []byte
+	nodeCount  uint
+	recordSize uint
+	ipVersion  uint
+	ipv4Start  uint
+}
+
+func Load(path string) (*Database, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(buf)
+}
+
+func Parse(buf []byte) (*Database, error) {
+	at := bytes.LastIndex(buf, metadataMarker)
+	if at < 0 {
+		return nil, ErrInvalidDatabase
+	}
+	meta, _, err := decoder{buf[at+len(metadataMarker):]}.decode(0, 0)
+	if err != nil {
+		return nil, err
+	}
+	fields, ok := meta.(map[string]any)
+	if !ok {
+		return nil, ErrInvalidDatabase
+	}
+	db := &Database{
+		nodeCount:  metadataUint(fields["node_count"]),
+		recordSize: metadataUint(fields["record_size"]),
+		ipVersion:  metadataUint(fields["ip_version"]),
+	}
+	if db.recordSize != 24 && db.recordSize != 28 && db.recordSize != 32 || db.ipVersion != 4 && db.ipVersion != 6 {
+		return nil, ErrInvalidDatabase
+	}
+	treeSize := db.nodeCount * db.recordSize / 4
+	if treeSize+dataSeparator > uint(at) {
+		return nil, ErrInvalidDatabase
+	}
+	db.tree, db.data = buf[:treeSize], buf[treeSize+dataSeparator:at]
+
+	// IPv4 addresses live under ::/96 in an IPv6 tree
+	if db.ipVersion == 6 {
+		for i := 0; i < 96 && db.ipv4Start < db.nodeCount; i++ {
+			db.ipv4Start = db.record(db.ipv4Start, 0)
+		}
+	}
+	return db, nil
+}
+
+func metadataUint(v any) uint {
+	n, _ := v.(uint64)
+	return uint(n)
+}
+
+// Country returns the ISO 3166 code of the country ip is in, "" when the
+// database doesn't know
+func (db *Database) Country(ip netip.Addr) string {
+	record, err := db.Lookup(ip)
+	if err != nil {
+		return ""
+	}
+	fields, _ := record.(map[string]any)
+	for _, key := range []string{"country", "registered_country"} {
+		country, _ := fields[key].(map[string]any)
+		if code, ok := country["iso_code"].(string); ok {
+			return code
+		}
+	}
+	return ""
+}
+
+// Lookup returns the decoded record for ip, nil when there is none. Maps
+// decode to map[string]any, arrays to []any and unsigned integers to uint64.
+func (db *Database) Lookup(ip netip.Addr) (any, error) {
+	ip = ip.Unmap()
+	var addr []byte
+	node := uint(0)
+	switch {
+	case ip.Is4():
+		a := ip.As4()
+		addr, node = a[:], db.ipv4Start
+	case ip.Is6() && db.ipVersion == 6:
+		a := ip.As16()
+		addr = a[:]
+	default:
+		return nil, nil
+	}
+	for i := 0; i < len(addr)*8 && node < db.nodeCount; i++ {
+		node = db.record(node, uint(addr[i/8]>>(7-i%8)&1))
+	}
+	if node <= db.nodeCount {
+		return nil, nil
+	}
+	offset := node - db.nodeCount - dataSeparator
+	if offset >= uint(len(db.data)) {
+		return nil, ErrInvalidDatabase
+	}
+	value, _, err := decoder{db.data}.decode(offset, 0)
+	return value, err
+}
+
+// The left (bit 0) or right (bit 1) record of node
+func (db *Database) record(node, bit uint) uint {
+	b := db.tree[node*db.recordSize/4:]
+	switch db.recordSize {
+	case 24:
+		b = b[bit*3:]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	case 28:
+		// The middle byte holds the high nibble of both records
+		if bit == 0 {
+			return uint(b[3]&0xF0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3]&0x0F)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	default:
+		return uint(binary.BigEndian.Uint32(b[bit*4:]))
+	}
+}
+
+// Data section types
+const (
+	typeExtended = iota
+	typePointer
+	typeString
+	typeDouble
+	typeBytes
+	typeUint16
+	typeUint32
+	typeMap
+	typeInt32
+	typeUint64
+	typeUint128
+	typeArray
+	typeContainer
+	typeEndMarker
+	typeBool
+	typeFloat
+)
+
+type decoder struct {
+	buf []byte
+}
+
+// Decodes the value at offset and returns it with the offset just past it
+func (d decoder) decode(offset uint, depth int) (any, uint, error) {
+	if depth > maxDepth {
+		return nil, 0, ErrInvalidDatabase
+	}
+	kind, size, offset, err := d.control(offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	if kind == typePointer {
+		target, next, err := d.pointer(size, offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		value, _, err := d.decode(target, depth+1)
+		return value, next, err
+	}
+	end := offset + size
+	switch kind {
+	case typeMap:
+		m := make(map[string]any, size)
+		for range size {
+			key, next, err := d.decode(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			name, ok := key.(string)
+			if !ok {
+				return nil, 0, ErrInvalidDatabase
+			}
+			if m[name], offset, err = d.decode(next, depth+1); err != nil {
+				return nil, 0, err
+			}
+		}
+		return m, offset, nil
+	case typeArray:
+		a := make([]any, size)
+		for i := range a {
+			if a[i], offset, err = d.decode(offset, depth+1); err != nil {
+				return nil, 0, err
+			}
+		}
+		return a, offset, nil
+	case typeBool:
+		return size != 0, offset, nil
+	}
+	if end > uint(len(d.buf)) {
+		return nil, 0, ErrInvalidDatabase
+	}
+	raw := d.buf[offset:end]
+	switch kind {
+	case typeString:
+		return string(raw), end, nil
+	case typeBytes, typeUint128:
+		return raw, end, nil
+	case typeDouble:
+		if size != 8 {
+			return nil, 0, ErrInvalidDatabase
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(raw)), end, nil
+	case typeFloat:
+		if size != 4 {
+			return nil, 0, ErrInvalidDatabase
+		}
+		return math.Float32frombits(binary.BigEndian.Uint32(raw)), end, nil
+	case typeUint16, typeUint32, typeUint64, typeInt32:
+		if size > 8 {
+			return nil, 0, ErrInvalidDatabase
+		}
+		var n uint64
+		for _, b := range raw {
+			n = n<<8 | uint64(b)
+		}
+		if kind == typeInt32 {
+			return int32(n), end, nil
+		}
+		return n, end, nil
+	}
+	return nil, 0, ErrInvalidDatabase
+}
+
+// Reads a control byte and its extensions, returning the type, the payload
+// size and where the payload starts. For pointers size holds the control
+// byte's low five bits.
+func (d decoder) control(offset uint) (int, uint, uint, error) {
+	if offset >= uint(len(d.buf)) {
+		return 0, 0, 0, ErrInvalidDatabase
+	}
+	ctrl := d.buf[offset]
+	offset++
+	kind := int(ctrl >> 5)
+	if kind == typeExtended {
+		if offset >= uint(len(d.buf)) {
+			return 0, 0, 0, ErrInvalidDatabase
+		}
+		kind = 7 + int(d.buf[offset])
+		offset++
+	}
+	size := uint(ctrl & 0x1F)
+	if kind == typePointer || size < 29 {
+		return kind, size, offset, nil
+	}
+	extra := size - 28
+	if offset+extra > uint(len(d.buf)) {
+		return 0, 0, 0, ErrInvalidDatabase
+	}
+	var n uint
+	for _, b := range d.buf[offset : offset+extra] {
+		n = n<<8 | uint(b)
+	}
+	switch extra {
+	case 1:
+		size = 29 + n
+	case 2:
+		size = 285 + n
+	default:
+		size = 65821 + n
+	}
+	return kind, size, offset + extra, nil
+}
+
+// Pointer targets are offsets into the data section, bits holds the size
+// and high value bits from the control byte
+func (d decoder) pointer(bits, offset uint) (uint, uint, error) {
+	length := bits>>3&0x3 + 1
+	if offset+length > uint(len(d.buf)) {
+		return 0, 0, ErrInvalidDatabase
+	}
+	var n uint
+	for _, b := range d.buf[offset : offset+length] {
+		n = n<<8 | uint(b)
+	}
+	switch length {
+	case 1:
+		n |= (bits & 0x7) << 8
+	case 2:
+		n = (bits&0x7)<<16 | n + 2048
+	case 3:
+		n = (bits&0x7)<<24 | n + 526336
+	}
+	return n, offset + length, nil
+}
@@ -0,0 +1,132 @@
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net/netip"
+	"testing"
+)
+
+// Builds an IPv6 tree like GeoLite2-Country's, IPv4 networks under ::/96.
+// Record keys point at one shared "iso_code" string to exercise pointers.
+func buildDatabase(t *testing.T, recordSize int, networks map[string]string) []byte {
+	t.Helper()
+	data := encodeString("iso_code")
+	offsets := make(map[string]int)
+	for _, country := range networks {
+		if _, ok := offsets[country]; ok {
+			continue
+		}
+		offsets[country] = len(data)
+		data = append(data, 0xE1)
+		data = append(data, encodeString("country")...)
+		data = append(data, 0xE1, 0x20, 0x00)
+		data = append(data, encodeString(country)...)
+	}
+
+	// 0 is an empty record, the root is never anyone's child. Data records
+	// are stored negated.
+	nodes := [][2]int{{}}
+	for network, country := range networks {
+		prefix := netip.MustParsePrefix(network)
+		addr, bits := prefix.Addr().As16(), prefix.Bits()
+		if prefix.Addr().Is4() {
+			addr, bits = [16]byte{}, 96+bits
+			copy(addr[12:], prefix.Addr().AsSlice())
+		}
+		node := 0
+		for i := range bits {
+			bit := addr[i/8] >> (7 - i%8) & 1
+			if i == bits-1 {
+				nodes[node][bit] = -(offsets[country] + 1)
+				break
+			}
+			if nodes[node][bit] == 0 {
+				nodes = append(nodes, [2]int{})
+				nodes[node][bit] = len(nodes) - 1
+			}
+			node = nodes[node][bit]
+		}
+	}
+
+	count := len(nodes)
+	value := func(r int) uint32 {
+		switch {
+		case r == 0:
+			return uint32(count)
+		case r < 0:
+			return uint32(count + dataSeparator - r - 1)
+		}
+		return uint32(r)
+	}
+	var buf []byte
+	for _, node := range nodes {
+		left, right := value(node[0]), value(node[1])
+		switch recordSize {
+		case 24:
+			buf = append(buf, byte(left>>16), byte(left>>8), byte(left), byte(right>>16), byte(right>>8), byte(right))
+		case 28:
+			buf = append(buf, byte(left>>16), byte(left>>8), byte(left), byte(left>>24)<<4|byte(right>>24), byte(right>>16), byte(right>>8), byte(right))
+		case 32:
+			buf = binary.BigEndian.AppendUint32(buf, left)
+			buf = binary.BigEndian.AppendUint32(buf, right)
+		}
+	}
+	buf = append(buf, make([]byte, dataSeparator)...)
+	buf = append(buf, data...)
+	buf = append(buf, metadataMarker...)
+	buf = append(buf, 0xE3)
+	buf = append(buf, encodeString("node_count")...)
+	buf = append(buf, 0xC4)
+	buf = binary.BigEndian.AppendUint32(buf, uint32(count))
+	buf = append(buf, encodeString("record_size")...)
+	buf = append(buf, 0xA1, byte(recordSize))
+	buf = append(buf, encodeString("ip_version")...)
+	buf = append(buf, 0xA1, 6)
+	return buf
+}
+
+func encodeString(s string) []byte {
+	return append([]byte{0x40 | byte(len(s))}, s...)
+}
+
+func TestDatabase_Country(t *testing.T) {
+	networks := map[string]string{"81.2.69.0/24": "GB", "175.16.199.0/24": "CN", "2a02::/16": "DE"}
+	for _, size := range []int{24, 28, 32} {
+		db, err := Parse(buildDatabase(t, size, networks))
+		if err != nil {
+			t.Fatalf("record size %d: got %v, want the database parsed", size, err)
+		}
+		for ip, want := range map[string]string{
+			"81.2.69.142":        "GB",
+			"::ffff:81.2.69.142": "GB",
+			"175.16.199.5":       "CN",
+			"2a02:1::1":          "DE",
+			"8.8.8.8":            "",
+			"2001:db8::1":        "",
+		} {
+			if got := db.Country(netip.MustParseAddr(ip)); got != want {
+				t.Errorf("record size %d, %s: got %q, want %q", size, ip, got, want)
+			}
+		}
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	patched := func(key string, value ...byte) []byte {
+		buf := buildDatabase(t, 24, map[string]string{"81.2.69.0/24": "GB"})
+		at := bytes.LastIndex(buf, []byte(key)) + len(key) + 1
+		copy(buf[at:], value)
+		return buf
+	}
+	for name, buf := range map[string][]byte{
+		"no metadata":        []byte("not a database"),
+		"bad metadata":       append(append([]byte{}, metadataMarker...), 0xE1, 0x41),
+		"record size":        patched("record_size", 20),
+		"tree past the data": patched("node_count", 0, 1, 0, 0),
+	} {
+		if _, err := Parse(buf); err != ErrInvalidDatabase {
+			t.Errorf("%s: got %v, want ErrInvalidDatabase", name, err)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+// Package passcode hashes link passwords and signs the cookies that remember
+// a visitor already entered one.
+package passcode
+
+import (
+	"crypto/hmac"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	scheme  = "pbkdf2-sha256"
+	saltLen = 16
+	keyLen  = 32
+)
+
+// OWASP's 2023 figure for PBKDF2-HMAC-SHA256. Stored hashes carry their own
+// count, so raising it only affects new passwords.
+const defaultIterations = 600_000
+
+var iterations = defaultIterations
+
+// Counts an imported hash may carry. Fewer weakens the hash, more turns every
+// unlock attempt into a CPU burn.
+const (
+	minIterations = 100_000
+	maxIterations = 10 * defaultIterations
+)
+
+var encoding = base64.RawStdEncoding
+
+// Hash returns "pbkdf2-sha256$<iterations>$<salt>$<key>" for password
+func Hash(password string) (string, error) {
+	salt := make([]byte, saltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key, err := pbkdf2.Key(sha256.New, password, salt, iterations, keyLen)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s$%d$%s$%s", scheme, iterations, encoding.EncodeToString(salt), encoding.EncodeToString(key)), nil
+}
+
+// Verify reports whether password matches an encoded hash from Hash
+func Verify(encoded, password string) bool {
+	iter, salt, want, ok := parse(encoded)
+	if !ok {
+		return false
+	}
+	got, err := pbkdf2.Key(sha256.New, password, salt, iter, len(want))
+	return err == nil && subtle.ConstantTimeCompare(got, want) == 1
+}
+
+// Valid reports whether encoded is a hash Verify can check with an iteration
+// count in the accepted range, for imports
+func Valid(encoded string) bool {
+	iter, _, _, ok := parse(encoded)
+	return ok && iter >= minIterations
+}
+
+func parse(encoded string) (iter int, salt, key []byte, ok bool) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 4 || parts[0] != scheme {
+		return 0, nil, nil, false
+	}
+	iter, err := strconv.Atoi(parts[1])
+	if err != nil || iter < 1 || iter > maxIterations {
+		return 0, nil, nil, false
+	}
+	if salt, err = encoding.DecodeString(parts[2]); err != nil {
+		return 0, nil, nil, false
+	}
+	if key, err = encoding.DecodeString(parts[3]); err != nil || len(key) == 0 {
+		return 0, nil, nil, false
+	}
+	return iter, salt, key, true
+}
+
+// Signer issues cookie values proving a visitor unlocked a link. A value is
+// bound to the code and the password hash, so changing the password locks
+// everyone out again.
+type Signer struct {
+	key []byte
+}
+
+func NewSigner(key []byte) *Signer {
+	return &Signer{key: key}
+}
+
+// NewRandomSigner signs with a fresh key, cookies don't survive a restart or
+// work across replicas
+func NewRandomSigner() *Signer {
+	key := make([]byte, 32)
+	rand.Read(key)
+	return NewSigner(key)
+}
+
+func (s *Signer) Sign(code, passwordHash string, expires time.Time) string {
+	msg := binary.BigEndian.AppendUint64(nil, uint64(expires.Unix()))
+	return base64.RawURLEncoding.EncodeToString(append(msg, s.mac(msg, code, passwordHash)...))
+}
+
+func (s *Signer) Check(value, code, passwordHash string, now time.Time) bool {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil || len(data) != 8+sha256.Size {
+		return false
+	}
+	msg, sum := data[:8], data[8:]
+	if !hmac.Equal(sum, s.mac(msg, code, passwordHash)) {
+		return false
+	}
+	return now.Unix() < int64(binary.BigEndian.Uint64(msg))
+}
+
+func (s *Signer) mac(msg []byte, code, passwordHash string) []byte {
+	h := hmac.New(sha256.New, s.key)
+	h.Write(msg)
+	h.Write([]byte(code))
+	h.Write([]byte{0})
+	h.Write([]byte(passwordHash))
+	return h.Sum(nil)
+}
@@ -0,0 +1,53 @@
+package passcode
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHashVerify(t *testing.T) {
+	iterations = 1000
+	hash, err := Hash("open sesame")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.HasPrefix(hash, "pbkdf2-sha256$1000$") {
+		t.Errorf("got %q, want an encoded pbkdf2 hash", hash)
+	}
+	if !Verify(hash, "open sesame") || Verify(hash, "open sesame ") {
+		t.Errorf("want only the exact password accepted")
+	}
+	again, _ := Hash("open sesame")
+	if again == hash {
+		t.Errorf("want a fresh salt per hash")
+	}
+	for _, bad := range []string{"", "plain", "bcrypt$1$a$b", "pbkdf2-sha256$x$a$b", "pbkdf2-sha256$10$!!$b", "pbkdf2-sha256$2000000000$c2FsdA$a2V5"} {
+		if Valid(bad) || Verify(bad, "") {
+			t.Errorf("%q: want rejected", bad)
+		}
+	}
+	// Imports must carry a count between 100k and 10x the default
+	if !Valid("pbkdf2-sha256$600000$c2FsdA$a2V5") || Valid(hash) || Valid("pbkdf2-sha256$6000001$c2FsdA$a2V5") {
+		t.Errorf("want only hashes with a sane iteration count valid")
+	}
+}
+
+func TestSigner(t *testing.T) {
+	signer := NewSigner([]byte("secret"))
+	now := time.Now()
+	value := signer.Sign("abc", "hash1", now.Add(time.Hour))
+
+	if !signer.Check(value, "abc", "hash1", now) {
+		t.Errorf("want a fresh cookie accepted")
+	}
+	if signer.Check(value, "abd", "hash1", now) || signer.Check(value, "abc", "hash2", now) {
+		t.Errorf("want the cookie bound to the code and password")
+	}
+	if signer.Check(value, "abc", "hash1", now.Add(2*time.Hour)) {
+		t.Errorf("want an expired cookie rejected")
+	}
+	if NewSigner([]byte("other")).Check(value, "abc", "hash1", now) || signer.Check(value[1:], "abc", "hash1", now) {
+		t.Errorf("want forged or damaged cookies rejected")
+	}
+}
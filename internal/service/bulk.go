@@ -0,0 +1,184 @@
+package service
+
+import (
+	"context"
+	"goprl/internal/domain"
+	"time"
+)
+
+type BulkItem struct {
+	URL       string    `json:"url"`
+	Alias     string    `json:"alias,omitempty"`
+	ExpiresAt time.Time `json:"expires_at,omitempty"`
+	LinkOptions
+}
+
+// Exactly one of URL and Err is set, except for an alias whose URL already
+// has a link: Err is ErrOriginalURLExists and URL is that link
+type BulkResult struct {
+	URL *domain.URL
+	Err error
+}
+
+type bulkPending struct {
+	index   int
+	url     *domain.URL
+	counter int64
+	alias   bool
+}
+
+// ShortenBulk applies Shorten to every item, inserting the new links in one
+// batch where the store supports it. Failures are reported per item and
+// never fail the rest of the batch.
+func (s *URLService) ShortenBulk(ctx context.Context, items []BulkItem) []BulkResult {
+	results := make([]BulkResult, len(items))
+	now := time.Now()
+	// Repeats of a URL share the first occurrence's result
+	first := make(map[string]int)
+	repeats := make(map[int]int)
+	// Codes claimed so far, aliases and generated alike
+	codes := make(map[string]bool)
+	var pending []bulkPending
+
+	for i, item := range items {
+		validURL, err := validateUrl(item.URL)
+		if err != nil {
+			results[i].Err = domain.ErrInvalidURL
+			continue
+		}
+		expiresAt := item.ExpiresAt
+		if expiresAt.IsZero() {
+			expiresAt = item.defaultExpiry(now)
+		} else if !expiresAt.After(now) {
+			results[i].Err = domain.ErrInvalidExpiry
+			continue
+		}
+		url := &domain.URL{OriginalURL: validURL, CreatedAt: now, ExpiresAt: expiresAt}
+		if err := item.apply(url); err != nil {
+			results[i].Err = err
+			continue
+		}
+
+		if item.Alias != "" {
+			if err := validateAlias(item.Alias); err != nil {
+				results[i].Err = err
+				continue
+			}
+			if codes[item.Alias] {
+				results[i].Err = domain.ErrAliasTaken
+				continue
+			}
+			codes[item.Alias] = true
+			url.ShortURL = item.Alias
+			pending = append(pending, bulkPending{index: i, url: url, alias: true})
+			continue
+		}
+
+		if url.Dedupes() {
+			key := domain.CanonicalURL(validURL)
+			if j, ok := first[key]; ok {
+				repeats[i] = j
+				continue
+			}
+			first[key] = i
+			if existing := s.existing(ctx, validURL); existing != nil {
+				results[i].URL = existing
+				continue
+			}
+		}
+		counter, err := s.nextCode(ctx, codes)
+		if err != nil {
+			results[i].Err = err
+			continue
+		}
+		url.ShortURL = generateBase62(counter)
+		codes[url.ShortURL] = true
+		pending = append(pending, bulkPending{index: i, url: url, counter: counter})
+	}
+
+	urls := make([]*domain.URL, len(pending))
+	for k, p := range pending {
+		urls[k] = p.url
+	}
+	errs, err := s.createAll(ctx, urls)
+	for k, p := range pending {
+		if err != nil {
+			results[p.index].Err = err
+			continue
+		}
+		results[p.index] = s.settleBulk(ctx, p, errs[k])
+	}
+
+	for i, j := range repeats {
+		results[i] = results[j]
+	}
+	for i := range results {
+		if results[i].URL != nil {
+			url := *results[i].URL
+			url.ShortURL = s.baseURL + "/" + url.ShortURL
+			results[i].URL = &url
+		}
+	}
+	return results
+}
+
+// Skips counter values whose code an earlier alias in the batch claimed
+func (s *URLService) nextCode(ctx context.Context, codes map[string]bool) (int64, error) {
+	for {
+		counter, err := s.cache.Increment(ctx, "counter")
+		if err != nil || !codes[generateBase62(counter)] {
+			return counter, err
+		}
+	}
+}
+
+func (s *URLService) createAll(ctx context.Context, urls []*domain.URL) ([]error, error) {
+	if len(urls) == 0 {
+		return nil, nil
+	}
+	if batch, ok := s.store.(domain.URLBatchStore); ok {
+		return batch.CreateURLs(ctx, urls)
+	}
+	errs := make([]error, len(urls))
+	for i, url := range urls {
+		errs[i] = s.store.CreateURL(ctx, url)
+	}
+	return errs, nil
+}
+
+// Generated codes settle like Shorten, retrying collisions one by one. An
+// alias is never swapped for another code.
+func (s *URLService) settleBulk(ctx context.Context, p bulkPending, err error) BulkResult {
+	if !p.alias {
+		if err := s.settle(ctx, p.url, p.counter, err); err != nil {
+			return BulkResult{Err: err}
+		}
+		return BulkResult{URL: p.url}
+	}
+	switch err {
+	case nil:
+		s.remember(*p.url)
+		return BulkResult{URL: p.url}
+	case domain.ErrURLAlreadyExists:
+		return BulkResult{Err: domain.ErrAliasTaken}
+	case domain.ErrOriginalURLExists:
+		existing, lookupErr := s.store.GetByOriginalURL(domain.WithPrimary(ctx), p.url.OriginalURL)
+		if lookupErr != nil {
+			return BulkResult{Err: lookupErr}
+		}
+		return BulkResult{URL: existing, Err: err}
+	}
+	return BulkResult{Err: err}
+}
+
+func validateAlias(alias string) error {
+	if len(alias) < 3 || len(alias) > 64 || domain.ReservedCode(alias) {
+		return domain.ErrInvalidAlias
+	}
+	for _, c := range alias {
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '-' || c == '_') {
+			return domain.ErrInvalidAlias
+		}
+	}
+	return nil
+}
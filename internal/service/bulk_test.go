@@ -0,0 +1,94 @@
+package service
+
+import (
+	"context"
+	"goprl/internal/domain"
+	"goprl/internal/store/memory"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func TestShortenBulk(t *testing.T) {
+	ctx := context.Background()
+	store := memory.NewStore()
+	cache := memory.NewCache(time.Hour, 100)
+	bloom := &mockBloom{data: make(map[string]bool)}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	svc := NewURLService(store, cache, bloom, logger, mockBaseURL)
+
+	existing, err := svc.Shorten(ctx, "https://taken.com")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// The code an alias is about to take must not stall the counter later
+	store.CreateURL(ctx, &domain.URL{ShortURL: "3", OriginalURL: "https://squatter.com", ExpiresAt: time.Now().Add(time.Hour)})
+
+	expiry := time.Now().Add(48 * time.Hour).Truncate(time.Second)
+	results := svc.ShortenBulk(ctx, []BulkItem{
+		{URL: "https://a.com"},
+		{URL: "not a url"},
+		{URL: "https://b.com", Alias: "spring-sale", ExpiresAt: expiry},
+		{URL: "https://c.com", Alias: "spring-sale"},
+		{URL: "https://A.com/"},
+		{URL: "https://d.com", ExpiresAt: time.Now().Add(-time.Hour)},
+		{URL: "https://taken.com", Alias: "other"},
+		{URL: "https://e.com", Alias: "health"},
+		{URL: "https://f.com"},
+	})
+
+	want := []error{nil, domain.ErrInvalidURL, nil, domain.ErrAliasTaken, nil, domain.ErrInvalidExpiry, domain.ErrOriginalURLExists, domain.ErrInvalidAlias, nil}
+	for i, result := range results {
+		if result.Err != want[i] {
+			t.Errorf("item %d: got %v, want %v", i, result.Err, want[i])
+		}
+	}
+
+	if results[2].URL.ShortURL != mockBaseURL+"/spring-sale" || !results[2].URL.ExpiresAt.Equal(expiry) {
+		t.Errorf("got %+v, want the alias with its expiry", results[2].URL)
+	}
+	if results[4].URL.ShortURL != results[0].URL.ShortURL {
+		t.Errorf("got %s, want the repeat to share %s", results[4].URL.ShortURL, results[0].URL.ShortURL)
+	}
+	if results[6].URL == nil || results[6].URL.ShortURL != existing.ShortURL {
+		t.Errorf("got %+v, want the existing link %s reported", results[6].URL, existing.ShortURL)
+	}
+	if results[8].URL.ShortURL == mockBaseURL+"/3" {
+		t.Errorf("got %s, want the taken code skipped", results[8].URL.ShortURL)
+	}
+	if _, err := store.GetByShortURL(ctx, "spring-sale"); err != nil {
+		t.Errorf("got %v, want the alias stored", err)
+	}
+}
+
+func TestShortenBulk_AliasMatchesGeneratedCode(t *testing.T) {
+	ctx := context.Background()
+	store := memory.NewStore()
+	cache := memory.NewCache(time.Hour, 100)
+	bloom := &mockBloom{data: make(map[string]bool)}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	svc := NewURLService(store, cache, bloom, logger, mockBaseURL)
+
+	// The next counter values encode to 101, 102 and 103
+	cache.SetCounter(ctx, "counter", 3844)
+	results := svc.ShortenBulk(ctx, []BulkItem{
+		{URL: "https://a.com", Alias: "101"},
+		{URL: "https://b.com"},
+		{URL: "https://c.com"},
+		{URL: "https://d.com", Alias: "103"},
+	})
+
+	want := []error{nil, nil, nil, domain.ErrAliasTaken}
+	for i, result := range results {
+		if result.Err != want[i] {
+			t.Errorf("item %d: got %v, want %v", i, result.Err, want[i])
+		}
+	}
+	if results[1].URL.ShortURL != mockBaseURL+"/102" {
+		t.Errorf("got %s, want the aliased code skipped", results[1].URL.ShortURL)
+	}
+	if results[0].URL.ID == results[1].URL.ID || results[1].URL.ID == results[2].URL.ID {
+		t.Errorf("got ids %d, %d and %d, want one link each", results[0].URL.ID, results[1].URL.ID, results[2].URL.ID)
+	}
+}
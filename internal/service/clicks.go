@@ -0,0 +1,38 @@
+package service
+
+import (
+	"context"
+	"goprl/internal/domain"
+	"time"
+)
+
+func clicksKey(code string) string {
+	return "clicks:" + code
+}
+
+// Visit counts one use of a limited link and does nothing for the rest. The
+// cache holds a countdown of uses left that turns clicks on a spent link away
+// without touching the store. Every click it lets through is confirmed by
+// the store, which has the final say however many replicas are clicking.
+func (s *URLService) Visit(ctx context.Context, url *domain.URL) error {
+	if !url.Limited() {
+		return nil
+	}
+	// url may be stale, but clicks only go up so the seed is never too low
+	key, start, ttl := clicksKey(url.ShortURL), url.MaxClicks-url.Clicks, time.Until(url.ExpiresAt)
+	left, err := s.cache.Countdown(ctx, key, start, -1, ttl)
+	if err != nil {
+		s.logger.Warn("Click countdown unavailable, counting in the store only", "code", url.ShortURL, "error", err)
+	} else if left < 0 {
+		return domain.ErrURLExhausted
+	}
+
+	storeErr := s.store.UseClick(ctx, url.ShortURL)
+	if storeErr != nil && storeErr != domain.ErrURLExhausted && err == nil {
+		// The click never happened, hand the use back
+		if _, err := s.cache.Countdown(ctx, key, start, 1, ttl); err != nil {
+			s.logger.Error("Failed to release click", "code", url.ShortURL, "error", err)
+		}
+	}
+	return storeErr
+}
@@ -0,0 +1,80 @@
+package service
+
+import (
+	"context"
+	"goprl/internal/domain"
+	"goprl/internal/store/memory"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Two replicas with their own caches share one store, the store keeps the
+// total exact
+func TestVisit_ConcurrentReplicas(t *testing.T) {
+	ctx := context.Background()
+	store := memory.NewStore()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	replicas := []*URLService{
+		NewURLService(store, memory.NewCache(time.Hour, 10), &mockBloom{data: make(map[string]bool)}, logger, mockBaseURL),
+		NewURLService(store, memory.NewCache(time.Hour, 10), &mockBloom{data: make(map[string]bool)}, logger, mockBaseURL),
+	}
+	url, err := replicas[0].ShortenWith(ctx, "https://invite.example.com", LinkOptions{MaxClicks: 10})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	code := strings.TrimPrefix(url.ShortURL, mockBaseURL+"/")
+
+	var ok, gone atomic.Int64
+	var wg sync.WaitGroup
+	for i := range 40 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := replicas[i%2].Resolve(ctx, code)
+			switch err {
+			case nil:
+				ok.Add(1)
+			case domain.ErrURLExhausted:
+				gone.Add(1)
+			default:
+				t.Errorf("unexpected error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if ok.Load() != 10 || gone.Load() != 30 {
+		t.Errorf("got %d resolved and %d gone, want 10 and 30", ok.Load(), gone.Load())
+	}
+	if _, err := replicas[1].Resolve(ctx, code); err != domain.ErrURLExhausted {
+		t.Errorf("got %v, want the link to stay exhausted", err)
+	}
+}
+
+func TestVisit_StoreDecides(t *testing.T) {
+	ctx := context.Background()
+	store := memory.NewStore()
+	store.CreateURL(ctx, &domain.URL{ShortURL: "once", OriginalURL: "https://a.com", ExpiresAt: time.Now().Add(time.Hour), MaxClicks: 1})
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	svc := NewURLService(store, memory.NewCache(time.Hour, 10), &mockBloom{data: make(map[string]bool)}, logger, mockBaseURL)
+
+	// A stale copy claims uses are left, the store still turns the click away
+	stale := &domain.URL{ShortURL: "once", OriginalURL: "https://a.com", ExpiresAt: time.Now().Add(time.Hour), MaxClicks: 1}
+	if err := svc.Visit(ctx, stale); err != nil {
+		t.Fatalf("got %v, want the first click counted", err)
+	}
+	other := NewURLService(store, memory.NewCache(time.Hour, 10), &mockBloom{data: make(map[string]bool)}, logger, mockBaseURL)
+	if err := other.Visit(ctx, stale); err != domain.ErrURLExhausted {
+		t.Errorf("got %v, want ErrURLExhausted from the store", err)
+	}
+	if err := svc.Visit(ctx, &domain.URL{ShortURL: "pub", OriginalURL: "https://b.com"}); err != nil {
+		t.Errorf("got %v, want unlimited links left alone", err)
+	}
+	if _, err := svc.ShortenWith(ctx, "https://c.com", LinkOptions{MaxClicks: -1}); err != domain.ErrInvalidMaxClicks {
+		t.Errorf("got %v, want ErrInvalidMaxClicks", err)
+	}
+}
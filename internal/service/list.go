@@ -0,0 +1,43 @@
+package service
+
+import (
+	"context"
+	"goprl/internal/domain"
+)
+
+const (
+	defaultListLimit = 50
+	maxListLimit     = 500
+)
+
+type ListPage struct {
+	URLs []*domain.URL
+	// Pass as filter.Before for the next page, 0 on the last page
+	NextCursor int64
+}
+
+// List returns one page of links, newest first
+func (s *URLService) List(ctx context.Context, filter domain.ListFilter) (*ListPage, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = defaultListLimit
+	}
+	filter.Limit = min(filter.Limit, maxListLimit)
+	limit := filter.Limit
+	// One extra row tells whether another page exists
+	filter.Limit++
+	urls, err := s.store.ListURLs(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	page := &ListPage{URLs: urls}
+	if len(urls) > limit {
+		page.URLs = urls[:limit]
+		page.NextCursor = page.URLs[limit-1].ID
+	}
+	return page, nil
+}
+
+// Link is the public short link for code
+func (s *URLService) Link(code string) string {
+	return s.baseURL + "/" + code
+}
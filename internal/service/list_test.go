@@ -0,0 +1,48 @@
+package service
+
+import (
+	"context"
+	"goprl/internal/domain"
+	"goprl/internal/store/memory"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func TestList_Pages(t *testing.T) {
+	ctx := context.Background()
+	store := memory.NewStore()
+	for _, code := range []string{"a", "b", "c", "d", "e"} {
+		store.CreateURL(ctx, &domain.URL{ShortURL: code, OriginalURL: "https://" + code + ".com", ExpiresAt: time.Now().Add(time.Hour)})
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	svc := NewURLService(store, memory.NewCache(time.Hour, 10), &mockBloom{data: make(map[string]bool)}, logger, mockBaseURL)
+
+	var got string
+	var pages int
+	filter := domain.ListFilter{Limit: 2}
+	for {
+		page, err := svc.List(ctx, filter)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		pages++
+		for _, url := range page.URLs {
+			got += url.ShortURL
+		}
+		if page.NextCursor == 0 {
+			break
+		}
+		filter.Before = page.NextCursor
+	}
+	if got != "edcba" || pages != 3 {
+		t.Errorf("got %q over %d pages, want edcba over 3", got, pages)
+	}
+
+	// A full last page must not promise another one
+	page, _ := svc.List(ctx, domain.ListFilter{Limit: 5})
+	if len(page.URLs) != 5 || page.NextCursor != 0 {
+		t.Errorf("got %d links and cursor %d, want 5 and no cursor", len(page.URLs), page.NextCursor)
+	}
+}
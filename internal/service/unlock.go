@@ -0,0 +1,43 @@
+package service
+
+import (
+	"context"
+	"goprl/internal/domain"
+	"goprl/internal/passcode"
+	"time"
+)
+
+// Password attempts per link per minute, across all visitors
+const defaultUnlockLimit = 5
+
+// WithUnlockLimit sets how many password attempts a link takes per minute
+func (s *URLService) WithUnlockLimit(limit int) *URLService {
+	if limit > 0 {
+		s.unlockLimit = limit
+	}
+	return s
+}
+
+// Unlock resolves a protected link given its password. Attempts are limited
+// per code rather than per visitor, so guessing from many addresses doesn't
+// go any faster. Public links resolve whatever the password. Like Resolve,
+// a link before its launch comes back along with ErrURLNotActive.
+func (s *URLService) Unlock(ctx context.Context, code, password string) (*domain.URL, error) {
+	if err := s.cache.Allow(ctx, "unlock:"+code, s.unlockLimit, time.Minute); err == domain.ErrRateLimitExceeded {
+		return nil, err
+	}
+	url, err := s.lookup(ctx, code)
+	if err == domain.ErrURLNotActive {
+		return url, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	if url.Protected() && !passcode.Verify(url.PasswordHash, password) {
+		return nil, domain.ErrWrongPassword
+	}
+	if err := s.Visit(ctx, url); err != nil {
+		return nil, err
+	}
+	return s.route(ctx, url), nil
+}
@@ -0,0 +1,46 @@
+package service
+
+import (
+	"context"
+	"goprl/internal/domain"
+	"goprl/internal/store/memory"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUnlock(t *testing.T) {
+	ctx := context.Background()
+	store := memory.NewStore()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	svc := NewURLService(store, memory.NewCache(time.Hour, 10), &mockBloom{data: make(map[string]bool)}, logger, mockBaseURL).
+		WithUnlockLimit(3)
+
+	public, _ := svc.Shorten(ctx, "https://docs.example.com")
+	url, err := svc.ShortenWith(ctx, "https://docs.example.com", LinkOptions{Password: "hunter22"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if url.ShortURL == public.ShortURL || url.PasswordHash == "" || strings.Contains(url.PasswordHash, "hunter22") {
+		t.Fatalf("got %+v, want a new link with a hashed password", url)
+	}
+	code := strings.TrimPrefix(url.ShortURL, mockBaseURL+"/")
+
+	if _, err := svc.Unlock(ctx, code, "wrong"); err != domain.ErrWrongPassword {
+		t.Errorf("got %v, want ErrWrongPassword", err)
+	}
+	got, err := svc.Unlock(ctx, code, "hunter22")
+	if err != nil || got.OriginalURL != "https://docs.example.com" {
+		t.Errorf("got %+v, %v, want the link unlocked", got, err)
+	}
+	svc.Unlock(ctx, code, "wrong")
+	if _, err := svc.Unlock(ctx, code, "hunter22"); err != domain.ErrRateLimitExceeded {
+		t.Errorf("got %v, want attempts limited per code", err)
+	}
+
+	if _, err := svc.ShortenWith(ctx, "https://a.com", LinkOptions{Password: "abc"}); err != domain.ErrInvalidPassword {
+		t.Errorf("got %v, want ErrInvalidPassword", err)
+	}
+}
@@ -4,96 +4,299 @@ import (
 	"context"
 	"errors"
 	"goprl/internal/domain"
+	"goprl/internal/passcode"
 	"log/slog"
 	"net/url"
+	"slices"
 	"strings"
 	"time"
 
 	"golang.org/x/net/publicsuffix"
 )
 
+// Lifetime of a link created without an explicit expiry
+const defaultTTL = 24 * time.Hour
+
 type URLService struct {
-	store   domain.URLStore
-	cache   domain.URLCache
-	bloom   domain.Bloom
-	logger  *slog.Logger
-	baseURL string
+	store       domain.URLStore
+	cache       domain.URLCache
+	bloom       domain.Bloom
+	logger      *slog.Logger
+	baseURL     string
+	unlockLimit int
+	countries   domain.CountryLocator
 }
 
 // URL service factory
 func NewURLService(store domain.URLStore, cache domain.URLCache, bloom domain.Bloom, logger *slog.Logger, baseURL string) *URLService {
 	return &URLService{
-		store:   store,
-		cache:   cache,
-		bloom:   bloom,
-		logger:  logger,
-		baseURL: baseURL,
+		store:       store,
+		cache:       cache,
+		bloom:       bloom,
+		logger:      logger,
+		baseURL:     baseURL,
+		unlockLimit: defaultUnlockLimit,
+	}
+}
+
+// Optional settings for a new link
+type LinkOptions struct {
+	Tags     []string       `json:"tags,omitempty"`
+	Metadata map[string]any `json:"metadata,omitempty"`
+	// Visitors are prompted for it before being redirected
+	Password string `json:"password,omitempty"`
+	// Uses before the link stops resolving, 0 for unlimited
+	MaxClicks int64 `json:"max_clicks,omitempty"`
+	// Launch time, visitors arriving earlier are sent to FallbackURL or get a
+	// coming soon page
+	ActivatesAt time.Time `json:"activates_at,omitzero"`
+	FallbackURL string    `json:"fallback_url,omitempty"`
+	// Per visitor destinations, tried in order before OriginalURL
+	Rules []domain.Rule `json:"rules,omitempty"`
+	// Set from the caller's credentials, never from the request body
+	Owner string `json:"-"`
+}
+
+// Expiry for a link created without one. Scheduled links get their full
+// lifetime from the launch.
+func (o LinkOptions) defaultExpiry(now time.Time) time.Time {
+	if o.ActivatesAt.After(now) {
+		return o.ActivatesAt.Add(defaultTTL)
+	}
+	return now.Add(defaultTTL)
+}
+
+func (o LinkOptions) apply(url *domain.URL) error {
+	tags, err := domain.NormalizeTags(o.Tags)
+	if err != nil {
+		return err
+	}
+	if err := domain.ValidateMetadata(o.Metadata); err != nil {
+		return err
+	}
+	if o.MaxClicks < 0 {
+		return domain.ErrInvalidMaxClicks
+	}
+	url.MaxClicks = o.MaxClicks
+	// A launch time already passed makes an ordinary link
+	if o.ActivatesAt.After(time.Now()) {
+		if !o.ActivatesAt.Before(url.ExpiresAt) {
+			return domain.ErrInvalidActivation
+		}
+		url.ActivatesAt = o.ActivatesAt
+	}
+	if o.FallbackURL != "" {
+		if url.FallbackURL, err = validateUrl(o.FallbackURL); err != nil {
+			return domain.ErrInvalidURL
+		}
+	}
+	if url.Rules, err = domain.NormalizeRules(o.Rules); err != nil {
+		return err
+	}
+	for i, rule := range url.Rules {
+		if url.Rules[i].URL, err = validateUrl(rule.URL); err != nil {
+			return domain.ErrInvalidRules
+		}
+	}
+	if o.Password != "" {
+		if len(o.Password) < 4 || len(o.Password) > 128 {
+			return domain.ErrInvalidPassword
+		}
+		if url.PasswordHash, err = passcode.Hash(o.Password); err != nil {
+			return err
+		}
 	}
+	url.Tags, url.Metadata, url.Owner = tags, o.Metadata, o.Owner
+	return nil
 }
 
 func (s *URLService) Shorten(ctx context.Context, originalURL string) (*domain.URL, error) {
+	return s.ShortenWith(ctx, originalURL, LinkOptions{})
+}
+
+// ShortenWith is Shorten with options for the new link. A URL that already
+// has a live link gets that link back unchanged, Update retags it. Owned,
+// tagged, protected, limited, scheduled and targeted links are always new, so
+// no option is ever dropped, see domain.URL.Dedupes.
+func (s *URLService) ShortenWith(ctx context.Context, originalURL string, opts LinkOptions) (*domain.URL, error) {
 	validURL, err := validateUrl(originalURL)
 	if err != nil {
 		return nil, err
 	}
-	if s.bloom.Contains(validURL) {
-		url, err := s.cache.Get(ctx, validURL)
-		if err == nil && url != nil {
-			s.logger.Info("Bloom filter cache hit", "url", validURL)
-			url.ShortURL = s.baseURL + "/" + url.ShortURL
-			return url, nil
-		}
-		url, err = s.store.GetByOriginalURL(ctx, validURL)
-		if err == nil && url != nil {
-			s.logger.Info("Bloom filter store hit", "url", validURL)
-			_ = s.cache.Set(ctx, validURL, url)
+	url := &domain.URL{
+		OriginalURL: validURL,
+		CreatedAt:   time.Now(),
+		ExpiresAt:   opts.defaultExpiry(time.Now()),
+	}
+	if err := opts.apply(url); err != nil {
+		return nil, err
+	}
+	if url.Dedupes() {
+		if url := s.existing(ctx, validURL); url != nil {
 			url.ShortURL = s.baseURL + "/" + url.ShortURL
 			return url, nil
 		}
 	}
-	var url *domain.URL
-	var shortURL string
-	counter, _ := s.cache.Increment(ctx, "counter")
-	shortURL = generateBase62(counter)
-	url = &domain.URL{
-		OriginalURL: validURL,
-		ShortURL:    shortURL,
-		CreatedAt:   time.Now(),
-		ExpiresAt:   time.Now().Add(24 * time.Hour),
+	if err := s.create(ctx, url); err != nil {
+		return nil, err
 	}
 
-	if err := s.store.CreateURL(ctx, url); err != nil {
-		if err == domain.ErrURLAlreadyExists {
-			s.logger.Warn("Collision detected, resyncing counter", "code", url.ShortURL)
-			maxID, err := s.store.GetMaxID(ctx)
-			if err != nil {
-				return nil, err
-			}
+	// Apply baseURL to shortURL for handler
+	url.ShortURL = s.baseURL + "/" + url.ShortURL
+	return url, nil
+}
+
+// The live link already issued for validURL, nil when there is none
+func (s *URLService) existing(ctx context.Context, validURL string) *domain.URL {
+	if !s.bloom.Contains(validURL) {
+		return nil
+	}
+	url, err := s.cache.Get(ctx, validURL)
+	if err == nil && url != nil {
+		s.logger.Info("Bloom filter cache hit", "url", validURL)
+		return url
+	}
+	url, err = s.store.GetByOriginalURL(ctx, validURL)
+	if err == nil && url != nil {
+		s.logger.Info("Bloom filter store hit", "url", validURL)
+		_ = s.cache.Set(ctx, url.ShortURL, url, 0)
+		_ = s.cache.Set(ctx, validURL, url, 0)
+		return url
+	}
+	return nil
+}
+
+// Issues the next code for url and stores it
+func (s *URLService) create(ctx context.Context, url *domain.URL) error {
+	counter, err := s.cache.Increment(ctx, "counter")
+	if err != nil {
+		// Without the counter every code collides and resyncs forever
+		return err
+	}
+	url.ShortURL = generateBase62(counter)
+	return s.settle(ctx, url, counter, s.store.CreateURL(ctx, url))
+}
+
+// Finishes a create given the store's answer, url ends up holding the link
+// the caller should hand out
+func (s *URLService) settle(ctx context.Context, url *domain.URL, counter int64, err error) error {
+	switch err {
+	case nil:
+		s.remember(*url)
+		return nil
+	case domain.ErrOriginalURLExists:
+		// Lost a race with a concurrent shorten of the same URL, hand back its
+		// code. The winner may not have reached the replicas yet.
+		existing, err := s.store.GetByOriginalURL(domain.WithPrimary(ctx), url.OriginalURL)
+		if err != nil {
+			return err
+		}
+		*url = *existing
+		return nil
+	case domain.ErrURLAlreadyExists:
+		s.logger.Warn("Collision detected, resyncing counter", "code", url.ShortURL)
+		maxID, err := s.store.GetMaxID(ctx)
+		if err != nil {
+			return err
+		}
+		// Only ever move the counter forward, a code taken by an alias ahead of
+		// the counter is simply skipped
+		if maxID > counter {
 			_ = s.cache.SetCounter(ctx, "counter", maxID)
-			return s.Shorten(ctx, originalURL)
 		}
-		return nil, err
+		return s.create(ctx, url)
 	}
+	return err
+}
 
-	// Set cache and bloom in background
-	go func(u domain.URL) {
+// Set cache and bloom in background. Links that don't dedupe are cached by
+// code only, they never answer a dedupe lookup.
+func (s *URLService) remember(u domain.URL) {
+	go func() {
 		bgCtx := context.Background()
-		if err := s.cache.Set(bgCtx, shortURL, &u); err != nil {
+		if err := s.cache.Set(bgCtx, u.ShortURL, &u, 0); err != nil {
 			s.logger.Error("Failed to set cache", "error", err)
 		}
+		if !u.Dedupes() {
+			return
+		}
 
-		if err := s.cache.Set(bgCtx, validURL, &u); err != nil {
+		if err := s.cache.Set(bgCtx, u.OriginalURL, &u, 0); err != nil {
 			s.logger.Error("Failed to set cache", "error", err)
 		}
-		s.bloom.Add(validURL)
-	}(*url)
+		s.bloom.Add(u.OriginalURL)
+	}()
+}
 
-	// Apply baseURL to shortURL for handler
-	url.ShortURL = s.baseURL + "/" + shortURL
+// Update changes the tags and metadata of the link with code
+func (s *URLService) Update(ctx context.Context, code string, update domain.URLUpdate) (*domain.URL, error) {
+	tags, err := domain.NormalizeTags(update.Tags)
+	if err != nil {
+		return nil, err
+	}
+	if err := domain.ValidateMetadata(update.Metadata); err != nil {
+		return nil, err
+	}
+	update.Tags = tags
+	url, err := s.store.UpdateURL(ctx, code, update)
+	if err != nil {
+		return nil, err
+	}
+	// Cached copies may carry the old values
+	if err := s.cache.Delete(ctx, code); err != nil {
+		s.logger.Error("Failed to invalidate cache", "code", code, "error", err)
+	}
 	return url, nil
 }
 
+// Resolve looks up a link for a visitor and counts the click against a
+// limited link. Protected links come back without using a click, Unlock or
+// Visit does that once the visitor is let through. A link before its launch
+// comes back along with ErrURLNotActive, so the caller can use its fallback.
+// The returned link's OriginalURL is where the visitor in ctx goes, see
+// domain.WithVisitor.
 func (s *URLService) Resolve(ctx context.Context, code string) (*domain.URL, error) {
+	url, err := s.lookup(ctx, code)
+	if err == domain.ErrURLNotActive {
+		return url, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !url.Protected() {
+		if err := s.Visit(ctx, url); err != nil {
+			return nil, err
+		}
+	}
+	return s.route(ctx, url), nil
+}
+
+// WithCountries sets how visitors' countries are found for country rules.
+// Without one country rules never match.
+func (s *URLService) WithCountries(locator domain.CountryLocator) *URLService {
+	s.countries = locator
+	return s
+}
+
+// A copy of url pointing at the destination its rules pick for the visitor
+// in ctx. url itself may be shared with the cache and is left alone.
+func (s *URLService) route(ctx context.Context, url *domain.URL) *domain.URL {
+	if !url.Targeted() {
+		return url
+	}
+	visitor := domain.VisitorFrom(ctx)
+	// Only links with country rules pay for the lookup
+	if visitor.Country == "" && s.countries != nil && slices.ContainsFunc(url.Rules, func(r domain.Rule) bool { return len(r.Countries) > 0 }) {
+		visitor.Country = s.countries.Country(visitor.IP)
+	}
+	routed := *url
+	routed.OriginalURL = url.Destination(visitor)
+	return &routed
+}
+
+// Links are cached whole and the launch time is checked on every read, so a
+// cached link goes live on time rather than when its entry expires
+func (s *URLService) lookup(ctx context.Context, code string) (*domain.URL, error) {
 	// Fast cache poke
 	url, err := s.cache.Get(ctx, code)
 	if err == nil && url != nil {
@@ -101,7 +304,13 @@ func (s *URLService) Resolve(ctx context.Context, code string) (*domain.URL, err
 			s.logger.Info("Cache hit but expired", "code", code)
 			return nil, domain.ErrURLExpired
 		}
+		if url.Exhausted() {
+			return nil, domain.ErrURLExhausted
+		}
 		s.logger.Info("Cache hit", "code", code)
+		if url.Scheduled(time.Now()) {
+			return url, domain.ErrURLNotActive
+		}
 		return url, nil
 	} else {
 		s.logger.Info("Cache miss", "code", code)
@@ -116,13 +325,19 @@ func (s *URLService) Resolve(ctx context.Context, code string) (*domain.URL, err
 	if url.ExpiresAt.Before(time.Now()) {
 		return nil, domain.ErrURLExpired
 	}
+	if url.Exhausted() {
+		return nil, domain.ErrURLExhausted
+	}
 
 	go func(u domain.URL) {
-		if err := s.cache.Set(context.Background(), code, &u); err != nil {
+		if err := s.cache.Set(context.Background(), code, &u, 0); err != nil {
 			s.logger.Error("Failed to set cache", "error", err)
 		}
 	}(*url)
 
+	if url.Scheduled(time.Now()) {
+		return url, domain.ErrURLNotActive
+	}
 	return url, nil
 }
 
@@ -150,7 +365,7 @@ func validateUrl(link string) (string, error) {
 	}
 	u, err := url.Parse(link)
 	if err != nil {
-		return "", err
+		return "", domain.ErrInvalidURL
 	}
 
 	host := u.Hostname()
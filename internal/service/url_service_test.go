@@ -4,8 +4,10 @@ import (
 	"context"
 	"errors"
 	"goprl/internal/domain"
+	"goprl/internal/store/memory"
 	"io"
 	"log/slog"
+	"net/netip"
 	"sync"
 	"testing"
 	"time"
@@ -37,6 +39,18 @@ func (m *mockStore) GetMaxID(ctx context.Context) (int64, error) {
 	return 0, m.err
 }
 
+func (m *mockStore) ListURLs(ctx context.Context, filter domain.ListFilter) ([]*domain.URL, error) {
+	return nil, m.err
+}
+
+func (m *mockStore) UpdateURL(ctx context.Context, code string, update domain.URLUpdate) (*domain.URL, error) {
+	return nil, m.err
+}
+
+func (m *mockStore) UseClick(ctx context.Context, code string) error {
+	return m.err
+}
+
 type mockCache struct {
 	mu        sync.RWMutex
 	data      map[string]*domain.URL
@@ -50,13 +64,17 @@ func (m *mockCache) Get(ctx context.Context, key string) (*domain.URL, error) {
 	return m.data[key], nil
 }
 
-func (m *mockCache) Set(ctx context.Context, key string, value *domain.URL) error {
+func (m *mockCache) Set(ctx context.Context, key string, value *domain.URL, ttl time.Duration) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	m.setCalled = true
 	return m.err
 }
 
+func (m *mockCache) Delete(ctx context.Context, keys ...string) error {
+	return m.err
+}
+
 func (m *mockCache) Allow(ctx context.Context, key string, limit int, window time.Duration) error {
 	return m.err
 }
@@ -69,6 +87,10 @@ func (m *mockCache) SetCounter(ctx context.Context, key string, value int64) err
 	return m.err
 }
 
+func (m *mockCache) Countdown(ctx context.Context, key string, start, delta int64, ttl time.Duration) (int64, error) {
+	return start + delta, m.err
+}
+
 type mockBloom struct {
 	mu   sync.RWMutex
 	data map[string]bool
@@ -335,3 +357,186 @@ func assertEventually(t *testing.T, condition func() bool, timeout time.Duration
 	}
 	t.Errorf("condition not met within %v", timeout)
 }
+
+type raceStore struct {
+	mockStore
+	existing *domain.URL
+}
+
+func (m *raceStore) CreateURL(ctx context.Context, url *domain.URL) error {
+	return domain.ErrOriginalURLExists
+}
+
+func (m *raceStore) GetByOriginalURL(ctx context.Context, originalURL string) (*domain.URL, error) {
+	return m.existing, nil
+}
+
+func TestShorten_ConcurrentDuplicate(t *testing.T) {
+	ctx := context.Background()
+
+	store := &raceStore{existing: &domain.URL{OriginalURL: "https://www.db.com", ShortURL: "abc"}}
+	cache := &mockCache{}
+	bloom := &mockBloom{data: make(map[string]bool)}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	svc := NewURLService(store, cache, bloom, logger, mockBaseURL)
+
+	url, err := svc.Shorten(ctx, "https://www.db.com")
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if url.ShortURL != mockBaseURL+"/abc" {
+		t.Errorf("expected shortened URL %s, got %s", mockBaseURL+"/abc", url.ShortURL)
+	}
+}
+
+func TestShortenWith_Tags(t *testing.T) {
+	ctx := context.Background()
+	store := memory.NewStore()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	svc := NewURLService(store, memory.NewCache(time.Hour, 10), &mockBloom{data: make(map[string]bool)}, logger, mockBaseURL)
+
+	url, err := svc.ShortenWith(ctx, "https://a.com", LinkOptions{Tags: []string{"Spring", "spring", "email"}, Metadata: map[string]any{"note": "hi"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	code := url.ShortURL[len(mockBaseURL)+1:]
+	stored, _ := store.GetByShortURL(ctx, code)
+	if len(stored.Tags) != 2 || stored.Tags[0] != "email" || stored.Metadata["note"] != "hi" {
+		t.Errorf("got %+v, want normalized tags and metadata stored", stored)
+	}
+	if _, err := svc.ShortenWith(ctx, "https://b.com", LinkOptions{Tags: []string{"a b"}}); err != domain.ErrInvalidTags {
+		t.Errorf("got %v, want ErrInvalidTags", err)
+	}
+
+	// A live public link doesn't swallow another campaign's tags
+	public, _ := svc.Shorten(ctx, "https://c.com")
+	tagged, err := svc.ShortenWith(ctx, "https://c.com", LinkOptions{Tags: []string{"spring"}})
+	if err != nil || tagged.ShortURL == public.ShortURL || len(tagged.Tags) != 1 {
+		t.Errorf("got %+v, %v, want a new tagged link next to %s", tagged, err, public.ShortURL)
+	}
+	if again, _ := svc.Shorten(ctx, "https://c.com"); again == nil || again.ShortURL != public.ShortURL {
+		t.Errorf("got %+v, want the public link still deduplicated", again)
+	}
+
+	updated, err := svc.Update(ctx, code, domain.URLUpdate{Tags: []string{"Q2"}})
+	if err != nil || len(updated.Tags) != 1 || updated.Tags[0] != "q2" || updated.Metadata["note"] != "hi" {
+		t.Errorf("got %+v, %v, want tags replaced and metadata kept", updated, err)
+	}
+}
+
+func TestResolve_Scheduled(t *testing.T) {
+	ctx := context.Background()
+	store := memory.NewStore()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	svc := NewURLService(store, memory.NewCache(time.Hour, 10), &mockBloom{data: make(map[string]bool)}, logger, mockBaseURL)
+
+	launch := time.Now().Add(200 * time.Millisecond)
+	url, err := svc.ShortenWith(ctx, "https://launch.example.com", LinkOptions{ActivatesAt: launch, FallbackURL: "example.com/teaser", MaxClicks: 1})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !url.ExpiresAt.Equal(launch.Add(defaultTTL)) {
+		t.Errorf("got expiry %v, want a full lifetime from the launch", url.ExpiresAt)
+	}
+	code := url.ShortURL[len(mockBaseURL)+1:]
+
+	// The second lookup is answered by the cache
+	for range 2 {
+		got, err := svc.Resolve(ctx, code)
+		if err != domain.ErrURLNotActive || got == nil || got.FallbackURL != "https://example.com/teaser" {
+			t.Fatalf("got %+v, %v, want ErrURLNotActive with the fallback", got, err)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	time.Sleep(time.Until(launch))
+	if _, err := svc.Resolve(ctx, code); err != nil {
+		t.Errorf("got %v, want the cached link live after the launch", err)
+	}
+	if _, err := svc.Resolve(ctx, code); err != domain.ErrURLExhausted {
+		t.Errorf("got %v, want visits before the launch left uncounted", err)
+	}
+}
+
+func TestShortenWith_InvalidActivation(t *testing.T) {
+	ctx := context.Background()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	svc := NewURLService(memory.NewStore(), memory.NewCache(time.Hour, 10), &mockBloom{data: make(map[string]bool)}, logger, mockBaseURL)
+
+	results := svc.ShortenBulk(ctx, []BulkItem{{
+		URL:         "https://launch.example.com",
+		ExpiresAt:   time.Now().Add(time.Hour),
+		LinkOptions: LinkOptions{ActivatesAt: time.Now().Add(2 * time.Hour)},
+	}})
+	if results[0].Err != domain.ErrInvalidActivation {
+		t.Errorf("got %v, want ErrInvalidActivation for a launch after expiry", results[0].Err)
+	}
+}
+
+func TestResolve_Rules(t *testing.T) {
+	ctx := context.Background()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	svc := NewURLService(memory.NewStore(), memory.NewCache(time.Hour, 10), &mockBloom{data: make(map[string]bool)}, logger, mockBaseURL)
+
+	url, err := svc.ShortenWith(ctx, "https://example.com/app", LinkOptions{Rules: []domain.Rule{
+		{OS: "iOS", URL: "apps.apple.com/app/id1"},
+		{OS: "android", URL: "https://play.google.com/store/apps/details?id=app"},
+	}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	code := url.ShortURL[len(mockBaseURL)+1:]
+
+	for _, tc := range []struct {
+		visitor domain.Visitor
+		want    string
+	}{
+		{domain.Visitor{OS: "ios", Device: "mobile"}, "https://apps.apple.com/app/id1"},
+		{domain.Visitor{OS: "android", Device: "tablet"}, "https://play.google.com/store/apps/details?id=app"},
+		{domain.Visitor{OS: "windows", Device: "desktop"}, "https://example.com/app"},
+	} {
+		got, err := svc.Resolve(domain.WithVisitor(ctx, tc.visitor), code)
+		if err != nil || got.OriginalURL != tc.want {
+			t.Errorf("%+v: got %+v, %v, want %s", tc.visitor, got, err, tc.want)
+		}
+	}
+	if again, err := svc.ShortenWith(ctx, "https://example.com/app", LinkOptions{}); err != nil || again.ShortURL == url.ShortURL {
+		t.Errorf("got %+v, %v, want a plain link kept apart from the targeted one", again, err)
+	}
+	if _, err := svc.ShortenWith(ctx, "https://example.com/app", LinkOptions{Rules: []domain.Rule{{OS: "ios"}}}); err != domain.ErrInvalidRules {
+		t.Errorf("got %v, want ErrInvalidRules for a rule without a destination", err)
+	}
+}
+
+type mockLocator map[netip.Addr]string
+
+func (m mockLocator) Country(ip netip.Addr) string {
+	return m[ip]
+}
+
+func TestResolve_CountryRules(t *testing.T) {
+	ctx := context.Background()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	store := memory.NewStore()
+	store.CreateURL(ctx, &domain.URL{ShortURL: "shop", OriginalURL: "https://example.com/shop", ExpiresAt: time.Now().Add(time.Hour), Rules: []domain.Rule{
+		{Countries: []string{"DE", "AT"}, URL: "https://example.com/de/shop"},
+	}})
+	uk, de := netip.MustParseAddr("81.2.69.142"), netip.MustParseAddr("5.9.0.1")
+	locator := mockLocator{uk: "GB", de: "DE"}
+
+	svc := NewURLService(store, memory.NewCache(time.Hour, 10), &mockBloom{data: make(map[string]bool)}, logger, mockBaseURL).WithCountries(locator)
+	for ip, want := range map[netip.Addr]string{de: "https://example.com/de/shop", uk: "https://example.com/shop"} {
+		got, err := svc.Resolve(domain.WithVisitor(ctx, domain.Visitor{IP: ip}), "shop")
+		if err != nil || got.OriginalURL != want {
+			t.Errorf("%s: got %+v, %v, want %s", ip, got, err, want)
+		}
+	}
+
+	// Without a database country rules never match
+	svc = NewURLService(store, memory.NewCache(time.Hour, 10), &mockBloom{data: make(map[string]bool)}, logger, mockBaseURL)
+	if got, err := svc.Resolve(domain.WithVisitor(ctx, domain.Visitor{IP: de}), "shop"); err != nil || got.OriginalURL != "https://example.com/shop" {
+		t.Errorf("got %+v, %v, want the default destination", got, err)
+	}
+}
@@ -1,50 +1,152 @@
 package store
 
 import (
-	"hash/fnv"
+	"encoding/binary"
+	"errors"
+	"goprl/internal/domain"
+	"goprl/internal/store/bloomhash"
+	"io"
+	"math"
+	"math/bits"
 	"sync"
 )
 
-// m size
+var ErrBloomSnapshot = errors.New("bloom snapshot does not match filter")
+
+// m size in bits
 // k hash number
 type BloomFilter struct {
 	mu     sync.RWMutex
-	bitset []bool
-	m      uint
-	k      uint
+	bitset []uint64
+	m      uint64
+	k      uint64
 }
 
 func NewBloomFilter(m uint, k uint) *BloomFilter {
+	m = max(m, 1)
 	return &BloomFilter{
-		bitset: make([]bool, m),
-		m:      m,
-		k:      k,
+		bitset: make([]uint64, (m+63)/64),
+		m:      uint64(m),
+		k:      uint64(max(k, 1)),
 	}
 }
 
+// Sizes the filter for n expected items at false positive rate p
+func NewBloomFilterWithEstimates(n uint, p float64) *BloomFilter {
+	m, k := EstimateParameters(n, p)
+	return NewBloomFilter(m, k)
+}
+
+// Panics unless 0 < p < 1
+func EstimateParameters(n uint, p float64) (uint, uint) {
+	return bloomhash.Estimate(n, p)
+}
+
 func (bf *BloomFilter) Add(item string) {
+	h1, h2 := bloomhash.Hash(item)
 	bf.mu.Lock()
 	defer bf.mu.Unlock()
-	for i := uint(0); i < bf.k; i++ {
-		index := hash(item, uint64(i)) % uint64(bf.m)
-		bf.bitset[index] = true
+	for i := uint64(0); i < bf.k; i++ {
+		index := bloomhash.Location(h1, h2, i, bf.m)
+		bf.bitset[index/64] |= 1 << (index % 64)
 	}
 }
 
 func (bf *BloomFilter) Contains(item string) bool {
+	h1, h2 := bloomhash.Hash(item)
 	bf.mu.RLock()
 	defer bf.mu.RUnlock()
-	for i := uint(0); i < bf.k; i++ {
-		index := hash(item, uint64(i)) % uint64(bf.m)
-		if !bf.bitset[index] {
+	for i := uint64(0); i < bf.k; i++ {
+		index := bloomhash.Location(h1, h2, i, bf.m)
+		if bf.bitset[index/64]&(1<<(index%64)) == 0 {
 			return false
 		}
 	}
 	return true
 }
 
-func hash(data string, seed uint64) uint64 {
-	h := fnv.New64a()
-	h.Write([]byte(data))
-	return h.Sum64() + seed
+func (bf *BloomFilter) Stats() domain.BloomStats {
+	bf.mu.RLock()
+	defer bf.mu.RUnlock()
+	fill := float64(popcount(bf.bitset)) / float64(bf.m)
+	return domain.BloomStats{
+		Layers:            1,
+		FillRatio:         fill,
+		FalsePositiveRate: math.Pow(fill, float64(bf.k)),
+	}
+}
+
+func popcount(words []uint64) int {
+	n := 0
+	for _, word := range words {
+		n += bits.OnesCount64(word)
+	}
+	return n
+}
+
+// Snapshot format: magic, version, m, k, then the words, little endian.
+// Each filter type has its own magic so snapshots can't be mixed up.
+var bloomMagic = [4]byte{'G', 'P', 'B', 'F'}
+
+// v1 snapshots were written with the old probe layout, see bloomhash.Location,
+// and are rejected so the filter is rebuilt
+const bloomSnapshotV2 uint32 = 2
+
+func (bf *BloomFilter) WriteTo(w io.Writer) (int64, error) {
+	bf.mu.RLock()
+	defer bf.mu.RUnlock()
+	return writeWords(w, bloomMagic, bf.m, bf.k, bf.bitset)
+}
+
+// ReadFrom merges a snapshot into the filter. Snapshots sized differently
+// are rejected so a sizing change takes effect through a rebuild.
+func (bf *BloomFilter) ReadFrom(r io.Reader) (int64, error) {
+	words, n, err := readWords(r, bloomMagic, bf.m, bf.k, len(bf.bitset))
+	if err != nil {
+		return n, err
+	}
+	bf.mu.Lock()
+	defer bf.mu.Unlock()
+	for i := range bf.bitset {
+		bf.bitset[i] |= words[i]
+	}
+	return n, nil
+}
+
+func writeWords(w io.Writer, magic [4]byte, m uint64, k uint64, words []uint64) (int64, error) {
+	buf := make([]byte, 0, 24+8*len(words))
+	buf = append(buf, magic[:]...)
+	buf = binary.LittleEndian.AppendUint32(buf, bloomSnapshotV2)
+	buf = binary.LittleEndian.AppendUint64(buf, m)
+	buf = binary.LittleEndian.AppendUint64(buf, k)
+	for _, word := range words {
+		buf = binary.LittleEndian.AppendUint64(buf, word)
+	}
+	n, err := w.Write(buf)
+	return int64(n), err
+}
+
+func readWords(r io.Reader, magic [4]byte, m uint64, k uint64, size int) ([]uint64, int64, error) {
+	header := make([]byte, 24)
+	n, err := io.ReadFull(r, header)
+	if err != nil {
+		return nil, int64(n), err
+	}
+	if [4]byte(header[:4]) != magic || binary.LittleEndian.Uint32(header[4:8]) != bloomSnapshotV2 {
+		return nil, int64(n), ErrBloomSnapshot
+	}
+	if binary.LittleEndian.Uint64(header[8:16]) != m || binary.LittleEndian.Uint64(header[16:24]) != k {
+		return nil, int64(n), ErrBloomSnapshot
+	}
+	body := make([]byte, 8*size)
+	read, err := io.ReadFull(r, body)
+	n += read
+	if err != nil {
+		return nil, int64(n), err
+	}
+	words := make([]uint64, size)
+	for i := range words {
+		words[i] = binary.LittleEndian.Uint64(body[i*8:])
+	}
+	return words, int64(n), nil
 }
@@ -0,0 +1,177 @@
+package store
+
+import (
+	"goprl/internal/domain"
+	"goprl/internal/store/bloomhash"
+	"io"
+	"math"
+	"sync"
+)
+
+// 4 bit counters, 16 to a word. A counter that reaches the max is pinned
+// there since its true count is no longer known, so it never causes a false
+// negative at the cost of that slot never clearing.
+const (
+	counterBits = 4
+	counterMax  = 1<<counterBits - 1
+	counterMask = uint64(counterMax)
+	perWord     = 64 / counterBits
+)
+
+var countingMagic = [4]byte{'G', 'P', 'C', 'B'}
+
+// Bloom filter that supports Remove, at 4x the memory of BloomFilter
+type CountingBloomFilter struct {
+	mu       sync.RWMutex
+	counters []uint64
+	// Fresh counters Rebuild is filling, nil otherwise
+	next []uint64
+	m    uint64
+	k    uint64
+}
+
+func NewCountingBloomFilter(m uint, k uint) *CountingBloomFilter {
+	m = max(m, 1)
+	return &CountingBloomFilter{
+		counters: make([]uint64, (m+perWord-1)/perWord),
+		m:        uint64(m),
+		k:        uint64(max(k, 1)),
+	}
+}
+
+func NewCountingBloomFilterWithEstimates(n uint, p float64) *CountingBloomFilter {
+	m, k := EstimateParameters(n, p)
+	return NewCountingBloomFilter(m, k)
+}
+
+func (cf *CountingBloomFilter) Add(item string) {
+	h1, h2 := bloomhash.Hash(item)
+	cf.mu.Lock()
+	defer cf.mu.Unlock()
+	cf.increment(cf.counters, h1, h2)
+	if cf.next != nil {
+		cf.increment(cf.next, h1, h2)
+	}
+}
+
+func (cf *CountingBloomFilter) Contains(item string) bool {
+	h1, h2 := bloomhash.Hash(item)
+	cf.mu.RLock()
+	defer cf.mu.RUnlock()
+	return cf.contains(h1, h2)
+}
+
+// Remove only forgets items the filter claims to hold, removing anything
+// else would decrement counters owned by other items
+func (cf *CountingBloomFilter) Remove(item string) {
+	h1, h2 := bloomhash.Hash(item)
+	cf.mu.Lock()
+	defer cf.mu.Unlock()
+	cf.decrement(cf.counters, h1, h2)
+	if cf.next != nil {
+		cf.decrement(cf.next, h1, h2)
+	}
+}
+
+// Rebuild recounts the filter from scratch. fill adds every live item through
+// add into fresh counters that replace the current ones once it succeeds, so
+// a restored snapshot is never counted twice. Lookups keep using the current
+// counters meanwhile and Add and Remove update both.
+func (cf *CountingBloomFilter) Rebuild(fill func(add func(item string)) error) error {
+	cf.mu.Lock()
+	cf.next = make([]uint64, len(cf.counters))
+	cf.mu.Unlock()
+	err := fill(func(item string) {
+		h1, h2 := bloomhash.Hash(item)
+		cf.mu.Lock()
+		defer cf.mu.Unlock()
+		cf.increment(cf.next, h1, h2)
+	})
+	cf.mu.Lock()
+	defer cf.mu.Unlock()
+	if err == nil {
+		cf.counters = cf.next
+	}
+	cf.next = nil
+	return err
+}
+
+func (cf *CountingBloomFilter) Stats() domain.BloomStats {
+	cf.mu.RLock()
+	defer cf.mu.RUnlock()
+	used := 0
+	for index := uint64(0); index < cf.m; index++ {
+		if counterAt(cf.counters, index) > 0 {
+			used++
+		}
+	}
+	fill := float64(used) / float64(cf.m)
+	return domain.BloomStats{
+		Layers:            1,
+		FillRatio:         fill,
+		FalsePositiveRate: math.Pow(fill, float64(cf.k)),
+	}
+}
+
+func (cf *CountingBloomFilter) WriteTo(w io.Writer) (int64, error) {
+	cf.mu.RLock()
+	defer cf.mu.RUnlock()
+	return writeWords(w, countingMagic, cf.m, cf.k, cf.counters)
+}
+
+// ReadFrom replaces the counters with the snapshot, restore before serving
+func (cf *CountingBloomFilter) ReadFrom(r io.Reader) (int64, error) {
+	words, n, err := readWords(r, countingMagic, cf.m, cf.k, len(cf.counters))
+	if err != nil {
+		return n, err
+	}
+	cf.mu.Lock()
+	defer cf.mu.Unlock()
+	cf.counters = words
+	return n, nil
+}
+
+func (cf *CountingBloomFilter) contains(h1 uint64, h2 uint64) bool {
+	return cf.holds(cf.counters, h1, h2)
+}
+
+func (cf *CountingBloomFilter) holds(counters []uint64, h1 uint64, h2 uint64) bool {
+	for i := uint64(0); i < cf.k; i++ {
+		if counterAt(counters, bloomhash.Location(h1, h2, i, cf.m)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (cf *CountingBloomFilter) increment(counters []uint64, h1 uint64, h2 uint64) {
+	for i := uint64(0); i < cf.k; i++ {
+		index := bloomhash.Location(h1, h2, i, cf.m)
+		if c := counterAt(counters, index); c < counterMax {
+			setCounter(counters, index, c+1)
+		}
+	}
+}
+
+func (cf *CountingBloomFilter) decrement(counters []uint64, h1 uint64, h2 uint64) {
+	if !cf.holds(counters, h1, h2) {
+		return
+	}
+	for i := uint64(0); i < cf.k; i++ {
+		index := bloomhash.Location(h1, h2, i, cf.m)
+		if c := counterAt(counters, index); c > 0 && c < counterMax {
+			setCounter(counters, index, c-1)
+		}
+	}
+}
+
+func counterAt(counters []uint64, index uint64) uint64 {
+	shift := (index % perWord) * counterBits
+	return (counters[index/perWord] >> shift) & counterMask
+}
+
+func setCounter(counters []uint64, index uint64, value uint64) {
+	shift := (index % perWord) * counterBits
+	word := &counters[index/perWord]
+	*word = *word&^(counterMask<<shift) | value<<shift
+}
@@ -0,0 +1,180 @@
+package store
+
+import (
+	"bytes"
+	"encoding/binary"
+	"goprl/internal/domain"
+	"io"
+	"math"
+	"sync"
+)
+
+// Scalable bloom filter (Almeida et al.). Once the newest layer holds its
+// capacity a new one is stacked on top with growth times the capacity and a
+// tightened false positive rate, so the overall rate stays under the target
+// however many links are added.
+const (
+	scalableGrowth     = 2
+	scalableTightening = 0.5
+)
+
+var scalableMagic = [4]byte{'G', 'P', 'S', 'B'}
+
+type scalableLayer struct {
+	filter   *BloomFilter
+	capacity uint64
+	count    uint64
+}
+
+type ScalableBloomFilter struct {
+	mu       sync.RWMutex
+	layers   []*scalableLayer
+	capacity uint64
+	p        float64
+}
+
+// Starts with room for n items and keeps the combined rate below p
+func NewScalableBloomFilter(n uint, p float64) *ScalableBloomFilter {
+	sf := &ScalableBloomFilter{
+		capacity: uint64(max(n, 1)),
+		p:        p,
+	}
+	sf.grow()
+	return sf
+}
+
+// Caller must hold mu. The rate series p0 * r^i sums to p when p0 = p * (1-r).
+func (sf *ScalableBloomFilter) grow() {
+	i := len(sf.layers)
+	capacity := sf.capacity * uint64(math.Pow(scalableGrowth, float64(i)))
+	p := sf.p * (1 - scalableTightening) * math.Pow(scalableTightening, float64(i))
+	sf.layers = append(sf.layers, &scalableLayer{
+		filter:   NewBloomFilterWithEstimates(uint(capacity), p),
+		capacity: capacity,
+	})
+}
+
+func (sf *ScalableBloomFilter) Add(item string) {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	// Re-adding a known item would only eat into layer capacity
+	for _, layer := range sf.layers {
+		if layer.filter.Contains(item) {
+			return
+		}
+	}
+	top := sf.layers[len(sf.layers)-1]
+	if top.count >= top.capacity {
+		sf.grow()
+		top = sf.layers[len(sf.layers)-1]
+	}
+	top.filter.Add(item)
+	top.count++
+}
+
+func (sf *ScalableBloomFilter) Contains(item string) bool {
+	sf.mu.RLock()
+	defer sf.mu.RUnlock()
+	for _, layer := range sf.layers {
+		if layer.filter.Contains(item) {
+			return true
+		}
+	}
+	return false
+}
+
+// Fill ratio is across all layers, the rate is 1 - P(no layer matches)
+func (sf *ScalableBloomFilter) Stats() domain.BloomStats {
+	sf.mu.RLock()
+	defer sf.mu.RUnlock()
+	var set, total float64
+	miss := 1.0
+	for _, layer := range sf.layers {
+		stats := layer.filter.Stats()
+		set += stats.FillRatio * float64(layer.filter.m)
+		total += float64(layer.filter.m)
+		miss *= 1 - stats.FalsePositiveRate
+	}
+	return domain.BloomStats{
+		Layers:            len(sf.layers),
+		FillRatio:         set / total,
+		FalsePositiveRate: 1 - miss,
+	}
+}
+
+// Snapshot: magic, version, initial capacity, p, layer count, then per
+// layer its capacity, count and BloomFilter snapshot
+func (sf *ScalableBloomFilter) WriteTo(w io.Writer) (int64, error) {
+	sf.mu.RLock()
+	defer sf.mu.RUnlock()
+	var buf bytes.Buffer
+	buf.Write(scalableMagic[:])
+	binary.Write(&buf, binary.LittleEndian, bloomSnapshotV2)
+	binary.Write(&buf, binary.LittleEndian, sf.capacity)
+	binary.Write(&buf, binary.LittleEndian, math.Float64bits(sf.p))
+	binary.Write(&buf, binary.LittleEndian, uint64(len(sf.layers)))
+	for _, layer := range sf.layers {
+		binary.Write(&buf, binary.LittleEndian, layer.capacity)
+		binary.Write(&buf, binary.LittleEndian, layer.count)
+		if _, err := layer.filter.WriteTo(&buf); err != nil {
+			return 0, err
+		}
+	}
+	return buf.WriteTo(w)
+}
+
+// ReadFrom replaces the layers with the snapshot, restore before serving.
+// Snapshots taken with a different initial capacity or rate are rejected.
+func (sf *ScalableBloomFilter) ReadFrom(r io.Reader) (int64, error) {
+	cr := &countingReader{r: r}
+	var header struct {
+		Magic    [4]byte
+		Version  uint32
+		Capacity uint64
+		P        uint64
+		Layers   uint64
+	}
+	if err := binary.Read(cr, binary.LittleEndian, &header); err != nil {
+		return cr.n, err
+	}
+	if header.Magic != scalableMagic || header.Version != bloomSnapshotV2 ||
+		header.Capacity != sf.capacity || math.Float64frombits(header.P) != sf.p || header.Layers == 0 {
+		return cr.n, ErrBloomSnapshot
+	}
+
+	restored := &ScalableBloomFilter{capacity: sf.capacity, p: sf.p}
+	for range header.Layers {
+		var meta struct {
+			Capacity uint64
+			Count    uint64
+		}
+		if err := binary.Read(cr, binary.LittleEndian, &meta); err != nil {
+			return cr.n, err
+		}
+		restored.grow()
+		layer := restored.layers[len(restored.layers)-1]
+		if layer.capacity != meta.Capacity {
+			return cr.n, ErrBloomSnapshot
+		}
+		layer.count = meta.Count
+		if _, err := layer.filter.ReadFrom(cr); err != nil {
+			return cr.n, err
+		}
+	}
+
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	sf.layers = restored.layers
+	return cr.n, nil
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -1,6 +1,9 @@
 package store
 
 import (
+	"goprl/internal/store/bloomhash"
+	"math"
+	"strconv"
 	"testing"
 )
 
@@ -21,3 +24,186 @@ func TestBloomFilter_Basic(t *testing.T) {
 		t.Log("Note: False positive hit")
 	}
 }
+
+func TestEstimateParameters(t *testing.T) {
+	// Reference values for n=1,000,000 p=0.01
+	m, k := EstimateParameters(1000000, 0.01)
+	if m != 9585059 {
+		t.Errorf("got m %d, want 9585059", m)
+	}
+	if k != 7 {
+		t.Errorf("got k %d, want 7", k)
+	}
+}
+
+func TestEstimateParameters_InvalidRate(t *testing.T) {
+	for _, p := range []float64{0, -0.5, 1, 1.5, math.NaN()} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("p %v: got sizes, want a panic", p)
+				}
+			}()
+			EstimateParameters(1000, p)
+		}()
+	}
+}
+
+func TestLocation_StepIsMultipleOfM(t *testing.T) {
+	// Odd h2 that is a multiple of an odd m used to pin every probe to one bit
+	const m = 9585059
+	seen := make(map[uint64]bool)
+	for i := range uint64(7) {
+		seen[bloomhash.Location(42, 3*m, i, m)] = true
+	}
+	if len(seen) != 7 {
+		t.Errorf("got %d distinct probes, want 7", len(seen))
+	}
+}
+
+func TestLocation_StepSharesFactorWithM(t *testing.T) {
+	// 3 divides 45, a step of 3 or 6 used to cycle through 15 bits only
+	const m = 45
+	for _, h2 := range []uint64{3, 6, 5, 9, 3 + 1<<63} {
+		seen := make(map[uint64]bool)
+		for i := range uint64(m) {
+			seen[bloomhash.Location(7, h2, i, m)] = true
+		}
+		if len(seen) != m {
+			t.Errorf("h2 %d: got %d distinct probes, want all %d bits", h2, len(seen), m)
+		}
+	}
+}
+
+func TestBloomFilter_FalsePositiveRate(t *testing.T) {
+	const n = 20000
+	for _, p := range []float64{0.1, 0.01, 0.001} {
+		t.Run(strconv.FormatFloat(p, 'f', -1, 64), func(t *testing.T) {
+			bf := NewBloomFilterWithEstimates(n, p)
+			for i := range n {
+				bf.Add("https://example.com/" + strconv.Itoa(i))
+			}
+			for i := range n {
+				if !bf.Contains("https://example.com/" + strconv.Itoa(i)) {
+					t.Fatalf("false negative for item %d", i)
+				}
+			}
+
+			const trials = 200000
+			hits := 0
+			for i := range trials {
+				if bf.Contains("https://other.com/" + strconv.Itoa(i)) {
+					hits++
+				}
+			}
+			// Allow some slack over the target for sampling noise
+			if rate := float64(hits) / trials; rate > p*1.5 {
+				t.Errorf("got false positive rate %f, want <= %f", rate, p)
+			}
+		})
+	}
+}
+
+func TestBloomFilter_Stats(t *testing.T) {
+	bf := NewBloomFilterWithEstimates(1000, 0.01)
+	if stats := bf.Stats(); stats.FillRatio != 0 || stats.FalsePositiveRate != 0 {
+		t.Errorf("got %+v, want empty filter stats", stats)
+	}
+	for i := range 1000 {
+		bf.Add("https://example.com/" + strconv.Itoa(i))
+	}
+	// A filter at capacity is about half full and close to its target rate
+	stats := bf.Stats()
+	if stats.FillRatio < 0.4 || stats.FillRatio > 0.6 {
+		t.Errorf("got fill ratio %f, want about 0.5", stats.FillRatio)
+	}
+	if stats.FalsePositiveRate > 0.02 {
+		t.Errorf("got estimated rate %f, want about 0.01", stats.FalsePositiveRate)
+	}
+}
+
+func TestCountingBloomFilter_Remove(t *testing.T) {
+	cf := NewCountingBloomFilterWithEstimates(1000, 0.01)
+
+	cf.Add("https://google.com")
+	cf.Add("https://yahoo.com")
+	if !cf.Contains("https://google.com") {
+		t.Fatal("expected filter to contain added item")
+	}
+
+	cf.Remove("https://google.com")
+	if cf.Contains("https://google.com") {
+		t.Error("expected removed item to be forgotten")
+	}
+	if !cf.Contains("https://yahoo.com") {
+		t.Error("expected other items to survive a removal")
+	}
+
+	// Removing something never added must not disturb the rest
+	cf.Remove("https://bing.com")
+	if !cf.Contains("https://yahoo.com") {
+		t.Error("expected unknown removal to be a no-op")
+	}
+
+	cf.Remove("https://yahoo.com")
+	if stats := cf.Stats(); stats.FillRatio != 0 {
+		t.Errorf("got fill ratio %f, want empty filter", stats.FillRatio)
+	}
+}
+
+func TestCountingBloomFilter_Saturates(t *testing.T) {
+	cf := NewCountingBloomFilter(64, 1)
+	for range 20 {
+		cf.Add("https://google.com")
+	}
+	for range 20 {
+		cf.Remove("https://google.com")
+	}
+	// Pinned counters can't tell how many adds they've seen, so stay set
+	if !cf.Contains("https://google.com") {
+		t.Error("expected saturated counter to stay set")
+	}
+}
+
+func TestScalableBloomFilter_Grows(t *testing.T) {
+	const n = 1000
+	sf := NewScalableBloomFilter(n, 0.01)
+
+	// Ten times the initial capacity
+	for i := range 10 * n {
+		sf.Add("https://example.com/" + strconv.Itoa(i))
+	}
+	for i := range 10 * n {
+		if !sf.Contains("https://example.com/" + strconv.Itoa(i)) {
+			t.Fatalf("false negative for item %d", i)
+		}
+	}
+	stats := sf.Stats()
+	if stats.Layers < 3 {
+		t.Errorf("got %d layers, want the filter to have grown", stats.Layers)
+	}
+	if stats.FalsePositiveRate > 0.015 {
+		t.Errorf("got estimated rate %f, want <= 0.01", stats.FalsePositiveRate)
+	}
+
+	const trials = 100000
+	hits := 0
+	for i := range trials {
+		if sf.Contains("https://other.com/" + strconv.Itoa(i)) {
+			hits++
+		}
+	}
+	if rate := float64(hits) / trials; rate > 0.015 {
+		t.Errorf("got false positive rate %f, want <= 0.01", rate)
+	}
+}
+
+func TestScalableBloomFilter_IgnoresDuplicates(t *testing.T) {
+	sf := NewScalableBloomFilter(10, 0.01)
+	for range 100 {
+		sf.Add("https://google.com")
+	}
+	if stats := sf.Stats(); stats.Layers != 1 {
+		t.Errorf("got %d layers, want duplicates not to use capacity", stats.Layers)
+	}
+}
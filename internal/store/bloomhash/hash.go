@@ -0,0 +1,53 @@
+// Package bloomhash holds the probe layout shared by every bloom filter
+// backend, so in-memory and Redis filters agree on which bits an item sets.
+package bloomhash
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"math"
+)
+
+// Kirsch-Mitzenmacher: two independent halves of one 128 bit hash simulate
+// k hashes as h1 + i*h2. h2 is forced odd, which already keeps the probes
+// apart when m is a power of two. Estimate's sizes aren't, Location takes
+// care of the rest.
+func Hash(data string) (uint64, uint64) {
+	h := fnv.New128a()
+	h.Write([]byte(data))
+	var sum [16]byte
+	h.Sum(sum[:0])
+	return binary.BigEndian.Uint64(sum[:8]), binary.BigEndian.Uint64(sum[8:]) | 1
+}
+
+// Location of the i-th probe in a filter of m bits. A step sharing a factor
+// with m would cycle through only m/gcd bits, so it moves up to the next
+// value coprime with m and the probes stay apart for any m. Both halves are
+// reduced mod m first so i*step can't wrap around 64 bits.
+func Location(h1, h2, i, m uint64) uint64 {
+	step := h2 % m
+	for m > 1 && gcd(step, m) != 1 {
+		step++
+	}
+	return (h1%m + i*step) % m
+}
+
+func gcd(a, b uint64) uint64 {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+// Optimal m = -n ln(p) / ln(2)^2 bits and k = (m/n) ln(2) hashes. p outside
+// (0, 1) has no sensible size and panics, callers pass constants.
+func Estimate(n uint, p float64) (uint, uint) {
+	if !(p > 0 && p < 1) {
+		panic(fmt.Sprintf("bloomhash: false positive rate %v is not between 0 and 1", p))
+	}
+	n = max(n, 1)
+	m := math.Ceil(-float64(n) * math.Log(p) / (math.Ln2 * math.Ln2))
+	k := math.Round(m / float64(n) * math.Ln2)
+	return uint(m), uint(max(k, 1))
+}
@@ -0,0 +1,195 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"goprl/internal/domain"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+var ErrOpen = errors.New("circuit breaker open")
+
+type State int
+
+const (
+	Closed State = iota
+	Open
+	HalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+type Options struct {
+	// Per call deadline, a slow dependency counts as a failed one
+	Timeout time.Duration
+	// Consecutive failures before the breaker opens
+	FailureThreshold int
+	// How long to short-circuit before letting a probe through
+	Cooldown time.Duration
+}
+
+// Closed: calls pass through, failures are counted.
+// Open: calls fail fast with ErrOpen until the cooldown elapses.
+// Half-open: a single probe call is let through, its result closes or reopens.
+type Breaker struct {
+	name   string
+	opts   Options
+	logger *slog.Logger
+
+	mu       sync.Mutex
+	state    State
+	failures int
+	openedAt time.Time
+	probing  bool
+
+	metrics *expvar.Map
+}
+
+func New(name string, opts Options, logger *slog.Logger) *Breaker {
+	b := &Breaker{
+		name:    name,
+		opts:    opts,
+		logger:  logger,
+		metrics: new(expvar.Map).Init(),
+	}
+	b.metrics.Set("state", expvar.Func(func() any { return b.State().String() }))
+	// Visible under /debug/vars, first breaker with a name wins
+	if expvar.Get("breaker_"+name) == nil {
+		expvar.Publish("breaker_"+name, b.metrics)
+	}
+	return b
+}
+
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// Metrics returns a snapshot of the call counters
+func (b *Breaker) Metrics() map[string]int64 {
+	out := make(map[string]int64)
+	b.metrics.Do(func(kv expvar.KeyValue) {
+		if v, ok := kv.Value.(*expvar.Int); ok {
+			out[kv.Key] = v.Value()
+		}
+	})
+	return out
+}
+
+// Do runs fn under the breaker with the per call timeout applied to ctx
+func (b *Breaker) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	probe, err := b.acquire()
+	if err != nil {
+		b.metrics.Add("rejected", 1)
+		return err
+	}
+	b.metrics.Add("calls", 1)
+
+	callCtx := ctx
+	if b.opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		callCtx, cancel = context.WithTimeout(ctx, b.opts.Timeout)
+		defer cancel()
+	}
+	err = fn(callCtx)
+
+	switch {
+	case ctx.Err() != nil:
+		// Caller gave up, says nothing about the dependency
+		b.release(probe, nil, true)
+	case isFailure(err):
+		if errors.Is(callCtx.Err(), context.DeadlineExceeded) {
+			b.metrics.Add("timeouts", 1)
+		}
+		b.metrics.Add("failures", 1)
+		b.release(probe, err, false)
+	default:
+		b.metrics.Add("successes", 1)
+		b.release(probe, nil, false)
+	}
+	return err
+}
+
+func (b *Breaker) acquire() (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case Open:
+		if time.Since(b.openedAt) < b.opts.Cooldown {
+			return false, ErrOpen
+		}
+		b.setState(HalfOpen)
+		fallthrough
+	case HalfOpen:
+		if b.probing {
+			return false, ErrOpen
+		}
+		b.probing = true
+		return true, nil
+	}
+	return false, nil
+}
+
+func (b *Breaker) release(probe bool, err error, abandoned bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if probe {
+		b.probing = false
+	}
+	if abandoned {
+		return
+	}
+	if err == nil {
+		b.failures = 0
+		if b.state != Closed {
+			b.setState(Closed)
+		}
+		return
+	}
+	b.failures++
+	if b.state == HalfOpen || (b.state == Closed && b.failures >= b.opts.FailureThreshold) {
+		b.openedAt = time.Now()
+		b.setState(Open)
+	}
+}
+
+// Caller must hold mu
+func (b *Breaker) setState(state State) {
+	b.logger.Warn("Circuit breaker state change", "breaker", b.name, "from", b.state.String(), "to", state.String())
+	b.state = state
+	b.metrics.Add("transitions_"+state.String(), 1)
+}
+
+// Lookups that miss or are rejected by business rules mean the dependency is healthy
+func isFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+	for _, target := range []error{
+		domain.ErrURLNotFound,
+		domain.ErrURLExpired,
+		domain.ErrURLAlreadyExists,
+		domain.ErrOriginalURLExists,
+		domain.ErrRateLimitExceeded,
+		domain.ErrURLExhausted,
+	} {
+		if errors.Is(err, target) {
+			return false
+		}
+	}
+	return true
+}
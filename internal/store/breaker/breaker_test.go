@@ -0,0 +1,125 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"goprl/internal/domain"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+var errDown = errors.New("connection refused")
+
+func newTestBreaker(name string) *Breaker {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	return New(name, Options{
+		Timeout:          20 * time.Millisecond,
+		FailureThreshold: 2,
+		Cooldown:         20 * time.Millisecond,
+	}, logger)
+}
+
+func TestBreaker_OpensAndRecovers(t *testing.T) {
+	ctx := context.Background()
+	b := newTestBreaker("recover")
+	fail := func(ctx context.Context) error { return errDown }
+	ok := func(ctx context.Context) error { return nil }
+
+	for range 2 {
+		if err := b.Do(ctx, fail); err != errDown {
+			t.Fatalf("got %v, want %v", err, errDown)
+		}
+	}
+	if b.State() != Open {
+		t.Fatalf("got state %s, want open", b.State())
+	}
+
+	called := false
+	err := b.Do(ctx, func(ctx context.Context) error {
+		called = true
+		return nil
+	})
+	if err != ErrOpen || called {
+		t.Fatalf("got %v, want fast %v without calling through", err, ErrOpen)
+	}
+
+	time.Sleep(25 * time.Millisecond)
+	if err := b.Do(ctx, ok); err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	if b.State() != Closed {
+		t.Fatalf("got state %s, want closed", b.State())
+	}
+
+	metrics := b.Metrics()
+	if metrics["failures"] != 2 || metrics["rejected"] != 1 || metrics["successes"] != 1 {
+		t.Errorf("got metrics %v", metrics)
+	}
+}
+
+func TestBreaker_HalfOpenFailureReopens(t *testing.T) {
+	ctx := context.Background()
+	b := newTestBreaker("reopen")
+	fail := func(ctx context.Context) error { return errDown }
+
+	b.Do(ctx, fail)
+	b.Do(ctx, fail)
+	time.Sleep(25 * time.Millisecond)
+
+	if err := b.Do(ctx, fail); err != errDown {
+		t.Fatalf("got %v, want probe to call through", err)
+	}
+	if b.State() != Open {
+		t.Fatalf("got state %s, want open", b.State())
+	}
+}
+
+func TestBreaker_Timeout(t *testing.T) {
+	ctx := context.Background()
+	b := newTestBreaker("timeout")
+	hang := func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	start := time.Now()
+	b.Do(ctx, hang)
+	b.Do(ctx, hang)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("calls took %v, want per call timeout", elapsed)
+	}
+	if b.State() != Open {
+		t.Fatalf("got state %s, want open", b.State())
+	}
+	if b.Metrics()["timeouts"] != 2 {
+		t.Errorf("got %d timeouts, want 2", b.Metrics()["timeouts"])
+	}
+}
+
+func TestBreaker_IgnoresDomainErrors(t *testing.T) {
+	ctx := context.Background()
+	b := newTestBreaker("domain")
+	miss := func(ctx context.Context) error { return domain.ErrURLNotFound }
+
+	for range 5 {
+		b.Do(ctx, miss)
+	}
+	if b.State() != Closed {
+		t.Fatalf("got state %s, want closed", b.State())
+	}
+}
+
+func TestBreaker_CallerCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	b := newTestBreaker("cancelled")
+
+	for range 5 {
+		b.Do(ctx, func(ctx context.Context) error { return ctx.Err() })
+	}
+	if b.State() != Closed {
+		t.Fatalf("got state %s, want closed", b.State())
+	}
+}
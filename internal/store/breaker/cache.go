@@ -0,0 +1,75 @@
+package breaker
+
+import (
+	"context"
+	"goprl/internal/domain"
+	"time"
+)
+
+type Cache struct {
+	cache   domain.URLCache
+	breaker *Breaker
+}
+
+func NewCache(cache domain.URLCache, breaker *Breaker) *Cache {
+	return &Cache{cache: cache, breaker: breaker}
+}
+
+func (c *Cache) Get(ctx context.Context, key string) (*domain.URL, error) {
+	var url *domain.URL
+	err := c.breaker.Do(ctx, func(ctx context.Context) error {
+		var err error
+		url, err = c.cache.Get(ctx, key)
+		return err
+	})
+	return url, err
+}
+
+func (c *Cache) Set(ctx context.Context, key string, value *domain.URL, ttl time.Duration) error {
+	return c.breaker.Do(ctx, func(ctx context.Context) error {
+		return c.cache.Set(ctx, key, value, ttl)
+	})
+}
+
+func (c *Cache) Delete(ctx context.Context, keys ...string) error {
+	return c.breaker.Do(ctx, func(ctx context.Context) error {
+		return c.cache.Delete(ctx, keys...)
+	})
+}
+
+func (c *Cache) SetCounter(ctx context.Context, key string, value int64) error {
+	return c.breaker.Do(ctx, func(ctx context.Context) error {
+		return c.cache.SetCounter(ctx, key, value)
+	})
+}
+
+// Fails open, an unavailable limiter shouldn't take the whole site down
+func (c *Cache) Allow(ctx context.Context, key string, limit int, window time.Duration) error {
+	err := c.breaker.Do(ctx, func(ctx context.Context) error {
+		return c.cache.Allow(ctx, key, limit, window)
+	})
+	if err == domain.ErrRateLimitExceeded {
+		return err
+	}
+	return nil
+}
+
+func (c *Cache) Increment(ctx context.Context, key string) (int64, error) {
+	var n int64
+	err := c.breaker.Do(ctx, func(ctx context.Context) error {
+		var err error
+		n, err = c.cache.Increment(ctx, key)
+		return err
+	})
+	return n, err
+}
+
+func (c *Cache) Countdown(ctx context.Context, key string, start, delta int64, ttl time.Duration) (int64, error) {
+	var n int64
+	err := c.breaker.Do(ctx, func(ctx context.Context) error {
+		var err error
+		n, err = c.cache.Countdown(ctx, key, start, delta, ttl)
+		return err
+	})
+	return n, err
+}
@@ -0,0 +1,97 @@
+package breaker
+
+import (
+	"context"
+	"goprl/internal/domain"
+)
+
+type Store struct {
+	store   domain.URLStore
+	breaker *Breaker
+}
+
+func NewStore(store domain.URLStore, breaker *Breaker) *Store {
+	return &Store{store: store, breaker: breaker}
+}
+
+func (s *Store) CreateURL(ctx context.Context, url *domain.URL) error {
+	return s.breaker.Do(ctx, func(ctx context.Context) error {
+		return s.store.CreateURL(ctx, url)
+	})
+}
+
+func (s *Store) GetByShortURL(ctx context.Context, code string) (*domain.URL, error) {
+	var url *domain.URL
+	err := s.breaker.Do(ctx, func(ctx context.Context) error {
+		var err error
+		url, err = s.store.GetByShortURL(ctx, code)
+		return err
+	})
+	return url, err
+}
+
+func (s *Store) GetByOriginalURL(ctx context.Context, originalURL string) (*domain.URL, error) {
+	var url *domain.URL
+	err := s.breaker.Do(ctx, func(ctx context.Context) error {
+		var err error
+		url, err = s.store.GetByOriginalURL(ctx, originalURL)
+		return err
+	})
+	return url, err
+}
+
+func (s *Store) GetMaxID(ctx context.Context) (int64, error) {
+	var id int64
+	err := s.breaker.Do(ctx, func(ctx context.Context) error {
+		var err error
+		id, err = s.store.GetMaxID(ctx)
+		return err
+	})
+	return id, err
+}
+
+func (s *Store) ListURLs(ctx context.Context, filter domain.ListFilter) ([]*domain.URL, error) {
+	var urls []*domain.URL
+	err := s.breaker.Do(ctx, func(ctx context.Context) error {
+		var err error
+		urls, err = s.store.ListURLs(ctx, filter)
+		return err
+	})
+	return urls, err
+}
+
+func (s *Store) UpdateURL(ctx context.Context, code string, update domain.URLUpdate) (*domain.URL, error) {
+	var url *domain.URL
+	err := s.breaker.Do(ctx, func(ctx context.Context) error {
+		var err error
+		url, err = s.store.UpdateURL(ctx, code, update)
+		return err
+	})
+	return url, err
+}
+
+func (s *Store) UseClick(ctx context.Context, code string) error {
+	return s.breaker.Do(ctx, func(ctx context.Context) error {
+		return s.store.UseClick(ctx, code)
+	})
+}
+
+// Batches go through the breaker as one call, stores without batch support
+// get one call per link
+func (s *Store) CreateURLs(ctx context.Context, urls []*domain.URL) ([]error, error) {
+	batch, ok := s.store.(domain.URLBatchStore)
+	if !ok {
+		errs := make([]error, len(urls))
+		for i, url := range urls {
+			errs[i] = s.CreateURL(ctx, url)
+		}
+		return errs, nil
+	}
+	var errs []error
+	err := s.breaker.Do(ctx, func(ctx context.Context) error {
+		var err error
+		errs, err = batch.CreateURLs(ctx, urls)
+		return err
+	})
+	return errs, err
+}
@@ -0,0 +1,184 @@
+package memory
+
+import (
+	"context"
+	"goprl/internal/domain"
+	"sync"
+	"time"
+)
+
+// Cache implements domain.URLCache in process for deployments without
+// Redis. Counters and rate limits are per instance, so it only suits a single
+// replica.
+type Cache struct {
+	mu         sync.Mutex
+	entries    map[string]cacheEntry
+	windows    map[string]rateWindow
+	countdowns map[string]countdown
+	counters   map[string]int64
+	maxTTL     time.Duration
+	maxEntries int
+	now        func() time.Time
+}
+
+// Entries keyed by original URL hold a ref to the code, like the Redis cache
+type cacheEntry struct {
+	url     domain.URL
+	ref     string
+	expires time.Time
+}
+
+type rateWindow struct {
+	count int
+	reset time.Time
+}
+
+type countdown struct {
+	value   int64
+	expires time.Time
+}
+
+// maxEntries bounds links, rate limit windows and countdowns each, expired
+// ones are swept first when full
+func NewCache(maxTTL time.Duration, maxEntries int) *Cache {
+	return &Cache{
+		entries:    make(map[string]cacheEntry),
+		windows:    make(map[string]rateWindow),
+		countdowns: make(map[string]countdown),
+		counters:   make(map[string]int64),
+		maxTTL:     maxTTL,
+		maxEntries: max(maxEntries, 1),
+		now:        time.Now,
+	}
+}
+
+func (c *Cache) Close() error {
+	return nil
+}
+
+func (c *Cache) Get(ctx context.Context, key string) (*domain.URL, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.lookup(key)
+	if ok && entry.ref != "" {
+		entry, ok = c.lookup(entry.ref)
+	}
+	if !ok || entry.ref != "" {
+		return nil, domain.ErrURLNotFound
+	}
+	url := entry.url
+	return &url, nil
+}
+
+func (c *Cache) lookup(key string) (cacheEntry, bool) {
+	entry, ok := c.entries[key]
+	if ok && !c.now().Before(entry.expires) {
+		delete(c.entries, key)
+		return cacheEntry{}, false
+	}
+	return entry, ok
+}
+
+// Same TTL rules as the Redis cache: capped by the cache max and the time
+// left until the link expires, a non-positive ttl uses the cache max
+func (c *Cache) Set(ctx context.Context, key string, value *domain.URL, ttl time.Duration) error {
+	if ttl <= 0 || ttl > c.maxTTL {
+		ttl = c.maxTTL
+	}
+	if !value.ExpiresAt.IsZero() {
+		ttl = min(ttl, value.ExpiresAt.Sub(c.now()))
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if ttl <= 0 {
+		delete(c.entries, key)
+		return nil
+	}
+	entry := cacheEntry{expires: c.now().Add(ttl)}
+	if key != value.ShortURL {
+		entry.ref = value.ShortURL
+	} else {
+		entry.url = *value
+	}
+	if _, ok := c.entries[key]; !ok && len(c.entries) >= c.maxEntries {
+		evict(c.entries, c.maxEntries, func(e cacheEntry) bool { return !c.now().Before(e.expires) })
+	}
+	c.entries[key] = entry
+	return nil
+}
+
+func (c *Cache) Delete(ctx context.Context, keys ...string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, key := range keys {
+		delete(c.entries, key)
+	}
+	return nil
+}
+
+// Fixed window, the count resets window after the first hit
+func (c *Cache) Allow(ctx context.Context, key string, limit int, window time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	w, ok := c.windows[key]
+	if !ok || !now.Before(w.reset) {
+		if !ok && len(c.windows) >= c.maxEntries {
+			evict(c.windows, c.maxEntries, func(w rateWindow) bool { return !now.Before(w.reset) })
+		}
+		w = rateWindow{reset: now.Add(window)}
+	}
+	w.count++
+	c.windows[key] = w
+	if w.count > limit {
+		return domain.ErrRateLimitExceeded
+	}
+	return nil
+}
+
+func (c *Cache) Increment(ctx context.Context, key string) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.counters[key]++
+	return c.counters[key], nil
+}
+
+func (c *Cache) SetCounter(ctx context.Context, key string, value int64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.counters[key] = value
+	return nil
+}
+
+// An evicted countdown starts over from start, the store still holds the
+// real count
+func (c *Cache) Countdown(ctx context.Context, key string, start, delta int64, ttl time.Duration) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	d, ok := c.countdowns[key]
+	if !ok || !now.Before(d.expires) {
+		if !ok && len(c.countdowns) >= c.maxEntries {
+			evict(c.countdowns, c.maxEntries, func(d countdown) bool { return !now.Before(d.expires) })
+		}
+		d = countdown{value: start, expires: now.Add(ttl)}
+	}
+	d.value += delta
+	c.countdowns[key] = d
+	return d.value, nil
+}
+
+// Drops expired values, then arbitrary ones until there is room for one more
+func evict[V any](m map[string]V, limit int, expired func(V) bool) {
+	for key, value := range m {
+		if expired(value) {
+			delete(m, key)
+		}
+	}
+	for key := range m {
+		if len(m) < limit {
+			return
+		}
+		delete(m, key)
+	}
+}
@@ -0,0 +1,102 @@
+package memory
+
+import (
+	"context"
+	"goprl/internal/domain"
+	"testing"
+	"time"
+)
+
+func TestCache_SetGet(t *testing.T) {
+	ctx := context.Background()
+	cache := NewCache(time.Hour, 10)
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+
+	url := &domain.URL{ShortURL: "abc", OriginalURL: "https://example.com", ExpiresAt: now.Add(time.Minute)}
+	cache.Set(ctx, "abc", url, 0)
+	cache.Set(ctx, url.OriginalURL, url, 0)
+
+	for _, key := range []string{"abc", url.OriginalURL} {
+		got, err := cache.Get(ctx, key)
+		if err != nil || got.OriginalURL != url.OriginalURL {
+			t.Fatalf("Get(%q) = %v, %v, want the link", key, got, err)
+		}
+	}
+
+	// Dropping the code also drops the ref pointing at it
+	cache.Delete(ctx, "abc")
+	if _, err := cache.Get(ctx, url.OriginalURL); err != domain.ErrURLNotFound {
+		t.Errorf("got %v, want dangling ref to miss", err)
+	}
+
+	// Entries never outlive the link
+	cache.Set(ctx, "abc", url, 0)
+	now = now.Add(2 * time.Minute)
+	if _, err := cache.Get(ctx, "abc"); err != domain.ErrURLNotFound {
+		t.Errorf("got %v, want entry gone once the link expired", err)
+	}
+}
+
+func TestCache_Bounded(t *testing.T) {
+	ctx := context.Background()
+	cache := NewCache(time.Hour, 3)
+	for _, code := range []string{"a", "b", "c", "d", "e"} {
+		cache.Set(ctx, code, &domain.URL{ShortURL: code}, 0)
+	}
+	if len(cache.entries) > 3 {
+		t.Errorf("got %d entries, want at most 3", len(cache.entries))
+	}
+	if _, err := cache.Get(ctx, "e"); err != nil {
+		t.Errorf("got %v, want the newest entry kept", err)
+	}
+}
+
+func TestCache_Allow(t *testing.T) {
+	ctx := context.Background()
+	cache := NewCache(time.Hour, 10)
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+
+	for i := range 3 {
+		if err := cache.Allow(ctx, "1.2.3.4", 2, time.Minute); (err != nil) != (i == 2) {
+			t.Fatalf("request %d got %v", i+1, err)
+		}
+	}
+	now = now.Add(time.Minute)
+	if err := cache.Allow(ctx, "1.2.3.4", 2, time.Minute); err != nil {
+		t.Errorf("got %v, want a fresh window", err)
+	}
+}
+
+func TestCache_Counter(t *testing.T) {
+	ctx := context.Background()
+	cache := NewCache(time.Hour, 10)
+	if n, _ := cache.Increment(ctx, "counter"); n != 1 {
+		t.Errorf("got %d, want 1", n)
+	}
+	cache.SetCounter(ctx, "counter", 41)
+	if n, _ := cache.Increment(ctx, "counter"); n != 42 {
+		t.Errorf("got %d, want 42", n)
+	}
+}
+
+func TestCache_Countdown(t *testing.T) {
+	ctx := context.Background()
+	cache := NewCache(time.Hour, 10)
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+
+	for _, want := range []int64{1, 0, -1} {
+		if n, _ := cache.Countdown(ctx, "clicks:abc", 2, -1, time.Minute); n != want {
+			t.Errorf("got %d, want %d", n, want)
+		}
+	}
+	if n, _ := cache.Countdown(ctx, "clicks:abc", 2, 1, time.Minute); n != 0 {
+		t.Errorf("got %d, want a use given back", n)
+	}
+	now = now.Add(time.Minute)
+	if n, _ := cache.Countdown(ctx, "clicks:abc", 5, -1, time.Minute); n != 4 {
+		t.Errorf("got %d, want an expired countdown seeded again", n)
+	}
+}
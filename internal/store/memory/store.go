@@ -0,0 +1,259 @@
+package memory
+
+import (
+	"cmp"
+	"context"
+	"goprl/internal/domain"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Store keeps every link in process, for demos, tests and single binary
+// deployments. Nothing survives a restart.
+type Store struct {
+	mu     sync.RWMutex
+	byCode map[string]*domain.URL
+	// owner + canonical URL to code, live links only, mirrors the unique
+	// index in Postgres
+	byURL  map[string]string
+	lastID int64
+}
+
+func NewStore() *Store {
+	return &Store{
+		byCode: make(map[string]*domain.URL),
+		byURL:  make(map[string]string),
+	}
+}
+
+func (s *Store) Close() error {
+	return nil
+}
+
+func urlKey(owner, originalURL string) string {
+	return owner + "\x00" + domain.CanonicalURL(originalURL)
+}
+
+func (s *Store) CreateURL(ctx context.Context, url *domain.URL) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.byCode[url.ShortURL]; ok {
+		return domain.ErrURLAlreadyExists
+	}
+	// Like the url_hash left NULL in SQL, see domain.URL.Dedupes
+	key := urlKey(url.Owner, url.OriginalURL)
+	if code, ok := s.byURL[key]; ok && url.Dedupes() && s.byCode[code].ExpiresAt.After(time.Now()) {
+		return domain.ErrOriginalURLExists
+	}
+
+	s.lastID++
+	url.ID = s.lastID
+	if url.CreatedAt.IsZero() {
+		url.CreatedAt = time.Now()
+	}
+	s.byCode[url.ShortURL] = clone(url)
+	if url.Dedupes() && url.ExpiresAt.After(time.Now()) {
+		s.byURL[key] = url.ShortURL
+	}
+	return nil
+}
+
+func (s *Store) GetByShortURL(ctx context.Context, code string) (*domain.URL, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	url, ok := s.byCode[code]
+	if !ok {
+		return nil, domain.ErrURLNotFound
+	}
+	if url.ExpiresAt.Before(time.Now()) {
+		return nil, domain.ErrURLExpired
+	}
+	return clone(url), nil
+}
+
+// Links created through the public API have no owner
+func (s *Store) GetByOriginalURL(ctx context.Context, originalURL string) (*domain.URL, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	code, ok := s.byURL[urlKey("", originalURL)]
+	if !ok || !s.byCode[code].ExpiresAt.After(time.Now()) {
+		return nil, domain.ErrURLNotFound
+	}
+	return clone(s.byCode[code]), nil
+}
+
+func (s *Store) GetMaxID(ctx context.Context) (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.lastID, nil
+}
+
+func (s *Store) ListRecent(ctx context.Context, limit int) ([]*domain.URL, error) {
+	urls := s.live()
+	slices.SortFunc(urls, func(a, b *domain.URL) int { return cmp.Compare(b.ID, a.ID) })
+	return urls[:min(limit, len(urls))], nil
+}
+
+// Only links in the dedupe index, the same ones Shorten adds to the filter
+func (s *Store) EachOriginalURL(ctx context.Context, fn func(originalURL string)) error {
+	s.mu.RLock()
+	now := time.Now()
+	var urls []string
+	for _, code := range s.byURL {
+		if url := s.byCode[code]; url.ExpiresAt.After(now) {
+			urls = append(urls, url.OriginalURL)
+		}
+	}
+	s.mu.RUnlock()
+	for _, originalURL := range urls {
+		fn(originalURL)
+	}
+	return nil
+}
+
+func (s *Store) EachURL(ctx context.Context, fn func(url *domain.URL) error) error {
+	s.mu.RLock()
+	urls := make([]*domain.URL, 0, len(s.byCode))
+	for _, url := range s.byCode {
+		urls = append(urls, clone(url))
+	}
+	s.mu.RUnlock()
+	slices.SortFunc(urls, func(a, b *domain.URL) int { return cmp.Compare(a.ID, b.ID) })
+	for _, url := range urls {
+		if err := fn(url); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Store) ListURLs(ctx context.Context, f domain.ListFilter) ([]*domain.URL, error) {
+	s.mu.RLock()
+	now := time.Now()
+	search := strings.ToLower(f.Search)
+	var urls []*domain.URL
+	for _, url := range s.byCode {
+		switch {
+		case f.Before > 0 && url.ID >= f.Before,
+			f.Owner != "" && url.Owner != f.Owner,
+			!f.CreatedFrom.IsZero() && url.CreatedAt.Before(f.CreatedFrom),
+			!f.CreatedTo.IsZero() && !url.CreatedAt.Before(f.CreatedTo),
+			f.Status == domain.StatusLive && !url.ExpiresAt.After(now),
+			f.Status == domain.StatusExpired && url.ExpiresAt.After(now),
+			f.Domain != "" && domain.URLHost(url.OriginalURL) != strings.ToLower(f.Domain),
+			search != "" && !strings.Contains(strings.ToLower(url.OriginalURL), search),
+			!hasTags(url.Tags, f.Tags):
+			continue
+		}
+		urls = append(urls, clone(url))
+	}
+	s.mu.RUnlock()
+	slices.SortFunc(urls, func(a, b *domain.URL) int { return cmp.Compare(b.ID, a.ID) })
+	return urls[:min(f.Limit, len(urls))], nil
+}
+
+func (s *Store) UpdateURL(ctx context.Context, code string, update domain.URLUpdate) (*domain.URL, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	url, ok := s.byCode[code]
+	if !ok {
+		return nil, domain.ErrURLNotFound
+	}
+	if update.Tags != nil {
+		url.Tags = slices.Clone(update.Tags)
+	}
+	if update.Metadata != nil {
+		url.Metadata = maps.Clone(update.Metadata)
+	}
+	return clone(url), nil
+}
+
+func (s *Store) UseClick(ctx context.Context, code string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	url, ok := s.byCode[code]
+	if !ok || url.Clicks >= url.MaxClicks {
+		return domain.ErrURLExhausted
+	}
+	url.Clicks++
+	return nil
+}
+
+// Callers get their own copy, the tags and metadata included
+func clone(url *domain.URL) *domain.URL {
+	c := *url
+	c.Tags = slices.Clone(url.Tags)
+	c.Metadata = maps.Clone(url.Metadata)
+	if len(c.Tags) == 0 {
+		c.Tags = nil
+	}
+	if len(c.Metadata) == 0 {
+		c.Metadata = nil
+	}
+	return &c
+}
+
+func hasTags(tags, want []string) bool {
+	for _, tag := range want {
+		if !slices.Contains(tags, tag) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Store) live() []*domain.URL {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	now := time.Now()
+	urls := make([]*domain.URL, 0, len(s.byCode))
+	for _, url := range s.byCode {
+		if url.ExpiresAt.After(now) {
+			urls = append(urls, clone(url))
+		}
+	}
+	return urls
+}
+
+// There is nowhere to archive to in memory, both modes drop the links
+func (s *Store) ReapExpired(ctx context.Context, cutoff time.Time, batchSize int, archive bool, onBatch func([]domain.ReapedURL)) (int, bool, error) {
+	reaped := 0
+	for {
+		batch := s.reapBatch(cutoff, batchSize)
+		reaped += len(batch)
+		if len(batch) > 0 && onBatch != nil {
+			onBatch(batch)
+		}
+		if len(batch) < batchSize {
+			return reaped, true, nil
+		}
+		if err := ctx.Err(); err != nil {
+			return reaped, true, err
+		}
+	}
+}
+
+func (s *Store) reapBatch(cutoff time.Time, batchSize int) []domain.ReapedURL {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var batch []domain.ReapedURL
+	for code, url := range s.byCode {
+		if len(batch) == batchSize {
+			break
+		}
+		if !url.ExpiresAt.Before(cutoff) {
+			continue
+		}
+		delete(s.byCode, code)
+		key := urlKey(url.Owner, url.OriginalURL)
+		deduped := s.byURL[key] == code
+		if deduped {
+			delete(s.byURL, key)
+		}
+		batch = append(batch, domain.ReapedURL{URL: url, Deduped: deduped})
+	}
+	return batch
+}
@@ -0,0 +1,218 @@
+package memory
+
+import (
+	"context"
+	"goprl/internal/domain"
+	"testing"
+	"time"
+)
+
+func TestStore_CreateAndGet(t *testing.T) {
+	ctx := context.Background()
+	store := NewStore()
+
+	url := &domain.URL{ShortURL: "abc", OriginalURL: "https://Example.com", ExpiresAt: time.Now().Add(time.Hour)}
+	if err := store.CreateURL(ctx, url); err != nil {
+		t.Fatalf("got error: %v, want nil", err)
+	}
+	if url.ID != 1 {
+		t.Errorf("got id %d, want 1", url.ID)
+	}
+
+	got, err := store.GetByShortURL(ctx, "abc")
+	if err != nil || got.OriginalURL != "https://Example.com" {
+		t.Fatalf("got %v, %v, want the created link", got, err)
+	}
+	got, err = store.GetByOriginalURL(ctx, "https://example.com/")
+	if err != nil || got.ShortURL != "abc" {
+		t.Fatalf("got %v, %v, want the link found by its canonical URL", got, err)
+	}
+
+	err = store.CreateURL(ctx, &domain.URL{ShortURL: "abc", OriginalURL: "https://other.com", ExpiresAt: time.Now().Add(time.Hour)})
+	if err != domain.ErrURLAlreadyExists {
+		t.Errorf("got %v, want ErrURLAlreadyExists", err)
+	}
+	err = store.CreateURL(ctx, &domain.URL{ShortURL: "def", OriginalURL: "https://example.com", ExpiresAt: time.Now().Add(time.Hour)})
+	if err != domain.ErrOriginalURLExists {
+		t.Errorf("got %v, want ErrOriginalURLExists", err)
+	}
+
+	if _, err := store.GetByShortURL(ctx, "missing"); err != domain.ErrURLNotFound {
+		t.Errorf("got %v, want ErrURLNotFound", err)
+	}
+	if maxID, _ := store.GetMaxID(ctx); maxID != 1 {
+		t.Errorf("got max id %d, want 1", maxID)
+	}
+}
+
+func TestStore_Expired(t *testing.T) {
+	ctx := context.Background()
+	store := NewStore()
+
+	expired := &domain.URL{ShortURL: "old", OriginalURL: "https://example.com/", ExpiresAt: time.Now().Add(-time.Hour)}
+	if err := store.CreateURL(ctx, expired); err != nil {
+		t.Fatalf("got error: %v, want nil", err)
+	}
+	if _, err := store.GetByShortURL(ctx, "old"); err != domain.ErrURLExpired {
+		t.Errorf("got %v, want ErrURLExpired", err)
+	}
+	if _, err := store.GetByOriginalURL(ctx, "https://example.com/"); err != domain.ErrURLNotFound {
+		t.Errorf("got %v, want expired link skipped", err)
+	}
+
+	// An expired link doesn't block a fresh one for the same URL
+	fresh := &domain.URL{ShortURL: "new", OriginalURL: "https://example.com/", ExpiresAt: time.Now().Add(time.Hour)}
+	if err := store.CreateURL(ctx, fresh); err != nil {
+		t.Fatalf("got error: %v, want nil", err)
+	}
+
+	recent, _ := store.ListRecent(ctx, 10)
+	if len(recent) != 1 || recent[0].ShortURL != "new" {
+		t.Errorf("got %v, want only the live link", recent)
+	}
+
+	var reaped []domain.ReapedURL
+	n, locked, err := store.ReapExpired(ctx, time.Now(), 1, true, func(batch []domain.ReapedURL) {
+		reaped = append(reaped, batch...)
+	})
+	if err != nil || !locked || n != 1 || len(reaped) != 1 || reaped[0].ShortURL != "old" {
+		t.Fatalf("got %d %v %v %v, want the expired link reaped", n, locked, err, reaped)
+	}
+	if reaped[0].Deduped {
+		t.Error("got the reaped link deduped, want its hash handed to the fresh link")
+	}
+	if _, err := store.GetByShortURL(ctx, "old"); err != domain.ErrURLNotFound {
+		t.Errorf("got %v, want reaped link gone", err)
+	}
+	if got, err := store.GetByOriginalURL(ctx, "https://example.com/"); err != nil || got.ShortURL != "new" {
+		t.Errorf("got %v, %v, want the fresh link kept", got, err)
+	}
+}
+
+func TestStore_ListURLs(t *testing.T) {
+	ctx := context.Background()
+	store := NewStore()
+	hour := time.Now().Add(time.Hour)
+	old := time.Now().Add(-48 * time.Hour)
+	for _, url := range []*domain.URL{
+		{ShortURL: "a", OriginalURL: "https://Shop.example.com/sale?code=50%_off", ExpiresAt: hour, CreatedAt: old},
+		{ShortURL: "b", OriginalURL: "https://docs.example.com/guide", ExpiresAt: hour, Owner: "team"},
+		{ShortURL: "c", OriginalURL: "https://user@shop.example.com:8443/cart", ExpiresAt: time.Now().Add(-time.Hour)},
+		{ShortURL: "d", OriginalURL: "https://other.com/SALE", ExpiresAt: hour},
+	} {
+		if err := store.CreateURL(ctx, url); err != nil {
+			t.Fatalf("got error: %v, want nil", err)
+		}
+	}
+
+	codes := func(filter domain.ListFilter) string {
+		if filter.Limit == 0 {
+			filter.Limit = 10
+		}
+		urls, err := store.ListURLs(ctx, filter)
+		if err != nil {
+			t.Fatalf("got error: %v, want nil", err)
+		}
+		var got string
+		for _, url := range urls {
+			got += url.ShortURL
+		}
+		return got
+	}
+	for _, tt := range []struct {
+		name   string
+		filter domain.ListFilter
+		want   string
+	}{
+		{"All newest first", domain.ListFilter{}, "dcba"},
+		{"Cursor", domain.ListFilter{Before: 3, Limit: 1}, "b"},
+		{"Owner", domain.ListFilter{Owner: "team"}, "b"},
+		{"Created range", domain.ListFilter{CreatedTo: time.Now().Add(-time.Hour)}, "a"},
+		{"Live", domain.ListFilter{Status: domain.StatusLive}, "dba"},
+		{"Expired", domain.ListFilter{Status: domain.StatusExpired}, "c"},
+		{"Domain", domain.ListFilter{Domain: "SHOP.example.com"}, "ca"},
+		{"Search ignores case", domain.ListFilter{Search: "sale"}, "da"},
+		{"Search is literal", domain.ListFilter{Search: "50%_"}, "a"},
+	} {
+		if got := codes(tt.filter); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestStore_TagsAndUpdate(t *testing.T) {
+	ctx := context.Background()
+	store := NewStore()
+	hour := time.Now().Add(time.Hour)
+	store.CreateURL(ctx, &domain.URL{ShortURL: "a", OriginalURL: "https://a.com", ExpiresAt: hour, Tags: []string{"email", "spring"}, Metadata: map[string]any{"note": "hi"}})
+	store.CreateURL(ctx, &domain.URL{ShortURL: "b", OriginalURL: "https://b.com", ExpiresAt: hour, Tags: []string{"spring"}})
+
+	// Tagged links stay out of dedupe, see domain.URL.Dedupes
+	if _, err := store.GetByOriginalURL(ctx, "https://a.com"); err != domain.ErrURLNotFound {
+		t.Errorf("got %v, want the tagged link kept out of dedupe", err)
+	}
+	got, err := store.GetByShortURL(ctx, "a")
+	if err != nil || len(got.Tags) != 2 || got.Metadata["note"] != "hi" {
+		t.Fatalf("got %+v, %v, want tags and metadata stored", got, err)
+	}
+	urls, _ := store.ListURLs(ctx, domain.ListFilter{Tags: []string{"spring", "email"}, Limit: 10})
+	if len(urls) != 1 || urls[0].ShortURL != "a" {
+		t.Errorf("got %d links, want only the one with both tags", len(urls))
+	}
+
+	updated, err := store.UpdateURL(ctx, "a", domain.URLUpdate{Tags: []string{}})
+	if err != nil || updated.Tags != nil || updated.Metadata["note"] != "hi" {
+		t.Errorf("got %+v, %v, want tags cleared and metadata kept", updated, err)
+	}
+	updated, err = store.UpdateURL(ctx, "b", domain.URLUpdate{Metadata: map[string]any{"owner": "growth"}})
+	if err != nil || len(updated.Tags) != 1 || updated.Metadata["owner"] != "growth" {
+		t.Errorf("got %+v, %v, want metadata set and tags kept", updated, err)
+	}
+	if _, err := store.UpdateURL(ctx, "missing", domain.URLUpdate{}); err != domain.ErrURLNotFound {
+		t.Errorf("got %v, want ErrURLNotFound", err)
+	}
+}
+
+func TestStore_ProtectedLinks(t *testing.T) {
+	ctx := context.Background()
+	store := NewStore()
+	expires := time.Now().Add(time.Hour)
+
+	store.CreateURL(ctx, &domain.URL{ShortURL: "pub", OriginalURL: "https://docs.example.com", ExpiresAt: expires})
+	for _, code := range []string{"a", "b"} {
+		url := &domain.URL{ShortURL: code, OriginalURL: "https://docs.example.com", ExpiresAt: expires, PasswordHash: "hash-" + code}
+		if err := store.CreateURL(ctx, url); err != nil {
+			t.Fatalf("got %v, want protected links to the same URL allowed", err)
+		}
+	}
+	got, err := store.GetByShortURL(ctx, "b")
+	if err != nil || got.PasswordHash != "hash-b" {
+		t.Errorf("got %+v, %v, want the password hash stored", got, err)
+	}
+	if got, err := store.GetByOriginalURL(ctx, "https://docs.example.com"); err != nil || got.ShortURL != "pub" {
+		t.Errorf("got %+v, %v, want dedupe to keep finding the public link", got, err)
+	}
+	var live []string
+	store.EachOriginalURL(ctx, func(originalURL string) { live = append(live, originalURL) })
+	if len(live) != 1 {
+		t.Errorf("got %v, want only the public link replayed into the bloom filter", live)
+	}
+}
+
+func TestStore_UseClick(t *testing.T) {
+	ctx := context.Background()
+	store := NewStore()
+	expires := time.Now().Add(time.Hour)
+	store.CreateURL(ctx, &domain.URL{ShortURL: "pub", OriginalURL: "https://invite.example.com", ExpiresAt: expires})
+	store.CreateURL(ctx, &domain.URL{ShortURL: "once", OriginalURL: "https://invite.example.com", ExpiresAt: expires, MaxClicks: 1})
+
+	if err := store.UseClick(ctx, "once"); err != nil {
+		t.Errorf("got %v, want the first click counted", err)
+	}
+	if err := store.UseClick(ctx, "once"); err != domain.ErrURLExhausted {
+		t.Errorf("got %v, want ErrURLExhausted", err)
+	}
+	if got, _ := store.GetByOriginalURL(ctx, "https://invite.example.com"); got == nil || got.ShortURL != "pub" {
+		t.Errorf("got %+v, want the limited link left out of dedupe", got)
+	}
+}
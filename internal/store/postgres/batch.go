@@ -0,0 +1,245 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"goprl/internal/domain"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// One statement per step whatever the batch size. Conflicting rows are
+// skipped rather than aborting the insert, the codes that were taken tell
+// the two unique indexes apart afterwards.
+const (
+	releaseHashesQuery = `UPDATE urls u SET url_hash = NULL FROM unnest($1::text[], $2::bytea[]) AS r(owner, url_hash)
+		WHERE u.owner = r.owner AND u.url_hash = r.url_hash AND u.expires_at <= NOW()`
+	// unnest flattens a text[][], so each link's tags travel as one JSON array.
+	// Activation times travel as text, empty for links that are live at once.
+	insertURLsQuery = `INSERT INTO urls (short_code, original_url, expires_at, owner, url_hash, created_at, tags, metadata, password_hash, max_clicks, clicks, activates_at, fallback_url, rules)
+		SELECT r.short_code, r.original_url, r.expires_at, r.owner, r.url_hash, r.created_at,
+			ARRAY(SELECT jsonb_array_elements_text(r.tags)), r.metadata, r.password_hash, r.max_clicks, r.clicks,
+			NULLIF(r.activates_at, '')::timestamptz, r.fallback_url, r.rules
+		FROM unnest($1::text[], $2::text[], $3::timestamptz[], $4::text[], $5::bytea[], $6::timestamptz[], $7::jsonb[], $8::jsonb[], $9::text[], $10::bigint[], $11::bigint[], $12::text[], $13::text[], $14::jsonb[])
+			AS r(short_code, original_url, expires_at, owner, url_hash, created_at, tags, metadata, password_hash, max_clicks, clicks, activates_at, fallback_url, rules)
+		ON CONFLICT DO NOTHING RETURNING id, short_code, created_at`
+	takenCodesQuery = `SELECT short_code FROM urls WHERE short_code = ANY($1)`
+)
+
+// Each column holds one entry per link sent, index maps it back to the
+// batch. A code repeated within the batch is only sent once, dups holds the
+// positions of the later occurrences.
+type batchColumns struct {
+	index     []int
+	dups      []int
+	codes     []string
+	originals []string
+	expires   []time.Time
+	owners    []string
+	hashes    [][]byte
+	created   []time.Time
+	tags      []string
+	metadata  []string
+	passwords []string
+	maxClicks []int64
+	clicks    []int64
+	activates []string
+	fallbacks []string
+	rules     []string
+}
+
+func newBatchColumns(urls []*domain.URL) (batchColumns, error) {
+	var c batchColumns
+	seen := make(map[string]bool)
+	for i, url := range urls {
+		if seen[url.ShortURL] {
+			c.dups = append(c.dups, i)
+			continue
+		}
+		seen[url.ShortURL] = true
+		c.index = append(c.index, i)
+		tags, err := json.Marshal(tagsParam(url.Tags))
+		if err != nil {
+			return c, err
+		}
+		metadata, err := metadataParam(url.Metadata)
+		if err != nil {
+			return c, err
+		}
+		c.tags = append(c.tags, string(tags))
+		c.metadata = append(c.metadata, metadata)
+		rules, err := rulesParam(url.Rules)
+		if err != nil {
+			return c, err
+		}
+		c.rules = append(c.rules, rules)
+		c.codes = append(c.codes, url.ShortURL)
+		c.originals = append(c.originals, url.OriginalURL)
+		c.expires = append(c.expires, url.ExpiresAt)
+		c.owners = append(c.owners, url.Owner)
+		c.hashes = append(c.hashes, linkHash(url))
+		c.passwords = append(c.passwords, url.PasswordHash)
+		c.maxClicks = append(c.maxClicks, url.MaxClicks)
+		c.clicks = append(c.clicks, url.Clicks)
+		c.fallbacks = append(c.fallbacks, url.FallbackURL)
+		activatesAt := ""
+		if !url.ActivatesAt.IsZero() {
+			activatesAt = url.ActivatesAt.UTC().Format(time.RFC3339Nano)
+		}
+		c.activates = append(c.activates, activatesAt)
+		// Imports keep their original creation time
+		createdAt := url.CreatedAt
+		if createdAt.IsZero() {
+			createdAt = time.Now()
+		}
+		c.created = append(c.created, createdAt)
+	}
+	return c, nil
+}
+
+type inserted struct {
+	id        int64
+	createdAt time.Time
+}
+
+// Fills in the inserted links and reports why the others were skipped. The
+// codes sent are distinct, so a returned code names exactly one position.
+func batchErrors(urls []*domain.URL, c batchColumns, rows map[string]inserted, taken map[string]bool) []error {
+	errs := make([]error, len(urls))
+	for _, i := range c.dups {
+		errs[i] = domain.ErrURLAlreadyExists
+	}
+	for k, code := range c.codes {
+		i := c.index[k]
+		if row, ok := rows[code]; ok {
+			urls[i].ID, urls[i].CreatedAt = row.id, row.createdAt
+		} else if taken[code] {
+			errs[i] = domain.ErrURLAlreadyExists
+		} else {
+			errs[i] = domain.ErrOriginalURLExists
+		}
+	}
+	return errs
+}
+
+func missingCodes(codes []string, rows map[string]inserted) []string {
+	var missing []string
+	for _, code := range codes {
+		if _, ok := rows[code]; !ok {
+			missing = append(missing, code)
+		}
+	}
+	return missing
+}
+
+func (s *Store) CreateURLs(ctx context.Context, urls []*domain.URL) ([]error, error) {
+	c, err := newBatchColumns(urls)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, releaseHashesQuery, c.owners, c.hashes); err != nil {
+		return nil, err
+	}
+	rows, err := tx.QueryContext(ctx, insertURLsQuery, c.codes, c.originals, c.expires, c.owners, c.hashes, c.created, c.tags, c.metadata, c.passwords, c.maxClicks, c.clicks, c.activates, c.fallbacks, c.rules)
+	if err != nil {
+		return nil, err
+	}
+	created, err := scanInserted(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	taken := make(map[string]bool)
+	if missing := missingCodes(c.codes, created); len(missing) > 0 {
+		rows, err := tx.QueryContext(ctx, takenCodesQuery, missing)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var code string
+			if err := rows.Scan(&code); err != nil {
+				return nil, err
+			}
+			taken[code] = true
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return batchErrors(urls, c, created, taken), nil
+}
+
+func scanInserted(rows *sql.Rows) (map[string]inserted, error) {
+	defer rows.Close()
+	created := make(map[string]inserted)
+	for rows.Next() {
+		var code string
+		var row inserted
+		if err := rows.Scan(&row.id, &code, &row.createdAt); err != nil {
+			return nil, err
+		}
+		created[code] = row
+	}
+	return created, rows.Err()
+}
+
+func (s *PoolStore) CreateURLs(ctx context.Context, urls []*domain.URL) ([]error, error) {
+	c, err := newBatchColumns(urls)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, releaseHashesQuery, c.owners, c.hashes); err != nil {
+		return nil, err
+	}
+	created := make(map[string]inserted)
+	var code string
+	var row inserted
+	rows, err := tx.Query(ctx, insertURLsQuery, c.codes, c.originals, c.expires, c.owners, c.hashes, c.created, c.tags, c.metadata, c.passwords, c.maxClicks, c.clicks, c.activates, c.fallbacks, c.rules)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := pgx.ForEachRow(rows, []any{&row.id, &code, &row.createdAt}, func() error {
+		created[code] = row
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	taken := make(map[string]bool)
+	if missing := missingCodes(c.codes, created); len(missing) > 0 {
+		rows, err := tx.Query(ctx, takenCodesQuery, missing)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := pgx.ForEachRow(rows, []any{&code}, func() error {
+			taken[code] = true
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return batchErrors(urls, c, created, taken), nil
+}
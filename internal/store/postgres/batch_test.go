@@ -0,0 +1,143 @@
+package postgres
+
+import (
+	"context"
+	"database/sql/driver"
+	"goprl/internal/domain"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// Lets array arguments through the way the pgx driver does
+type passthroughConverter struct{}
+
+func (passthroughConverter) ConvertValue(v any) (driver.Value, error) {
+	return v, nil
+}
+
+func TestCreateURLs(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.ValueConverterOption(passthroughConverter{}))
+	if err != nil {
+		t.Fatalf("failed to open mock sql: %v", err)
+	}
+	defer db.Close()
+	store := NewStore(db)
+
+	expires := time.Now().Add(time.Hour)
+	urls := []*domain.URL{
+		{ShortURL: "a", OriginalURL: "https://a.com/", ExpiresAt: expires, Tags: []string{"spring"}},
+		{ShortURL: "taken", OriginalURL: "https://b.com/", ExpiresAt: expires, ActivatesAt: time.Date(2030, 1, 1, 9, 0, 0, 0, time.UTC), FallbackURL: "https://b.com/soon"},
+		{ShortURL: "c", OriginalURL: "https://dup.com/", ExpiresAt: expires},
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE urls u SET url_hash = NULL FROM unnest").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("INSERT INTO urls .* FROM unnest.* ON CONFLICT DO NOTHING").
+		WithArgs([]string{"a", "taken", "c"}, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(),
+			[]string{`["spring"]`, `[]`, `[]`}, []string{`{}`, `{}`, `{}`}, []string{"", "", ""}, []int64{0, 0, 0}, []int64{0, 0, 0},
+			[]string{"", "2030-01-01T09:00:00Z", ""}, []string{"", "https://b.com/soon", ""}, []string{`[]`, `[]`, `[]`}).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "short_code", "created_at"}).AddRow(7, "a", time.Now()))
+	mock.ExpectQuery("SELECT short_code FROM urls WHERE short_code = ANY").
+		WithArgs([]string{"taken", "c"}).
+		WillReturnRows(sqlmock.NewRows([]string{"short_code"}).AddRow("taken"))
+	mock.ExpectCommit()
+
+	errs, err := store.CreateURLs(context.Background(), urls)
+	if err != nil {
+		t.Fatalf("got error: %v, want nil", err)
+	}
+	if errs[0] != nil || urls[0].ID != 7 {
+		t.Errorf("got %v id %d, want first link inserted as 7", errs[0], urls[0].ID)
+	}
+	if errs[1] != domain.ErrURLAlreadyExists {
+		t.Errorf("got %v, want ErrURLAlreadyExists for a taken code", errs[1])
+	}
+	if errs[2] != domain.ErrOriginalURLExists {
+		t.Errorf("got %v, want ErrOriginalURLExists for a live duplicate", errs[2])
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestCreateURLs_ExpiredAndLiveDuplicate(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.ValueConverterOption(passthroughConverter{}))
+	if err != nil {
+		t.Fatalf("failed to open mock sql: %v", err)
+	}
+	defer db.Close()
+	store := NewStore(db)
+
+	// An export holds the expired link and its live replacement side by side
+	urls := []*domain.URL{
+		{ShortURL: "old", OriginalURL: "https://a.com/", ExpiresAt: time.Now().Add(-time.Hour)},
+		{ShortURL: "new", OriginalURL: "https://a.com/", ExpiresAt: time.Now().Add(time.Hour)},
+	}
+	hashes := [][]byte{nil, urlHash("https://a.com/")}
+
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE urls u SET url_hash = NULL FROM unnest").
+		WithArgs([]string{"", ""}, hashes).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("INSERT INTO urls .* FROM unnest.* ON CONFLICT DO NOTHING").
+		WithArgs([]string{"old", "new"}, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), hashes, sqlmock.AnyArg(),
+			sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(),
+			sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "short_code", "created_at"}).AddRow(1, "old", time.Now()).AddRow(2, "new", time.Now()))
+	mock.ExpectCommit()
+
+	errs, err := store.CreateURLs(context.Background(), urls)
+	if err != nil {
+		t.Fatalf("got error: %v, want nil", err)
+	}
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("link %d: got %v, want both links imported", i, err)
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestCreateURLs_RepeatedCode(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.ValueConverterOption(passthroughConverter{}))
+	if err != nil {
+		t.Fatalf("failed to open mock sql: %v", err)
+	}
+	defer db.Close()
+	store := NewStore(db)
+
+	expires := time.Now().Add(time.Hour)
+	urls := []*domain.URL{
+		{ShortURL: "spring", OriginalURL: "https://a.com/", ExpiresAt: expires},
+		{ShortURL: "spring", OriginalURL: "https://b.com/", ExpiresAt: expires},
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE urls u SET url_hash = NULL FROM unnest").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("INSERT INTO urls .* FROM unnest.* ON CONFLICT DO NOTHING").
+		WithArgs([]string{"spring"}, []string{"https://a.com/"}, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(),
+			sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(),
+			sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "short_code", "created_at"}).AddRow(3, "spring", time.Now()))
+	mock.ExpectCommit()
+
+	errs, err := store.CreateURLs(context.Background(), urls)
+	if err != nil {
+		t.Fatalf("got error: %v, want nil", err)
+	}
+	if errs[0] != nil || urls[0].ID != 3 {
+		t.Errorf("got %v id %d, want the first link inserted as 3", errs[0], urls[0].ID)
+	}
+	if errs[1] != domain.ErrURLAlreadyExists || urls[1].ID != 0 {
+		t.Errorf("got %v id %d, want the repeat rejected", errs[1], urls[1].ID)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
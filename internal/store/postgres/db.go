@@ -2,16 +2,153 @@ package postgres
 
 import (
 	"context"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"goprl/internal/domain"
+	"log/slog"
+	"sync/atomic"
 	"time"
 
 	"github.com/jackc/pgx/v5/pgconn"
 )
 
+// Shared by Store and PoolStore so both drivers run identical SQL
+const (
+	releaseHashQuery   = `UPDATE urls SET url_hash = NULL WHERE owner = $1 AND url_hash = $2 AND expires_at <= NOW()`
+	insertURLQuery     = `INSERT INTO urls (short_code, original_url, expires_at, owner, url_hash, tags, metadata, password_hash, max_clicks, clicks, activates_at, fallback_url, rules) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13) RETURNING id, created_at`
+	byShortURLQuery    = `SELECT ` + resolveColumns + ` FROM urls WHERE short_code = $1`
+	byOriginalURLQuery = `SELECT ` + urlColumns + ` FROM urls WHERE owner = '' AND url_hash = $1 AND expires_at > NOW()`
+	maxIDQuery         = `SELECT COALESCE(MAX(id), 0) FROM urls`
+	listRecentQuery    = `SELECT ` + resolveColumns + ` FROM urls WHERE expires_at > NOW() ORDER BY id DESC LIMIT $1`
+	liveURLsQuery      = `SELECT original_url FROM urls WHERE url_hash IS NOT NULL AND expires_at > NOW()`
+	allURLsQuery       = `SELECT ` + urlColumns + ` FROM urls ORDER BY id`
+	updateURLQuery     = `UPDATE urls SET tags = COALESCE($2, tags), metadata = COALESCE($3::jsonb, metadata) WHERE short_code = $1 RETURNING ` + urlColumns
+	// The row lock makes concurrent clicks queue up, each sees the count the
+	// one before it left
+	useClickQuery = `UPDATE urls SET clicks = clicks + 1 WHERE short_code = $1 AND clicks < max_clicks`
+)
+
+// Every field of a link. Tags and metadata come back as JSON text so both
+// drivers scan them the same way.
+const urlColumns = `id, short_code, original_url, created_at, expires_at, owner, to_jsonb(tags)::text, metadata::text, password_hash, max_clicks, clicks, activates_at, fallback_url, rules::text`
+
+// The fields a redirect needs, read on every cache miss
+const resolveColumns = `id, short_code, original_url, created_at, expires_at, password_hash, max_clicks, clicks, activates_at, fallback_url, rules::text`
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+// Reads a row selected with resolveColumns
+func scanResolved(row scanner) (*domain.URL, error) {
+	var url domain.URL
+	var activatesAt sql.NullTime
+	var rules string
+	if err := row.Scan(&url.ID, &url.ShortURL, &url.OriginalURL, &url.CreatedAt, &url.ExpiresAt, &url.PasswordHash, &url.MaxClicks, &url.Clicks, &activatesAt, &url.FallbackURL, &rules); err != nil {
+		return nil, err
+	}
+	url.ActivatesAt = activatesAt.Time
+	if err := json.Unmarshal([]byte(rules), &url.Rules); err != nil {
+		return nil, err
+	}
+	if len(url.Rules) == 0 {
+		url.Rules = nil
+	}
+	return &url, nil
+}
+
+// Reads a row selected with urlColumns
+func scanURL(row scanner) (*domain.URL, error) {
+	var url domain.URL
+	var tags, metadata, rules string
+	var activatesAt sql.NullTime
+	if err := row.Scan(&url.ID, &url.ShortURL, &url.OriginalURL, &url.CreatedAt, &url.ExpiresAt, &url.Owner, &tags, &metadata, &url.PasswordHash, &url.MaxClicks, &url.Clicks, &activatesAt, &url.FallbackURL, &rules); err != nil {
+		return nil, err
+	}
+	url.ActivatesAt = activatesAt.Time
+	if err := json.Unmarshal([]byte(tags), &url.Tags); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(metadata), &url.Metadata); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(rules), &url.Rules); err != nil {
+		return nil, err
+	}
+	if len(url.Tags) == 0 {
+		url.Tags = nil
+	}
+	if len(url.Metadata) == 0 {
+		url.Metadata = nil
+	}
+	if len(url.Rules) == 0 {
+		url.Rules = nil
+	}
+	return &url, nil
+}
+
+// Protected, limited, scheduled and targeted links are left out of the
+// dedupe index, see domain.URL.Dedupes. So are imported links that have
+// already expired, they would otherwise hold the hash a live one needs.
+func linkHash(url *domain.URL) []byte {
+	if !url.Dedupes() || !url.ExpiresAt.After(time.Now()) {
+		return nil
+	}
+	return urlHash(url.OriginalURL)
+}
+
+// Tags and metadata columns are NOT NULL, a link without them stores empty values
+func tagsParam(tags []string) []string {
+	if tags == nil {
+		return []string{}
+	}
+	return tags
+}
+
+// activates_at is NULL for links that are live from the start
+func activatesParam(activatesAt time.Time) any {
+	if activatesAt.IsZero() {
+		return nil
+	}
+	return activatesAt
+}
+
+func metadataParam(metadata map[string]any) (string, error) {
+	if metadata == nil {
+		return "{}", nil
+	}
+	data, err := json.Marshal(metadata)
+	return string(data), err
+}
+
+func rulesParam(rules []domain.Rule) (string, error) {
+	if rules == nil {
+		return "[]", nil
+	}
+	data, err := json.Marshal(rules)
+	return string(data), err
+}
+
+// Nil parameters leave the column alone in updateURLQuery
+func updateParams(update domain.URLUpdate) (tags, metadata any, err error) {
+	if update.Tags != nil {
+		tags = update.Tags
+	}
+	if update.Metadata != nil {
+		metadata, err = metadataParam(update.Metadata)
+	}
+	return tags, metadata, err
+}
+
 type Store struct {
-	db *sql.DB
+	db             *sql.DB
+	replicas       []*replica
+	maxLag         time.Duration
+	replicaTimeout time.Duration
+	next           atomic.Uint64
+	logger         *slog.Logger
 }
 
 func NewStore(db *sql.DB) *Store {
@@ -19,31 +156,64 @@ func NewStore(db *sql.DB) *Store {
 }
 
 func (s *Store) Close() error {
+	for _, r := range s.replicas {
+		r.db.Close()
+	}
 	return s.db.Close()
 }
 
+// CreateURL inserts the link. An expired link for the same URL gives up its
+// hash first so the unique index only ever covers live links.
 func (s *Store) CreateURL(ctx context.Context, url *domain.URL) error {
-	query := `INSERT INTO urls (short_code, original_url, expires_at) VALUES ($1, $2, $3) RETURNING id, created_at`
-	row := s.db.QueryRowContext(ctx, query, url.ShortURL, url.OriginalURL, url.ExpiresAt)
-	err := row.Scan(&url.ID, &url.CreatedAt)
-
+	hash := linkHash(url)
+	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
-		var pgErr *pgconn.PgError
-		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
-			return domain.ErrURLAlreadyExists
+		return err
+	}
+	defer tx.Rollback()
+
+	if hash != nil {
+		if _, err := tx.ExecContext(ctx, releaseHashQuery, url.Owner, hash); err != nil {
+			return err
 		}
+	}
+
+	metadata, err := metadataParam(url.Metadata)
+	if err != nil {
 		return err
 	}
+	rules, err := rulesParam(url.Rules)
+	if err != nil {
+		return err
+	}
+	row := tx.QueryRowContext(ctx, insertURLQuery, url.ShortURL, url.OriginalURL, url.ExpiresAt, url.Owner, hash, tagsParam(url.Tags), metadata, url.PasswordHash, url.MaxClicks, url.Clicks, activatesParam(url.ActivatesAt), url.FallbackURL, rules)
+	if err := row.Scan(&url.ID, &url.CreatedAt); err != nil {
+		return insertError(err)
+	}
 
-	return nil
+	return tx.Commit()
+}
+
+// Maps unique violations onto the domain errors the service retries or resolves
+func insertError(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		if pgErr.ConstraintName == "idx_urls_owner_url_hash" {
+			return domain.ErrOriginalURLExists
+		}
+		return domain.ErrURLAlreadyExists
+	}
+	return err
 }
 
 func (s *Store) GetByShortURL(ctx context.Context, ShortURL string) (*domain.URL, error) {
-	query := `SELECT id, short_code, original_url, created_at, expires_at FROM urls WHERE short_code = $1`
-	row := s.db.QueryRowContext(ctx, query, ShortURL)
+	return s.read(ctx, func(ctx context.Context, db *sql.DB) (*domain.URL, error) {
+		return getByShortURL(ctx, db, ShortURL)
+	})
+}
 
-	var url domain.URL
-	err := row.Scan(&url.ID, &url.ShortURL, &url.OriginalURL, &url.CreatedAt, &url.ExpiresAt)
+func getByShortURL(ctx context.Context, db *sql.DB, ShortURL string) (*domain.URL, error) {
+	url, err := scanResolved(db.QueryRowContext(ctx, byShortURLQuery, ShortURL))
 
 	if err != nil && !errors.Is(err, sql.ErrNoRows) {
 		return nil, err
@@ -57,30 +227,28 @@ func (s *Store) GetByShortURL(ctx context.Context, ShortURL string) (*domain.URL
 		return nil, domain.ErrURLExpired
 	}
 
-	return &url, nil
+	return url, nil
 }
 
+// Looks up the live link for a URL through the hashed index, expired links
+// are skipped so the caller issues a fresh code. Links created through the
+// public API have no owner.
 func (s *Store) GetByOriginalURL(ctx context.Context, originalURL string) (*domain.URL, error) {
-	query := `SELECT id, short_code, original_url, created_at, expires_at FROM urls WHERE original_url = $1`
-	row := s.db.QueryRowContext(ctx, query, originalURL)
-
-	var url domain.URL
-	err := row.Scan(&url.ID, &url.ShortURL, &url.OriginalURL, &url.CreatedAt, &url.ExpiresAt)
-
-	if err != nil && !errors.Is(err, sql.ErrNoRows) {
-		return nil, err
-	}
+	return s.read(ctx, func(ctx context.Context, db *sql.DB) (*domain.URL, error) {
+		return getByOriginalURL(ctx, db, originalURL)
+	})
+}
 
+func getByOriginalURL(ctx context.Context, db *sql.DB, originalURL string) (*domain.URL, error) {
+	url, err := scanURL(db.QueryRowContext(ctx, byOriginalURLQuery, urlHash(originalURL)))
 	if errors.Is(err, sql.ErrNoRows) {
 		return nil, domain.ErrURLNotFound
 	}
-
-	return &url, nil
+	return url, err
 }
 
 func (s *Store) GetMaxID(ctx context.Context) (int64, error) {
-	query := `SELECT MAX(id) FROM urls`
-	row := s.db.QueryRowContext(ctx, query)
+	row := s.db.QueryRowContext(ctx, maxIDQuery)
 	var maxID int64
 	err := row.Scan(&maxID)
 	if err != nil {
@@ -88,3 +256,95 @@ func (s *Store) GetMaxID(ctx context.Context) (int64, error) {
 	}
 	return maxID, nil
 }
+
+// Newest live links first, used to warm the cache on startup
+func (s *Store) ListRecent(ctx context.Context, limit int) ([]*domain.URL, error) {
+	rows, err := s.db.QueryContext(ctx, listRecentQuery, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var urls []*domain.URL
+	for rows.Next() {
+		url, err := scanResolved(rows)
+		if err != nil {
+			return nil, err
+		}
+		urls = append(urls, url)
+	}
+	return urls, rows.Err()
+}
+
+// Streams the original URL of every live link in the dedupe index, used to
+// rebuild the bloom filter
+func (s *Store) EachOriginalURL(ctx context.Context, fn func(originalURL string)) error {
+	rows, err := s.db.QueryContext(ctx, liveURLsQuery)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var originalURL string
+		if err := rows.Scan(&originalURL); err != nil {
+			return err
+		}
+		fn(originalURL)
+	}
+	return rows.Err()
+}
+
+func (s *Store) EachURL(ctx context.Context, fn func(url *domain.URL) error) error {
+	rows, err := s.db.QueryContext(ctx, allURLsQuery)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		url, err := scanURL(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(url); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (s *Store) UpdateURL(ctx context.Context, code string, update domain.URLUpdate) (*domain.URL, error) {
+	tags, metadata, err := updateParams(update)
+	if err != nil {
+		return nil, err
+	}
+	url, err := scanURL(s.db.QueryRowContext(ctx, updateURLQuery, code, tags, metadata))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.ErrURLNotFound
+	}
+	return url, err
+}
+
+// Always on the primary, replicas can't take writes and may lag behind the
+// count. No row updated means the budget is spent.
+func (s *Store) UseClick(ctx context.Context, code string) error {
+	res, err := s.db.ExecContext(ctx, useClickQuery, code)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return domain.ErrURLExhausted
+	}
+	return nil
+}
+
+// Fixed 32 bytes whatever the URL length, keeps the unique index small
+func urlHash(originalURL string) []byte {
+	sum := sha256.Sum256([]byte(domain.CanonicalURL(originalURL)))
+	return sum[:]
+}
@@ -2,11 +2,13 @@ package postgres
 
 import (
 	"context"
+	"database/sql"
 	"goprl/internal/domain"
 	"testing"
 	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jackc/pgx/v5/pgconn"
 )
 
 func TestGetByShortURL(t *testing.T) {
@@ -19,10 +21,10 @@ func TestGetByShortURL(t *testing.T) {
 	store := NewStore(db)
 	ctx := context.Background()
 
-	rows := sqlmock.NewRows([]string{"id", "short_code", "original_url", "created_at", "expires_at"}).
-		AddRow(1, "abc", "https://google.com", time.Now(), time.Now().Add(24*time.Hour))
+	rows := sqlmock.NewRows([]string{"id", "short_code", "original_url", "created_at", "expires_at", "password_hash", "max_clicks", "clicks", "activates_at", "fallback_url", "rules"}).
+		AddRow(1, "abc", "https://google.com", time.Now(), time.Now().Add(24*time.Hour), "", 0, 0, nil, "", `[]`)
 
-	mock.ExpectQuery("SELECT id, short_code, original_url, created_at, expires_at FROM urls WHERE short_code = \\$1").
+	mock.ExpectQuery("SELECT id, short_code, original_url, created_at, expires_at, password_hash, max_clicks, clicks, activates_at, fallback_url, rules::text FROM urls WHERE short_code = \\$1").
 		WithArgs("abc").
 		WillReturnRows(rows)
 
@@ -36,6 +38,31 @@ func TestGetByShortURL(t *testing.T) {
 	}
 }
 
+func TestGetByShortURL_RedirectOptions(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open mock sql: %v", err)
+	}
+	defer db.Close()
+
+	store := NewStore(db)
+	launch := time.Now().Add(time.Hour).Truncate(time.Second)
+	rows := sqlmock.NewRows([]string{"id", "short_code", "original_url", "created_at", "expires_at", "password_hash", "max_clicks", "clicks", "activates_at", "fallback_url", "rules"}).
+		AddRow(1, "abc", "https://google.com", time.Now(), time.Now().Add(24*time.Hour), "", 0, 0, launch, "https://google.com/soon", `[{"os":"ios","url":"https://apps.apple.com/app/id1"}]`)
+	mock.ExpectQuery("SELECT id, short_code").WithArgs("abc").WillReturnRows(rows)
+
+	url, err := store.GetByShortURL(context.Background(), "abc")
+	if err != nil {
+		t.Fatalf("got error: %v, want nil", err)
+	}
+	if !url.ActivatesAt.Equal(launch) || url.FallbackURL != "https://google.com/soon" {
+		t.Errorf("got activates_at %v fallback %q, want %v and the fallback", url.ActivatesAt, url.FallbackURL, launch)
+	}
+	if len(url.Rules) != 1 || url.Rules[0].OS != "ios" || url.Rules[0].URL != "https://apps.apple.com/app/id1" {
+		t.Errorf("got rules %+v, want the ios rule decoded", url.Rules)
+	}
+}
+
 func TestGetByOriginalURL(t *testing.T) {
 	db, mock, err := sqlmock.New()
 	if err != nil {
@@ -46,11 +73,11 @@ func TestGetByOriginalURL(t *testing.T) {
 	store := NewStore(db)
 	ctx := context.Background()
 
-	rows := sqlmock.NewRows([]string{"id", "short_code", "original_url", "created_at", "expires_at"}).
-		AddRow(1, "abc", "https://google.com", time.Now(), time.Now().Add(24*time.Hour))
+	rows := sqlmock.NewRows([]string{"id", "short_code", "original_url", "created_at", "expires_at", "owner", "tags", "metadata", "password_hash", "max_clicks", "clicks", "activates_at", "fallback_url", "rules"}).
+		AddRow(1, "abc", "https://google.com", time.Now(), time.Now().Add(24*time.Hour), "", `["spring"]`, `{"campaign":"q2"}`, "", 0, 0, nil, "", `[]`)
 
-	mock.ExpectQuery("SELECT id, short_code, original_url, created_at, expires_at FROM urls WHERE original_url = \\$1").
-		WithArgs("https://google.com").
+	mock.ExpectQuery("SELECT id, .*, metadata::text, password_hash, max_clicks, clicks, activates_at, fallback_url, rules::text FROM urls WHERE owner = '' AND url_hash = \\$1 AND expires_at > NOW\\(\\)").
+		WithArgs(urlHash("https://GOOGLE.com/#top")).
 		WillReturnRows(rows)
 
 	url, err := store.GetByOriginalURL(ctx, "https://google.com")
@@ -61,9 +88,12 @@ func TestGetByOriginalURL(t *testing.T) {
 	if url.ShortURL != "abc" {
 		t.Errorf("got %s, want abc", url.ShortURL)
 	}
+	if len(url.Tags) != 1 || url.Tags[0] != "spring" || url.Metadata["campaign"] != "q2" {
+		t.Errorf("got tags %v metadata %v, want both decoded", url.Tags, url.Metadata)
+	}
 }
 func TestCreateURL(t *testing.T) {
-	db, mock, err := sqlmock.New()
+	db, mock, err := sqlmock.New(sqlmock.ValueConverterOption(passthroughConverter{}))
 	if err != nil {
 		t.Fatalf("failed to open mock sql: %v", err)
 	}
@@ -76,9 +106,14 @@ func TestCreateURL(t *testing.T) {
 		AddRow(1, time.Now())
 
 	expiry := time.Now().Add(24 * time.Hour)
-	mock.ExpectQuery("INSERT INTO urls \\(short_code, original_url, expires_at\\) VALUES \\(\\$1, \\$2, \\$3\\) RETURNING id, created_at").
-		WithArgs("abc", "https://google.com", expiry).
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE urls SET url_hash = NULL WHERE owner = \\$1 AND url_hash = \\$2 AND expires_at <= NOW\\(\\)").
+		WithArgs("", urlHash("https://google.com")).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("INSERT INTO urls \\(short_code, original_url, expires_at, owner, url_hash, tags, metadata, password_hash, max_clicks, clicks, activates_at, fallback_url, rules\\) VALUES \\(\\$1, \\$2, \\$3, \\$4, \\$5, \\$6, \\$7, \\$8, \\$9, \\$10, \\$11, \\$12, \\$13\\) RETURNING id, created_at").
+		WithArgs("abc", "https://google.com", expiry, "", urlHash("https://google.com"), []string{}, "{}", "", int64(0), int64(0), nil, "", "[]").
 		WillReturnRows(rows)
+	mock.ExpectCommit()
 
 	mockURL := &domain.URL{
 		ShortURL:    "abc",
@@ -92,4 +127,174 @@ func TestCreateURL(t *testing.T) {
 	if err != nil {
 		t.Errorf("got error: %v, want nil", err)
 	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+// Protected links skip the dedupe index entirely
+func TestCreateURL_Protected(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.ValueConverterOption(passthroughConverter{}))
+	if err != nil {
+		t.Fatalf("failed to open mock sql: %v", err)
+	}
+	defer db.Close()
+
+	store := NewStore(db)
+	expiry := time.Now().Add(time.Hour)
+	mock.ExpectBegin()
+	mock.ExpectQuery("INSERT INTO urls").
+		WithArgs("abc", "https://google.com", expiry, "", []byte(nil), []string{}, "{}", "pbkdf2-sha256$1$c2FsdA$a2V5", int64(0), int64(0), nil, "", "[]").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(1, time.Now()))
+	mock.ExpectCommit()
+
+	err = store.CreateURL(context.Background(), &domain.URL{ShortURL: "abc", OriginalURL: "https://google.com", ExpiresAt: expiry,
+		PasswordHash: "pbkdf2-sha256$1$c2FsdA$a2V5"})
+	if err != nil {
+		t.Errorf("got error: %v, want nil", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestCreateURL_Conflicts(t *testing.T) {
+	tests := []struct {
+		constraint string
+		want       error
+	}{
+		{"urls_short_code_key", domain.ErrURLAlreadyExists},
+		{"idx_urls_owner_url_hash", domain.ErrOriginalURLExists},
+	}
+	for _, tt := range tests {
+		t.Run(tt.constraint, func(t *testing.T) {
+			db, mock, err := sqlmock.New(sqlmock.ValueConverterOption(passthroughConverter{}))
+			if err != nil {
+				t.Fatalf("failed to open mock sql: %v", err)
+			}
+			defer db.Close()
+
+			store := NewStore(db)
+			mock.ExpectBegin()
+			mock.ExpectExec("UPDATE urls SET url_hash = NULL").WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectQuery("INSERT INTO urls").WillReturnError(&pgconn.PgError{Code: "23505", ConstraintName: tt.constraint})
+			mock.ExpectRollback()
+
+			err = store.CreateURL(context.Background(), &domain.URL{ShortURL: "abc", OriginalURL: "https://google.com", ExpiresAt: time.Now().Add(time.Hour)})
+
+			if err != tt.want {
+				t.Errorf("got error: %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestListRecent(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open mock sql: %v", err)
+	}
+	defer db.Close()
+
+	store := NewStore(db)
+	ctx := context.Background()
+
+	rows := sqlmock.NewRows([]string{"id", "short_code", "original_url", "created_at", "expires_at", "password_hash", "max_clicks", "clicks", "activates_at", "fallback_url", "rules"}).
+		AddRow(2, "abd", "https://yahoo.com", time.Now(), time.Now().Add(24*time.Hour), "", 0, 0, nil, "", `[]`).
+		AddRow(1, "abc", "https://google.com", time.Now(), time.Now().Add(24*time.Hour), "", 0, 0, nil, "", `[]`)
+
+	mock.ExpectQuery("SELECT id, short_code, original_url, created_at, expires_at, password_hash, max_clicks, clicks, activates_at, fallback_url, rules::text FROM urls WHERE expires_at > NOW\\(\\) ORDER BY id DESC LIMIT \\$1").
+		WithArgs(2).
+		WillReturnRows(rows)
+
+	urls, err := store.ListRecent(ctx, 2)
+
+	if err != nil {
+		t.Errorf("got error: %v, want nil", err)
+	}
+	if len(urls) != 2 || urls[0].ShortURL != "abd" {
+		t.Errorf("got %v, want newest first", urls)
+	}
+}
+
+func TestEachOriginalURL(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open mock sql: %v", err)
+	}
+	defer db.Close()
+
+	store := NewStore(db)
+	ctx := context.Background()
+
+	rows := sqlmock.NewRows([]string{"original_url"}).
+		AddRow("https://google.com").
+		AddRow("https://yahoo.com")
+
+	mock.ExpectQuery("SELECT original_url FROM urls WHERE url_hash IS NOT NULL AND expires_at > NOW\\(\\)").
+		WillReturnRows(rows)
+
+	var got []string
+	err = store.EachOriginalURL(ctx, func(originalURL string) {
+		got = append(got, originalURL)
+	})
+
+	if err != nil {
+		t.Errorf("got error: %v, want nil", err)
+	}
+	if len(got) != 2 {
+		t.Errorf("got %v, want 2 urls", got)
+	}
+}
+
+func TestUpdateURL(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.ValueConverterOption(passthroughConverter{}))
+	if err != nil {
+		t.Fatalf("failed to open mock sql: %v", err)
+	}
+	defer db.Close()
+	store := NewStore(db)
+
+	rows := sqlmock.NewRows([]string{"id", "short_code", "original_url", "created_at", "expires_at", "owner", "tags", "metadata", "password_hash", "max_clicks", "clicks", "activates_at", "fallback_url", "rules"}).
+		AddRow(1, "abc", "https://google.com", time.Now(), time.Now().Add(time.Hour), "", `["q2"]`, `{}`, "", 0, 0, nil, "", `[]`)
+	// Metadata left out of the update goes through as NULL so COALESCE keeps it
+	mock.ExpectQuery("UPDATE urls SET tags = COALESCE\\(\\$2, tags\\), metadata = COALESCE\\(\\$3::jsonb, metadata\\) WHERE short_code = \\$1").
+		WithArgs("abc", []string{"q2"}, nil).
+		WillReturnRows(rows)
+	mock.ExpectQuery("UPDATE urls").WithArgs("missing", nil, nil).WillReturnError(sql.ErrNoRows)
+
+	url, err := store.UpdateURL(context.Background(), "abc", domain.URLUpdate{Tags: []string{"q2"}})
+	if err != nil || len(url.Tags) != 1 || url.Metadata != nil {
+		t.Errorf("got %+v, %v, want the updated link", url, err)
+	}
+	if _, err := store.UpdateURL(context.Background(), "missing", domain.URLUpdate{}); err != domain.ErrURLNotFound {
+		t.Errorf("got %v, want ErrURLNotFound", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestUseClick(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open mock sql: %v", err)
+	}
+	defer db.Close()
+	store := NewStore(db)
+
+	mock.ExpectExec("UPDATE urls SET clicks = clicks \\+ 1 WHERE short_code = \\$1 AND clicks < max_clicks").
+		WithArgs("abc").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE urls SET clicks").WithArgs("abc").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	if err := store.UseClick(context.Background(), "abc"); err != nil {
+		t.Errorf("got error: %v, want nil", err)
+	}
+	if err := store.UseClick(context.Background(), "abc"); err != domain.ErrURLExhausted {
+		t.Errorf("got %v, want ErrURLExhausted once no row is left to update", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
 }
@@ -0,0 +1,96 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"goprl/internal/domain"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Same expression as idx_urls_host, see migration 0004
+const urlHostExpr = `lower(substring(original_url from '^[a-zA-Z][a-zA-Z0-9+.-]*://(?:[^/?#@]*@)?([^/?#:]+)'))`
+
+// Builds the listing query for both drivers. Every condition is optional so
+// the SQL is assembled rather than one fixed statement.
+func listQuery(f domain.ListFilter) (string, []any) {
+	var where []string
+	var args []any
+	add := func(cond string, arg any) {
+		args = append(args, arg)
+		where = append(where, fmt.Sprintf(cond, len(args)))
+	}
+	if f.Before > 0 {
+		add("id < $%d", f.Before)
+	}
+	if f.Owner != "" {
+		add("owner = $%d", f.Owner)
+	}
+	if !f.CreatedFrom.IsZero() {
+		add("created_at >= $%d", f.CreatedFrom)
+	}
+	if !f.CreatedTo.IsZero() {
+		add("created_at < $%d", f.CreatedTo)
+	}
+	switch f.Status {
+	case domain.StatusLive:
+		where = append(where, "expires_at > NOW()")
+	case domain.StatusExpired:
+		where = append(where, "expires_at <= NOW()")
+	}
+	if f.Domain != "" {
+		add(urlHostExpr+" = $%d", strings.ToLower(f.Domain))
+	}
+	if f.Search != "" {
+		add(`original_url ILIKE $%d ESCAPE '\'`, "%"+escapeLike(f.Search)+"%")
+	}
+	if len(f.Tags) > 0 {
+		add("tags @> $%d::text[]", f.Tags)
+	}
+
+	query := "SELECT " + urlColumns + " FROM urls"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	args = append(args, f.Limit)
+	return query + fmt.Sprintf(" ORDER BY id DESC LIMIT $%d", len(args)), args
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func escapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
+
+// Listing stays on the primary, pages read from a lagging replica could skip
+// links the previous page promised
+func (s *Store) ListURLs(ctx context.Context, filter domain.ListFilter) ([]*domain.URL, error) {
+	query, args := listQuery(filter)
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var urls []*domain.URL
+	for rows.Next() {
+		url, err := scanURL(rows)
+		if err != nil {
+			return nil, err
+		}
+		urls = append(urls, url)
+	}
+	return urls, rows.Err()
+}
+
+func (s *PoolStore) ListURLs(ctx context.Context, filter domain.ListFilter) ([]*domain.URL, error) {
+	query, args := listQuery(filter)
+	rows, err := s.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (*domain.URL, error) {
+		return scanURL(row)
+	})
+}
@@ -0,0 +1,34 @@
+package postgres
+
+import (
+	"goprl/internal/domain"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestListQuery(t *testing.T) {
+	query, args := listQuery(domain.ListFilter{Limit: 20})
+	if strings.Contains(query, "WHERE") || len(args) != 1 || args[0] != 20 {
+		t.Errorf("got %q %v, want an unfiltered query with only the limit", query, args)
+	}
+
+	from := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	query, args = listQuery(domain.ListFilter{
+		Before:      42,
+		Owner:       "team",
+		CreatedFrom: from,
+		Status:      domain.StatusExpired,
+		Domain:      "Example.COM",
+		Search:      "50%_off",
+		Limit:       10,
+	})
+	for _, want := range []string{"id < $1", "owner = $2", "created_at >= $3", "expires_at <= NOW()", urlHostExpr + " = $4", "original_url ILIKE $5", "LIMIT $6"} {
+		if !strings.Contains(query, want) {
+			t.Errorf("got %q, want it to contain %q", query, want)
+		}
+	}
+	if args[3] != "example.com" || args[4] != `%50\%\_off%` {
+		t.Errorf("got %v, want the domain lowercased and the search escaped", args)
+	}
+}
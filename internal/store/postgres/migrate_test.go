@@ -0,0 +1,127 @@
+package postgres
+
+import (
+	"context"
+	"testing"
+	"testing/fstest"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/0002_add_index.up.sql":      {Data: []byte("CREATE INDEX")},
+		"migrations/0001_create_urls.up.sql":    {Data: []byte("CREATE TABLE")},
+		"migrations/0001_create_urls.down.sql":  {Data: []byte("DROP TABLE")},
+		"migrations/0010_later_change.up.sql":   {Data: []byte("ALTER TABLE")},
+		"migrations/0010_later_change.down.sql": {Data: []byte("ALTER TABLE")},
+	}
+	migrations, err := LoadMigrations(fsys)
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	if len(migrations) != 3 {
+		t.Fatalf("got %d migrations, want 3", len(migrations))
+	}
+	for i, want := range []int{1, 2, 10} {
+		if migrations[i].Version != want {
+			t.Errorf("got version %d at %d, want %d", migrations[i].Version, i, want)
+		}
+	}
+	if migrations[0].Down != "DROP TABLE" || migrations[1].Down != "" {
+		t.Errorf("got down scripts %q %q", migrations[0].Down, migrations[1].Down)
+	}
+
+	invalid := []fstest.MapFS{
+		{"migrations/abc_name.up.sql": {}},
+		{"migrations/0001_name.sideways.sql": {}},
+		{"migrations/0001_name.down.sql": {Data: []byte("DROP TABLE")}},
+		{"migrations/0001_a.up.sql": {Data: []byte("x")}, "migrations/0001_b.up.sql": {Data: []byte("y")}},
+	}
+	for _, fsys := range invalid {
+		if _, err := LoadMigrations(fsys); err == nil {
+			t.Errorf("expected error for %v, but got nil", fsys)
+		}
+	}
+}
+
+func TestEmbeddedMigrations(t *testing.T) {
+	migrations, err := LoadMigrations(migrationFiles)
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			t.Errorf("got version %d, want contiguous versions from 1", m.Version)
+		}
+		if m.Down == "" {
+			t.Errorf("migration %s has no down script", m.Name)
+		}
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open mock sql: %v", err)
+	}
+	defer db.Close()
+
+	store := NewStore(db)
+	ctx := context.Background()
+	migrations, _ := LoadMigrations(migrationFiles)
+
+	mock.ExpectExec("SELECT pg_advisory_lock").WithArgs(migrationLockID).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS schema_migrations").WillReturnResult(sqlmock.NewResult(0, 0))
+	// Only the first migration already applied
+	mock.ExpectQuery("SELECT version FROM schema_migrations").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(1))
+	for _, m := range migrations[1:] {
+		mock.ExpectBegin()
+		mock.ExpectExec(".+").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("INSERT INTO schema_migrations").WithArgs(m.Version, m.Name).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+	}
+	mock.ExpectExec("SELECT pg_advisory_unlock").WithArgs(migrationLockID).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	applied, err := store.Migrate(ctx)
+	if err != nil {
+		t.Fatalf("got error: %v, want nil", err)
+	}
+	if applied != len(migrations)-1 {
+		t.Errorf("got %d applied, want %d", applied, len(migrations)-1)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestRollback(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open mock sql: %v", err)
+	}
+	defer db.Close()
+
+	store := NewStore(db)
+	ctx := context.Background()
+
+	mock.ExpectExec("SELECT pg_advisory_lock").WithArgs(migrationLockID).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS schema_migrations").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT version FROM schema_migrations").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(1))
+	mock.ExpectBegin()
+	mock.ExpectExec("DROP TABLE IF EXISTS urls").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DELETE FROM schema_migrations WHERE version = \\$1").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectExec("SELECT pg_advisory_unlock").WithArgs(migrationLockID).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	reverted, err := store.Rollback(ctx, 5)
+	if err != nil {
+		t.Fatalf("got error: %v, want nil", err)
+	}
+	if reverted != 1 {
+		t.Errorf("got %d reverted, want 1", reverted)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
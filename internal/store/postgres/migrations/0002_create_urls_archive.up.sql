@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS urls_archive (
+    id BIGINT PRIMARY KEY,
+    short_code TEXT NOT NULL,
+    original_url TEXT NOT NULL,
+    created_at TIMESTAMPTZ,
+    expires_at TIMESTAMPTZ,
+    archived_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Lets the reaper find expired rows without scanning the table
+CREATE INDEX IF NOT EXISTS idx_urls_expires_at ON urls(expires_at);
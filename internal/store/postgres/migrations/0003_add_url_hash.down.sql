@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_urls_owner_url_hash;
+ALTER TABLE urls DROP COLUMN IF EXISTS url_hash;
+ALTER TABLE urls DROP COLUMN IF EXISTS owner;
@@ -0,0 +1,20 @@
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS owner TEXT NOT NULL DEFAULT '';
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS url_hash BYTEA;
+
+-- The expression mirrors domain.CanonicalURL for URLs validateUrl produced
+-- (fragment dropped, empty path becomes "/"), rows with mixed case hosts or
+-- default ports just miss dedupe. Only the newest live row per hash keeps it,
+-- older duplicates from before the index existed would otherwise violate it.
+WITH hashed AS (
+    SELECT id, owner, sha256(convert_to(
+        regexp_replace(regexp_replace(original_url, '#.*$', ''), '^([a-z]+://[^/?#]+)(\?|$)', '\1/\2'),
+        'UTF8')) AS hash
+    FROM urls
+    WHERE expires_at > NOW()
+), newest AS (
+    SELECT DISTINCT ON (owner, hash) id, hash FROM hashed
+    ORDER BY owner, hash, id DESC
+)
+UPDATE urls SET url_hash = newest.hash FROM newest WHERE urls.id = newest.id;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_urls_owner_url_hash ON urls(owner, url_hash);
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_urls_original_url_trgm;
+DROP INDEX IF EXISTS idx_urls_host;
+DROP INDEX IF EXISTS idx_urls_created_at;
+DROP INDEX IF EXISTS idx_urls_owner_id;
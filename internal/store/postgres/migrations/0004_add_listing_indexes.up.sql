@@ -0,0 +1,9 @@
+-- Backs GET /api/urls. The host expression must match urlHostExpr in list.go
+-- exactly or the planner won't use the index.
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+CREATE INDEX IF NOT EXISTS idx_urls_owner_id ON urls(owner, id);
+CREATE INDEX IF NOT EXISTS idx_urls_created_at ON urls(created_at);
+CREATE INDEX IF NOT EXISTS idx_urls_host ON urls(lower(substring(original_url from '^[a-zA-Z][a-zA-Z0-9+.-]*://(?:[^/?#@]*@)?([^/?#:]+)')));
+-- ILIKE '%term%' can't use a btree, trigrams cover substring search
+CREATE INDEX IF NOT EXISTS idx_urls_original_url_trgm ON urls USING GIN (original_url gin_trgm_ops);
@@ -0,0 +1,5 @@
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS tags TEXT[] NOT NULL DEFAULT '{}';
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS metadata JSONB NOT NULL DEFAULT '{}';
+
+-- Serves tags @> ARRAY[...] in listings
+CREATE INDEX IF NOT EXISTS idx_urls_tags ON urls USING GIN (tags);
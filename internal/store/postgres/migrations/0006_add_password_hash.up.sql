@@ -0,0 +1,2 @@
+-- Empty for public links, otherwise a passcode.Hash value
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS password_hash TEXT NOT NULL DEFAULT '';
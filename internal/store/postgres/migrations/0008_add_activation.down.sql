@@ -0,0 +1,2 @@
+ALTER TABLE urls DROP COLUMN IF EXISTS fallback_url;
+ALTER TABLE urls DROP COLUMN IF EXISTS activates_at;
@@ -0,0 +1,3 @@
+-- NULL for links that are live from the start
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS activates_at TIMESTAMPTZ;
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS fallback_url TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,2 @@
+-- Ordered redirect rules as a JSON array, see domain.Rule
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS rules JSONB NOT NULL DEFAULT '[]';
@@ -0,0 +1,9 @@
+ALTER TABLE urls_archive DROP COLUMN IF EXISTS rules;
+ALTER TABLE urls_archive DROP COLUMN IF EXISTS fallback_url;
+ALTER TABLE urls_archive DROP COLUMN IF EXISTS activates_at;
+ALTER TABLE urls_archive DROP COLUMN IF EXISTS clicks;
+ALTER TABLE urls_archive DROP COLUMN IF EXISTS max_clicks;
+ALTER TABLE urls_archive DROP COLUMN IF EXISTS password_hash;
+ALTER TABLE urls_archive DROP COLUMN IF EXISTS metadata;
+ALTER TABLE urls_archive DROP COLUMN IF EXISTS tags;
+ALTER TABLE urls_archive DROP COLUMN IF EXISTS owner;
@@ -0,0 +1,10 @@
+-- Keeps everything a reaped link carried, mirroring the urls columns
+ALTER TABLE urls_archive ADD COLUMN IF NOT EXISTS owner TEXT NOT NULL DEFAULT '';
+ALTER TABLE urls_archive ADD COLUMN IF NOT EXISTS tags TEXT[] NOT NULL DEFAULT '{}';
+ALTER TABLE urls_archive ADD COLUMN IF NOT EXISTS metadata JSONB NOT NULL DEFAULT '{}';
+ALTER TABLE urls_archive ADD COLUMN IF NOT EXISTS password_hash TEXT NOT NULL DEFAULT '';
+ALTER TABLE urls_archive ADD COLUMN IF NOT EXISTS max_clicks BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE urls_archive ADD COLUMN IF NOT EXISTS clicks BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE urls_archive ADD COLUMN IF NOT EXISTS activates_at TIMESTAMPTZ;
+ALTER TABLE urls_archive ADD COLUMN IF NOT EXISTS fallback_url TEXT NOT NULL DEFAULT '';
+ALTER TABLE urls_archive ADD COLUMN IF NOT EXISTS rules JSONB NOT NULL DEFAULT '[]';
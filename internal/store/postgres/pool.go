@@ -0,0 +1,202 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"goprl/internal/domain"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Zero values keep the pgxpool defaults or whatever the connection string
+// sets through pool_max_conns, pool_max_conn_lifetime and friends.
+type PoolOptions struct {
+	MaxConns        int32
+	MinConns        int32
+	MaxConnLifetime time.Duration
+	MaxConnIdleTime time.Duration
+	// Prepared statements kept per connection, each query is prepared once
+	// per connection and reused after that
+	StatementCacheCapacity int
+}
+
+func NewPoolConfig(url string, opts PoolOptions) (*pgxpool.Config, error) {
+	cfg, err := pgxpool.ParseConfig(url)
+	if err != nil {
+		return nil, err
+	}
+	if opts.MaxConns > 0 {
+		cfg.MaxConns = opts.MaxConns
+	}
+	if opts.MinConns > 0 {
+		cfg.MinConns = min(opts.MinConns, cfg.MaxConns)
+	}
+	if opts.MaxConnLifetime > 0 {
+		cfg.MaxConnLifetime = opts.MaxConnLifetime
+	}
+	if opts.MaxConnIdleTime > 0 {
+		cfg.MaxConnIdleTime = opts.MaxConnIdleTime
+	}
+	if opts.StatementCacheCapacity > 0 {
+		cfg.ConnConfig.DefaultQueryExecMode = pgx.QueryExecModeCacheStatement
+		cfg.ConnConfig.StatementCacheCapacity = opts.StatementCacheCapacity
+	}
+	return cfg, nil
+}
+
+// PoolStore talks to Postgres through pgx natively, skipping the
+// database/sql layer on the request path. Migrations and the reaper stay on
+// Store.
+type PoolStore struct {
+	pool *pgxpool.Pool
+}
+
+func NewPoolStore(pool *pgxpool.Pool) *PoolStore {
+	return &PoolStore{pool: pool}
+}
+
+func (s *PoolStore) Close() error {
+	s.pool.Close()
+	return nil
+}
+
+func (s *PoolStore) CreateURL(ctx context.Context, url *domain.URL) error {
+	hash := linkHash(url)
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if hash != nil {
+		if _, err := tx.Exec(ctx, releaseHashQuery, url.Owner, hash); err != nil {
+			return err
+		}
+	}
+
+	metadata, err := metadataParam(url.Metadata)
+	if err != nil {
+		return err
+	}
+	rules, err := rulesParam(url.Rules)
+	if err != nil {
+		return err
+	}
+	row := tx.QueryRow(ctx, insertURLQuery, url.ShortURL, url.OriginalURL, url.ExpiresAt, url.Owner, hash, tagsParam(url.Tags), metadata, url.PasswordHash, url.MaxClicks, url.Clicks, activatesParam(url.ActivatesAt), url.FallbackURL, rules)
+	if err := row.Scan(&url.ID, &url.CreatedAt); err != nil {
+		return insertError(err)
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (s *PoolStore) GetByShortURL(ctx context.Context, shortURL string) (*domain.URL, error) {
+	url, err := scanResolved(s.pool.QueryRow(ctx, byShortURLQuery, shortURL))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, domain.ErrURLNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if url.ExpiresAt.Before(time.Now()) {
+		return nil, domain.ErrURLExpired
+	}
+
+	return url, nil
+}
+
+func (s *PoolStore) GetByOriginalURL(ctx context.Context, originalURL string) (*domain.URL, error) {
+	url, err := scanURL(s.pool.QueryRow(ctx, byOriginalURLQuery, urlHash(originalURL)))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, domain.ErrURLNotFound
+	}
+	return url, err
+}
+
+func (s *PoolStore) GetMaxID(ctx context.Context) (int64, error) {
+	var maxID int64
+	if err := s.pool.QueryRow(ctx, maxIDQuery).Scan(&maxID); err != nil {
+		return 0, err
+	}
+	return maxID, nil
+}
+
+func (s *PoolStore) ListRecent(ctx context.Context, limit int) ([]*domain.URL, error) {
+	rows, err := s.pool.Query(ctx, listRecentQuery, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var urls []*domain.URL
+	for rows.Next() {
+		url, err := scanResolved(rows)
+		if err != nil {
+			return nil, err
+		}
+		urls = append(urls, url)
+	}
+	return urls, rows.Err()
+}
+
+func (s *PoolStore) EachOriginalURL(ctx context.Context, fn func(originalURL string)) error {
+	rows, err := s.pool.Query(ctx, liveURLsQuery)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var originalURL string
+		if err := rows.Scan(&originalURL); err != nil {
+			return err
+		}
+		fn(originalURL)
+	}
+	return rows.Err()
+}
+
+func (s *PoolStore) EachURL(ctx context.Context, fn func(url *domain.URL) error) error {
+	rows, err := s.pool.Query(ctx, allURLsQuery)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		url, err := scanURL(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(url); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (s *PoolStore) UpdateURL(ctx context.Context, code string, update domain.URLUpdate) (*domain.URL, error) {
+	tags, metadata, err := updateParams(update)
+	if err != nil {
+		return nil, err
+	}
+	url, err := scanURL(s.pool.QueryRow(ctx, updateURLQuery, code, tags, metadata))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, domain.ErrURLNotFound
+	}
+	return url, err
+}
+
+func (s *PoolStore) UseClick(ctx context.Context, code string) error {
+	tag, err := s.pool.Exec(ctx, useClickQuery, code)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return domain.ErrURLExhausted
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"goprl/internal/domain"
+	"time"
+)
+
+// Distinct from the migration lock, reaping and migrating don't exclude each other
+const reaperLockID = 0x676f70726c01
+
+// SKIP LOCKED keeps a batch from waiting on rows a writer is touching
+const expiredBatch = `SELECT id FROM urls WHERE expires_at < $1 ORDER BY expires_at LIMIT $2 FOR UPDATE SKIP LOCKED`
+
+// Everything a link carries except url_hash, which only serves dedupe
+const archiveColumns = `id, short_code, original_url, created_at, expires_at, owner, tags, metadata, password_hash, max_clicks, clicks, activates_at, fallback_url, rules`
+
+// ReapExpired removes links that expired before cutoff in batches of
+// batchSize, copying them to urls_archive first when archive is set. onBatch
+// sees each batch after it commits. Returns locked false without touching
+// anything when another replica is already reaping.
+func (s *Store) ReapExpired(ctx context.Context, cutoff time.Time, batchSize int, archive bool, onBatch func([]domain.ReapedURL)) (reaped int, locked bool, err error) {
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return 0, false, err
+	}
+	defer conn.Close()
+
+	if err := conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock($1)`, reaperLockID).Scan(&locked); err != nil || !locked {
+		return 0, false, err
+	}
+	defer conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, reaperLockID)
+
+	query := `WITH expired AS (` + expiredBatch + `)
+		DELETE FROM urls u USING expired e WHERE u.id = e.id
+		RETURNING u.id, u.short_code, u.original_url, u.created_at, u.expires_at, u.url_hash IS NOT NULL`
+	if archive {
+		// The batch comes from the DELETE, rows a previous pass already
+		// archived are still removed and must still reach onBatch
+		query = `WITH expired AS (` + expiredBatch + `),
+		removed AS (
+			DELETE FROM urls u USING expired e WHERE u.id = e.id
+			RETURNING u.*
+		),
+		archived AS (
+			INSERT INTO urls_archive (` + archiveColumns + `)
+			SELECT ` + archiveColumns + ` FROM removed
+			ON CONFLICT (id) DO NOTHING
+		)
+		SELECT id, short_code, original_url, created_at, expires_at, url_hash IS NOT NULL FROM removed`
+	}
+
+	for {
+		batch, err := reapBatch(ctx, conn, query, cutoff, batchSize)
+		if err != nil {
+			return reaped, true, err
+		}
+		reaped += len(batch)
+		if len(batch) > 0 && onBatch != nil {
+			onBatch(batch)
+		}
+		if len(batch) < batchSize {
+			return reaped, true, nil
+		}
+	}
+}
+
+func reapBatch(ctx context.Context, conn *sql.Conn, query string, cutoff time.Time, batchSize int) ([]domain.ReapedURL, error) {
+	rows, err := conn.QueryContext(ctx, query, cutoff, batchSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var batch []domain.ReapedURL
+	for rows.Next() {
+		reaped := domain.ReapedURL{URL: &domain.URL{}}
+		if err := rows.Scan(&reaped.ID, &reaped.ShortURL, &reaped.OriginalURL, &reaped.CreatedAt, &reaped.ExpiresAt, &reaped.Deduped); err != nil {
+			return nil, err
+		}
+		batch = append(batch, reaped)
+	}
+	return batch, rows.Err()
+}
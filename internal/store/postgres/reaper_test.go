@@ -0,0 +1,79 @@
+package postgres
+
+import (
+	"context"
+	"goprl/internal/domain"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestReapExpired(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open mock sql: %v", err)
+	}
+	defer db.Close()
+
+	store := NewStore(db)
+	ctx := context.Background()
+	cutoff := time.Now().Add(-24 * time.Hour)
+	columns := []string{"id", "short_code", "original_url", "created_at", "expires_at", "deduped"}
+
+	// Every column is carried over and the batch comes from the DELETE
+	archived := `INSERT INTO urls_archive \(` + archiveColumns + `\) SELECT ` + archiveColumns + ` FROM removed .* FROM removed$`
+
+	mock.ExpectQuery("SELECT pg_try_advisory_lock").WithArgs(reaperLockID).WillReturnRows(sqlmock.NewRows([]string{"locked"}).AddRow(true))
+	// Full batch, then a short one ends the pass
+	mock.ExpectQuery(archived).WithArgs(cutoff, 2).
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow(1, "abc", "https://google.com", time.Now(), cutoff, true).
+			AddRow(2, "abd", "https://yahoo.com", time.Now(), cutoff, false))
+	mock.ExpectQuery(archived).WithArgs(cutoff, 2).
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow(3, "abe", "https://bing.com", time.Now(), cutoff, true))
+	mock.ExpectExec("SELECT pg_advisory_unlock").WithArgs(reaperLockID).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	batches := 0
+	var deduped []bool
+	reaped, locked, err := store.ReapExpired(ctx, cutoff, 2, true, func(batch []domain.ReapedURL) {
+		batches++
+		for _, url := range batch {
+			deduped = append(deduped, url.Deduped)
+		}
+	})
+
+	if err != nil {
+		t.Fatalf("got error: %v, want nil", err)
+	}
+	if !locked || reaped != 3 || batches != 2 {
+		t.Errorf("got locked %v reaped %d batches %d, want true 3 2", locked, reaped, batches)
+	}
+	if len(deduped) != 3 || !deduped[0] || deduped[1] || !deduped[2] {
+		t.Errorf("got deduped %v, want each row's url_hash reported", deduped)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestReapExpired_Locked(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open mock sql: %v", err)
+	}
+	defer db.Close()
+
+	store := NewStore(db)
+	mock.ExpectQuery("SELECT pg_try_advisory_lock").WithArgs(reaperLockID).WillReturnRows(sqlmock.NewRows([]string{"locked"}).AddRow(false))
+
+	reaped, locked, err := store.ReapExpired(context.Background(), time.Now(), 100, false, nil)
+
+	if err != nil || locked || reaped != 0 {
+		t.Errorf("got %d %v %v, want a skipped pass", reaped, locked, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
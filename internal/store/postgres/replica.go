@@ -0,0 +1,138 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"goprl/internal/domain"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Seconds the replica is behind the primary. A replica that has replayed
+// everything it received reports 0 even when the primary has been idle.
+const replicaLagQuery = `SELECT CASE WHEN pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+	ELSE COALESCE(EXTRACT(EPOCH FROM NOW() - pg_last_xact_replay_timestamp()), 0) END`
+
+// Used when ReplicaOptions.Timeout is unset
+const defaultReplicaTimeout = time.Second
+
+type ReplicaOptions struct {
+	// Replicas further behind than this stop serving reads until they catch up
+	MaxLag time.Duration
+	// Bounds each health probe, and the primary retry of a lookup a replica
+	// ran out of time on. Keep it under the per call store timeout.
+	Timeout time.Duration
+	Logger  *slog.Logger
+}
+
+type replica struct {
+	db      *sql.DB
+	index   int
+	healthy atomic.Bool
+}
+
+// NewReplicatedStore sends link lookups to the replicas and everything else
+// to the primary. Replicas serve nothing until CheckReplicas has seen them
+// healthy.
+func NewReplicatedStore(primary *sql.DB, replicas []*sql.DB, opts ReplicaOptions) *Store {
+	s := NewStore(primary)
+	s.maxLag = opts.MaxLag
+	s.replicaTimeout = opts.Timeout
+	if s.replicaTimeout <= 0 {
+		s.replicaTimeout = defaultReplicaTimeout
+	}
+	s.logger = opts.Logger
+	if s.logger == nil {
+		s.logger = slog.New(slog.DiscardHandler)
+	}
+	for i, db := range replicas {
+		s.replicas = append(s.replicas, &replica{db: db, index: i})
+	}
+	return s
+}
+
+// CheckReplicas probes every replica at once, taking lagging or unreachable
+// ones out of rotation and putting recovered ones back. A probe that runs
+// past the replica timeout counts as unreachable.
+func (s *Store) CheckReplicas(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, r := range s.replicas {
+		wg.Go(func() { s.checkReplica(ctx, r) })
+	}
+	wg.Wait()
+}
+
+func (s *Store) checkReplica(ctx context.Context, r *replica) {
+	ctx, cancel := context.WithTimeout(ctx, s.replicaTimeout)
+	defer cancel()
+	var lag float64
+	err := r.db.QueryRowContext(ctx, replicaLagQuery).Scan(&lag)
+	behind := time.Duration(lag * float64(time.Second))
+	switch {
+	case err != nil:
+		s.markDown(r, err)
+	case s.maxLag > 0 && behind > s.maxLag:
+		if r.healthy.Swap(false) {
+			s.logger.Warn("Replica lagging, reads moved to primary", "replica", r.index, "lag", behind)
+		}
+	default:
+		if !r.healthy.Swap(true) {
+			s.logger.Info("Replica serving reads", "replica", r.index, "lag", behind)
+		}
+	}
+}
+
+func (s *Store) markDown(r *replica, err error) {
+	if r.healthy.Swap(false) {
+		s.logger.Warn("Replica unavailable, reads moved to primary", "replica", r.index, "error", err)
+	}
+}
+
+// Round robin over the healthy replicas, nil when the read belongs on the primary
+func (s *Store) pickReplica(ctx context.Context) *replica {
+	if len(s.replicas) == 0 || domain.ReadsPrimary(ctx) {
+		return nil
+	}
+	start := s.next.Add(1)
+	for i := range s.replicas {
+		r := s.replicas[(start+uint64(i))%uint64(len(s.replicas))]
+		if r.healthy.Load() {
+			return r
+		}
+	}
+	return nil
+}
+
+// Serves a lookup from a replica when one is healthy. A miss is retried on
+// the primary since the link may have been created after the replica's last
+// replay, and a failing replica is taken out of rotation. A replica that used
+// up the caller's deadline is failing too, the primary then gets a deadline
+// of its own rather than the expired one.
+func (s *Store) read(ctx context.Context, fn func(ctx context.Context, db *sql.DB) (*domain.URL, error)) (*domain.URL, error) {
+	r := s.pickReplica(ctx)
+	if r == nil {
+		return fn(ctx, s.db)
+	}
+	url, err := fn(ctx, r.db)
+	if err == nil || errors.Is(err, domain.ErrURLExpired) {
+		return url, err
+	}
+	if errors.Is(err, domain.ErrURLNotFound) {
+		return fn(ctx, s.db)
+	}
+	switch {
+	case errors.Is(ctx.Err(), context.Canceled):
+		// The caller went away, that says nothing about the replica
+		return nil, err
+	case ctx.Err() != nil:
+		s.markDown(r, err)
+		retry, cancel := context.WithTimeout(context.WithoutCancel(ctx), s.replicaTimeout)
+		defer cancel()
+		return fn(retry, s.db)
+	}
+	s.markDown(r, err)
+	return fn(ctx, s.db)
+}
@@ -0,0 +1,155 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"goprl/internal/domain"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func newReplicatedMock(t *testing.T, maxLag time.Duration) (*Store, sqlmock.Sqlmock, sqlmock.Sqlmock) {
+	t.Helper()
+	primary, primaryMock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open mock sql: %v", err)
+	}
+	replica, replicaMock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open mock sql: %v", err)
+	}
+	t.Cleanup(func() {
+		primary.Close()
+		replica.Close()
+	})
+	return NewReplicatedStore(primary, []*sql.DB{replica}, ReplicaOptions{MaxLag: maxLag}), primaryMock, replicaMock
+}
+
+func expectLookup(mock sqlmock.Sqlmock, code string) {
+	rows := sqlmock.NewRows([]string{"id", "short_code", "original_url", "created_at", "expires_at", "password_hash", "max_clicks", "clicks", "activates_at", "fallback_url", "rules"}).
+		AddRow(1, code, "https://google.com", time.Now(), time.Now().Add(time.Hour), "", 0, 0, nil, "", `[]`)
+	mock.ExpectQuery("SELECT id, short_code, original_url, created_at, expires_at, password_hash, max_clicks, clicks, activates_at, fallback_url, rules::text FROM urls WHERE short_code = \\$1").
+		WithArgs(code).
+		WillReturnRows(rows)
+}
+
+func expectLag(mock sqlmock.Sqlmock, seconds float64) {
+	mock.ExpectQuery("SELECT CASE WHEN pg_last_wal_receive_lsn").
+		WillReturnRows(sqlmock.NewRows([]string{"lag"}).AddRow(seconds))
+}
+
+func TestReplicaRouting(t *testing.T) {
+	ctx := context.Background()
+	store, primary, replica := newReplicatedMock(t, 5*time.Second)
+
+	// Replicas stay out of rotation until a health check passes
+	expectLookup(primary, "abc")
+	if _, err := store.GetByShortURL(ctx, "abc"); err != nil {
+		t.Fatalf("got error: %v, want nil", err)
+	}
+
+	expectLag(replica, 0.5)
+	store.CheckReplicas(ctx)
+	expectLookup(replica, "abc")
+	if _, err := store.GetByShortURL(ctx, "abc"); err != nil {
+		t.Fatalf("got error: %v, want nil", err)
+	}
+
+	// Read-after-write paths skip the replicas
+	expectLookup(primary, "abc")
+	if _, err := store.GetByShortURL(domain.WithPrimary(ctx), "abc"); err != nil {
+		t.Fatalf("got error: %v, want nil", err)
+	}
+
+	// A link the replica hasn't replayed yet is found on the primary
+	replica.ExpectQuery("SELECT id, short_code").WithArgs("new").WillReturnError(sql.ErrNoRows)
+	expectLookup(primary, "new")
+	if _, err := store.GetByShortURL(ctx, "new"); err != nil {
+		t.Fatalf("got error: %v, want nil", err)
+	}
+
+	if err := primary.ExpectationsWereMet(); err != nil {
+		t.Errorf("primary: %v", err)
+	}
+	if err := replica.ExpectationsWereMet(); err != nil {
+		t.Errorf("replica: %v", err)
+	}
+}
+
+func TestReplicaFallback(t *testing.T) {
+	ctx := context.Background()
+	store, primary, replica := newReplicatedMock(t, 5*time.Second)
+
+	expectLag(replica, 0)
+	store.CheckReplicas(ctx)
+
+	// A failing replica is dropped on the spot and the read retried on the primary
+	replica.ExpectQuery("SELECT id, short_code").WithArgs("abc").WillReturnError(errors.New("connection reset"))
+	expectLookup(primary, "abc")
+	expectLookup(primary, "abc")
+	for range 2 {
+		if _, err := store.GetByShortURL(ctx, "abc"); err != nil {
+			t.Fatalf("got error: %v, want nil", err)
+		}
+	}
+
+	// Lagging replicas stay out until they catch up
+	expectLag(replica, 30)
+	store.CheckReplicas(ctx)
+	expectLookup(primary, "abc")
+	if _, err := store.GetByShortURL(ctx, "abc"); err != nil {
+		t.Fatalf("got error: %v, want nil", err)
+	}
+
+	if err := primary.ExpectationsWereMet(); err != nil {
+		t.Errorf("primary: %v", err)
+	}
+	if err := replica.ExpectationsWereMet(); err != nil {
+		t.Errorf("replica: %v", err)
+	}
+}
+
+func TestReplicaTimeout(t *testing.T) {
+	store, primary, replica := newReplicatedMock(t, 5*time.Second)
+	store.replicaTimeout = 50 * time.Millisecond
+
+	expectLag(replica, 0)
+	store.CheckReplicas(context.Background())
+
+	// A black-holed replica runs out the caller's deadline, the primary still
+	// answers and the replica leaves rotation
+	replica.ExpectQuery("SELECT id, short_code").WithArgs("abc").WillDelayFor(time.Second)
+	expectLookup(primary, "abc")
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := store.GetByShortURL(ctx, "abc"); err != nil {
+		t.Fatalf("got error: %v, want the primary's answer", err)
+	}
+	expectLookup(primary, "abc")
+	if _, err := store.GetByShortURL(context.Background(), "abc"); err != nil {
+		t.Fatalf("got error: %v, want nil", err)
+	}
+
+	// A hung probe gives up after the replica timeout and keeps it out
+	replica.ExpectQuery("SELECT CASE WHEN pg_last_wal_receive_lsn").WillDelayFor(time.Second).
+		WillReturnRows(sqlmock.NewRows([]string{"lag"}).AddRow(0))
+	start := time.Now()
+	store.CheckReplicas(context.Background())
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("got a probe taking %v, want it cut off by the replica timeout", elapsed)
+	}
+	expectLookup(primary, "abc")
+	if _, err := store.GetByShortURL(context.Background(), "abc"); err != nil {
+		t.Fatalf("got error: %v, want nil", err)
+	}
+
+	if err := primary.ExpectationsWereMet(); err != nil {
+		t.Errorf("primary: %v", err)
+	}
+	if err := replica.ExpectationsWereMet(); err != nil {
+		t.Errorf("replica: %v", err)
+	}
+}
@@ -0,0 +1,96 @@
+package redis
+
+import (
+	"context"
+	"goprl/internal/domain"
+	"goprl/internal/store/bloomhash"
+	"math"
+	"time"
+
+	goredis "github.com/go-redis/redis/v8"
+)
+
+// Bloom is a filter kept in a Redis bitmap so every replica sees the same set.
+// The domain.Bloom interface has no error path: a failed Contains answers
+// "maybe" so callers fall through to the store, a failed Add is dropped and
+// at worst costs a duplicate code.
+type Bloom struct {
+	rdb     goredis.UniversalClient
+	key     string
+	m       uint64
+	k       uint64
+	timeout time.Duration
+}
+
+// key should carry a hash tag so the bitmap and its ready marker share a slot
+func NewBloom(rdb goredis.UniversalClient, key string, m uint, k uint, timeout time.Duration) *Bloom {
+	return &Bloom{
+		rdb:     rdb,
+		key:     key,
+		m:       uint64(max(m, 1)),
+		k:       uint64(max(k, 1)),
+		timeout: timeout,
+	}
+}
+
+func (b *Bloom) Add(item string) {
+	ctx, cancel := context.WithTimeout(context.Background(), b.timeout)
+	defer cancel()
+	h1, h2 := bloomhash.Hash(item)
+	pipe := b.rdb.Pipeline()
+	for i := uint64(0); i < b.k; i++ {
+		pipe.SetBit(ctx, b.key, int64(bloomhash.Location(h1, h2, i, b.m)), 1)
+	}
+	_, _ = pipe.Exec(ctx)
+}
+
+func (b *Bloom) Contains(item string) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), b.timeout)
+	defer cancel()
+	h1, h2 := bloomhash.Hash(item)
+	pipe := b.rdb.Pipeline()
+	bits := make([]*goredis.IntCmd, b.k)
+	for i := uint64(0); i < b.k; i++ {
+		bits[i] = pipe.GetBit(ctx, b.key, int64(bloomhash.Location(h1, h2, i, b.m)))
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return true
+	}
+	for _, bit := range bits {
+		if bit.Val() == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Ready reports whether some replica has finished populating the filter since
+// the bitmap was created. A Redis flush drops both and triggers a rebuild.
+func (b *Bloom) Ready(ctx context.Context) (bool, error) {
+	n, err := b.rdb.Exists(ctx, b.readyKey()).Result()
+	return n == 1, err
+}
+
+func (b *Bloom) MarkReady(ctx context.Context) error {
+	return b.rdb.Set(ctx, b.readyKey(), 1, 0).Err()
+}
+
+func (b *Bloom) readyKey() string {
+	return b.key + ":ready"
+}
+
+// Stats reports zeros when Redis can't be reached
+func (b *Bloom) Stats() domain.BloomStats {
+	ctx, cancel := context.WithTimeout(context.Background(), b.timeout)
+	defer cancel()
+	set, err := b.rdb.BitCount(ctx, b.key, nil).Result()
+	if err != nil {
+		return domain.BloomStats{}
+	}
+	fill := float64(set) / float64(b.m)
+	return domain.BloomStats{
+		Layers:            1,
+		FillRatio:         fill,
+		FalsePositiveRate: math.Pow(fill, float64(b.k)),
+	}
+}
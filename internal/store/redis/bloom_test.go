@@ -0,0 +1,79 @@
+package redis
+
+import (
+	"context"
+	"goprl/internal/store/bloomhash"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+func TestBloom_Shared(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mr.Close()
+
+	m, k := bloomhash.Estimate(1000, 0.01)
+	// Two replicas with their own clients over the same bitmap
+	a := NewBloom(redis.NewClient(&redis.Options{Addr: mr.Addr()}), "{bloom}:urls", m, k, time.Second)
+	b := NewBloom(redis.NewClient(&redis.Options{Addr: mr.Addr()}), "{bloom}:urls", m, k, time.Second)
+
+	if b.Contains("https://google.com") {
+		t.Error("expected empty filter to not contain item")
+	}
+	a.Add("https://google.com")
+	if !b.Contains("https://google.com") {
+		t.Error("expected item added on one replica to be visible on another")
+	}
+
+	for i := range 1000 {
+		a.Add("https://example.com/" + strconv.Itoa(i))
+	}
+	hits := 0
+	for i := range 1000 {
+		if b.Contains("https://other.com/" + strconv.Itoa(i)) {
+			hits++
+		}
+	}
+	if hits > 30 {
+		t.Errorf("got %d false positives in 1000, want about 10", hits)
+	}
+}
+
+func TestBloom_Ready(t *testing.T) {
+	ctx := context.Background()
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mr.Close()
+
+	bloom := NewBloom(redis.NewClient(&redis.Options{Addr: mr.Addr()}), "{bloom}:urls", 1000, 3, time.Second)
+	if ready, err := bloom.Ready(ctx); err != nil || ready {
+		t.Fatalf("got %v %v, want not ready", ready, err)
+	}
+	if err := bloom.MarkReady(ctx); err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	if ready, err := bloom.Ready(ctx); err != nil || !ready {
+		t.Fatalf("got %v %v, want ready", ready, err)
+	}
+}
+
+func TestBloom_Unavailable(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bloom := NewBloom(redis.NewClient(&redis.Options{Addr: mr.Addr()}), "{bloom}:urls", 1000, 3, 50*time.Millisecond)
+	mr.Close()
+
+	if !bloom.Contains("https://google.com") {
+		t.Error("expected unreachable filter to answer maybe")
+	}
+}
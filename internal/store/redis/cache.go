@@ -2,50 +2,146 @@ package redis
 
 import (
 	"context"
-	"encoding/json"
 	"goprl/internal/domain"
+	"math"
+	"math/rand/v2"
 	"time"
 
 	goredis "github.com/go-redis/redis/v8"
 )
 
+// Expected cost of recomputing an entry from Postgres, scales how early
+// readers start refreshing a key before it expires
+const earlyRefreshDelta = time.Second
+
 type Cache struct {
-	rdb *goredis.Client
+	rdb    goredis.UniversalClient
+	maxTTL time.Duration
+	beta   float64
+	random func() float64
+}
+
+func NewCache(rdb goredis.UniversalClient, maxTTL time.Duration) *Cache {
+	return &Cache{
+		rdb:    rdb,
+		maxTTL: maxTTL,
+		beta:   1.0,
+		random: rand.Float64,
+	}
 }
 
-func NewCache(rdb *goredis.Client) *Cache {
-	return &Cache{rdb: rdb}
+// Bloom returns a shared bloom filter stored under key on the cache's client
+func (c *Cache) Bloom(key string, m uint, k uint, timeout time.Duration) *Bloom {
+	return NewBloom(c.rdb, key, m, k, timeout)
 }
 
 func (c *Cache) Close() error {
 	return c.rdb.Close()
 }
 
+// Get returns the entry stored under key, following a single ref hop for
+// entries keyed by original URL
 func (c *Cache) Get(ctx context.Context, key string) (*domain.URL, error) {
-	val, err := c.rdb.Get(ctx, key).Result()
+	url, ref, err := c.get(ctx, key)
 	if err != nil {
 		return nil, err
 	}
-	var url domain.URL
-	err = json.Unmarshal([]byte(val), &url)
+	if ref == "" {
+		return url, nil
+	}
+	url, ref, err = c.get(ctx, ref)
 	if err != nil {
 		return nil, err
 	}
-	return &url, nil
+	if ref != "" {
+		return nil, errUnknownEncoding
+	}
+	return url, nil
 }
 
-func (c *Cache) Set(ctx context.Context, key string, value *domain.URL) error {
-	data, err := json.Marshal(value)
-	if err != nil {
-		return err
+func (c *Cache) get(ctx context.Context, key string) (*domain.URL, string, error) {
+	pipe := c.rdb.Pipeline()
+	get := pipe.Get(ctx, key)
+	pttl := pipe.PTTL(ctx, key)
+	if _, err := pipe.Exec(ctx); err != nil {
+		if err == goredis.Nil {
+			return nil, "", domain.ErrURLNotFound
+		}
+		return nil, "", err
+	}
+	// Report a miss so this caller reloads from the store and resets the TTL
+	if c.refreshEarly(pttl.Val()) {
+		return nil, "", domain.ErrURLNotFound
+	}
+	data, _ := get.Bytes()
+	return decodeEntry(key, data)
+}
+
+// Set stores value under key for ttl, capped by the cache max and the time
+// left until the link expires. A non-positive ttl uses the cache max.
+// Keys other than the link's own code (original URL dedupe) only store a ref
+// to the code instead of a second copy of the record.
+func (c *Cache) Set(ctx context.Context, key string, value *domain.URL, ttl time.Duration) error {
+	ttl = c.ttlFor(value, ttl)
+	if ttl <= 0 {
+		// Link already expired, drop any stale entry rather than caching it
+		return c.rdb.Del(ctx, key).Err()
+	}
+	data := encodeURL(value)
+	if key != value.ShortURL {
+		data = encodeRef(value.ShortURL)
 	}
-	// tweak expiry later
-	return c.rdb.Set(ctx, key, data, time.Hour).Err()
+	return c.rdb.Set(ctx, key, data, ttl).Err()
+}
+
+// Keys are removed one by one, a multi-key DEL would cross cluster slots
+func (c *Cache) Delete(ctx context.Context, keys ...string) error {
+	pipe := c.rdb.Pipeline()
+	for _, key := range keys {
+		pipe.Del(ctx, key)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (c *Cache) ttlFor(value *domain.URL, ttl time.Duration) time.Duration {
+	if ttl <= 0 || ttl > c.maxTTL {
+		ttl = c.maxTTL
+	}
+	if !value.ExpiresAt.IsZero() {
+		ttl = min(ttl, time.Until(value.ExpiresAt))
+	}
+	return ttl
+}
+
+// Probabilistic early expiration (XFetch). Each reader independently treats
+// the entry as expired with a chance that grows as the TTL runs out, so a hot
+// key gets refreshed by one request ahead of time instead of every request
+// stampeding Postgres at the same instant.
+func (c *Cache) refreshEarly(remaining time.Duration) bool {
+	// -1 no expiry, -2 missing
+	if remaining <= 0 {
+		return false
+	}
+	gap := -float64(earlyRefreshDelta) * c.beta * math.Log(1-c.random())
+	return gap >= float64(remaining)
+}
+
+// Braces are a cluster hash tag, only the part inside picks the slot. Keeps
+// each logical key (and anything derived from it later) on a single node.
+func rateLimitKey(key string) string {
+	return "rate_limit:{" + key + "}"
+}
+
+// Moving off the old untagged key restarts the counter once, the resulting
+// collision resyncs it from Postgres
+func counterKey(key string) string {
+	return "{" + key + "}"
 }
 
 // Fixed window rate limiter
 func (c *Cache) Allow(ctx context.Context, key string, limit int, window time.Duration) error {
-	fullKey := "rate_limit:" + key
+	fullKey := rateLimitKey(key)
 
 	n, err := c.rdb.Incr(ctx, fullKey).Result()
 	if err != nil {
@@ -67,9 +163,22 @@ func (c *Cache) Allow(ctx context.Context, key string, limit int, window time.Du
 }
 
 func (c *Cache) Increment(ctx context.Context, key string) (int64, error) {
-	return c.rdb.Incr(ctx, key).Result()
+	return c.rdb.Incr(ctx, counterKey(key)).Result()
+}
+
+// Seeding and moving the countdown happen in one script, two replicas seeing
+// a missing key at once would otherwise both reset it
+var countdownScript = goredis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[3])
+end
+return redis.call('INCRBY', KEYS[1], ARGV[2])
+`)
+
+func (c *Cache) Countdown(ctx context.Context, key string, start, delta int64, ttl time.Duration) (int64, error) {
+	return countdownScript.Run(ctx, c.rdb, []string{counterKey(key)}, start, delta, max(ttl.Milliseconds(), 1)).Int64()
 }
 
 func (c *Cache) SetCounter(ctx context.Context, key string, value int64) error {
-	return c.rdb.Set(ctx, key, value, time.Hour).Err()
+	return c.rdb.Set(ctx, counterKey(key), value, time.Hour).Err()
 }
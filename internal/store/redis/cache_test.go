@@ -3,6 +3,7 @@ package redis
 import (
 	"context"
 	"goprl/internal/domain"
+	"reflect"
 	"testing"
 	"time"
 
@@ -23,16 +24,16 @@ func TestCache_SetGet(t *testing.T) {
 		Addr: mr.Addr(),
 	})
 	expiry := time.Now().Add(24 * time.Hour)
-	store := NewCache(rdb)
-	if err := store.Set(ctx, "test", &domain.URL{
+	store := NewCache(rdb, time.Hour)
+	if err := store.Set(ctx, "abc", &domain.URL{
 		ShortURL:    "abc",
 		OriginalURL: "https://google.com",
 		CreatedAt:   time.Now(),
 		ExpiresAt:   expiry,
-	}); err != nil {
+	}, 0); err != nil {
 		t.Fatalf("got unexpected error: %v", err)
 	}
-	url, err := store.Get(ctx, "test")
+	url, err := store.Get(ctx, "abc")
 	if err != nil {
 		t.Fatalf("got unexpected error: %v", err)
 	}
@@ -42,4 +43,237 @@ func TestCache_SetGet(t *testing.T) {
 	if url.OriginalURL != "https://google.com" {
 		t.Errorf("got %s, want https://google.com", url.OriginalURL)
 	}
+	if url.ShortURL != "abc" {
+		t.Errorf("got %s, want abc", url.ShortURL)
+	}
+	if !url.ExpiresAt.Equal(expiry.Truncate(time.Millisecond)) {
+		t.Errorf("got %v, want %v", url.ExpiresAt, expiry)
+	}
+}
+
+func TestCache_OriginalURLRef(t *testing.T) {
+	ctx := context.Background()
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mr.Close()
+
+	rdb := redis.NewClient(&redis.Options{
+		Addr: mr.Addr(),
+	})
+	store := NewCache(rdb, time.Hour)
+	url := &domain.URL{ShortURL: "abc", OriginalURL: "https://google.com"}
+	if err := store.Set(ctx, "https://google.com", url, 0); err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+
+	// Ref without its target is a miss
+	if _, err := store.Get(ctx, "https://google.com"); err != domain.ErrURLNotFound {
+		t.Fatalf("got %v, want miss", err)
+	}
+
+	if err := store.Set(ctx, "abc", url, 0); err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	got, err := store.Get(ctx, "https://google.com")
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	if got.ShortURL != "abc" {
+		t.Errorf("got %s, want abc", got.ShortURL)
+	}
+	ref, _ := mr.Get("https://google.com")
+	if len(ref) != len("abc")+2 {
+		t.Errorf("got %d byte ref, want %d", len(ref), len("abc")+2)
+	}
+}
+
+func TestCache_OlderEntries(t *testing.T) {
+	ctx := context.Background()
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mr.Close()
+
+	rdb := redis.NewClient(&redis.Options{
+		Addr: mr.Addr(),
+	})
+	store := NewCache(rdb, time.Hour)
+	mr.Set("https://google.com", `{"id":1,"original_url":"https://google.com","short_code":"abc","created_at":"2025-01-01T00:00:00Z","expires_at":"2025-01-02T00:00:00Z"}`)
+
+	if url, err := store.Get(ctx, "https://google.com"); err != domain.ErrURLNotFound {
+		t.Errorf("got %+v, %v, want a legacy JSON entry read as a miss", url, err)
+	}
+
+	// A v1 entry may be a protected link cached before passwords existed
+	v1 := append([]byte{codecV1, kindURL, 0}, "https://docs.example.com"...)
+	mr.Set("abc", string(v1))
+	if url, err := store.Get(ctx, "abc"); err != domain.ErrURLNotFound {
+		t.Errorf("got %+v, %v, want a v1 entry read as a miss", url, err)
+	}
+	// A v2 entry may predate launch times and rules
+	v2 := append([]byte{codecV2, kindURL, 0, 1, fieldPasswordHash, 1, 'h'}, "https://docs.example.com"...)
+	mr.Set("abc", string(v2))
+	if url, err := store.Get(ctx, "abc"); err != domain.ErrURLNotFound {
+		t.Errorf("got %+v, %v, want a v2 entry read as a miss", url, err)
+	}
+
+	// Refs written by older binaries still lead to the rewritten entry
+	store.Set(ctx, "abc", &domain.URL{ShortURL: "abc", OriginalURL: "https://google.com"}, time.Hour)
+	mr.Set("https://google.com", string(append([]byte{codecV1, kindRef}, "abc"...)))
+	if url, err := store.Get(ctx, "https://google.com"); err != nil || url.ShortURL != "abc" {
+		t.Errorf("got %+v, %v, want the ref followed", url, err)
+	}
+}
+
+func TestCache_SetTTL(t *testing.T) {
+	ctx := context.Background()
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mr.Close()
+
+	rdb := redis.NewClient(&redis.Options{
+		Addr: mr.Addr(),
+	})
+	store := NewCache(rdb, time.Hour)
+
+	tests := []struct {
+		name      string
+		ttl       time.Duration
+		expiresAt time.Time
+		want      time.Duration
+	}{
+		{"Default uses max", 0, time.Now().Add(24 * time.Hour), time.Hour},
+		{"Capped by max", 2 * time.Hour, time.Now().Add(24 * time.Hour), time.Hour},
+		{"Per key", 10 * time.Minute, time.Now().Add(24 * time.Hour), 10 * time.Minute},
+		{"Capped by expiry", 0, time.Now().Add(5 * time.Minute), 5 * time.Minute},
+		{"No expiry", 0, time.Time{}, time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := store.Set(ctx, tt.name, &domain.URL{OriginalURL: "https://google.com", ExpiresAt: tt.expiresAt}, tt.ttl)
+			if err != nil {
+				t.Fatalf("got unexpected error: %v", err)
+			}
+			got := mr.TTL(tt.name)
+			if got > tt.want || got < tt.want-time.Second {
+				t.Errorf("got ttl %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("Expired link", func(t *testing.T) {
+		mr.Set("expired", "stale")
+		err := store.Set(ctx, "expired", &domain.URL{OriginalURL: "https://google.com", ExpiresAt: time.Now().Add(-time.Minute)}, 0)
+		if err != nil {
+			t.Fatalf("got unexpected error: %v", err)
+		}
+		if mr.Exists("expired") {
+			t.Error("expected expired link not to be cached")
+		}
+	})
+}
+
+func TestCache_EarlyRefresh(t *testing.T) {
+	ctx := context.Background()
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mr.Close()
+
+	rdb := redis.NewClient(&redis.Options{
+		Addr: mr.Addr(),
+	})
+	store := NewCache(rdb, time.Hour)
+	if err := store.Set(ctx, "test", &domain.URL{OriginalURL: "https://google.com"}, 0); err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+
+	// Typical draw with plenty of TTL left is a hit
+	store.random = func() float64 { return 0.5 }
+	if _, err := store.Get(ctx, "test"); err != nil {
+		t.Fatalf("got %v, want hit", err)
+	}
+
+	// Near expiry the same draw becomes a miss
+	mr.FastForward(time.Hour - 100*time.Millisecond)
+	if _, err := store.Get(ctx, "test"); err != domain.ErrURLNotFound {
+		t.Fatalf("got %v, want early refresh miss", err)
+	}
+}
+
+func TestCodec_Fields(t *testing.T) {
+	expiry := time.Now().Add(time.Hour).Truncate(time.Millisecond)
+	data := encodeURL(&domain.URL{ShortURL: "abc", OriginalURL: "https://docs.example.com", ExpiresAt: expiry, PasswordHash: "pbkdf2-sha256$1$a$b"})
+	if data[0] != codecV3 {
+		t.Fatalf("got version %d, want v3", data[0])
+	}
+	url, _, err := decodeEntry("abc", data)
+	if err != nil || url.PasswordHash != "pbkdf2-sha256$1$a$b" || url.OriginalURL != "https://docs.example.com" || !url.ExpiresAt.Equal(expiry) {
+		t.Fatalf("got %+v, %v, want the password hash round tripped", url, err)
+	}
+
+	limited, _, err := decodeEntry("abc", encodeURL(&domain.URL{ShortURL: "abc", OriginalURL: "https://a.com", MaxClicks: 300, Clicks: 7}))
+	if err != nil || limited.MaxClicks != 300 || limited.Clicks != 7 {
+		t.Errorf("got %+v, %v, want the click budget round tripped", limited, err)
+	}
+
+	launch := time.Now().Add(time.Hour).Truncate(time.Millisecond)
+	scheduled, _, err := decodeEntry("abc", encodeURL(&domain.URL{ShortURL: "abc", OriginalURL: "https://a.com", ActivatesAt: launch, FallbackURL: "https://a.com/soon"}))
+	if err != nil || !scheduled.ActivatesAt.Equal(launch) || scheduled.FallbackURL != "https://a.com/soon" {
+		t.Errorf("got %+v, %v, want the launch time and fallback round tripped", scheduled, err)
+	}
+
+	rules := []domain.Rule{{OS: "ios", URL: "https://apps.apple.com/app/id1"}, {Countries: []string{"DE"}, URL: "https://a.com/de"}}
+	targeted, _, err := decodeEntry("abc", encodeURL(&domain.URL{ShortURL: "abc", OriginalURL: "https://a.com", Rules: rules}))
+	if err != nil || !reflect.DeepEqual(targeted.Rules, rules) {
+		t.Errorf("got %+v, %v, want the rules round tripped", targeted, err)
+	}
+
+	plain, _, err := decodeEntry("abc", encodeURL(&domain.URL{ShortURL: "abc", OriginalURL: "https://a.com"}))
+	if err != nil || plain.OriginalURL != "https://a.com" || plain.Protected() {
+		t.Errorf("got %+v, %v, want a plain link round tripped", plain, err)
+	}
+
+	// A field from a newer writer is skipped
+	unknown := []byte{codecV3, kindURL, 0, 2, 99, 3, 'x', 'y', 'z', fieldPasswordHash, 1, 'h'}
+	url, _, err = decodeEntry("abc", append(unknown, "https://a.com"...))
+	if err != nil || url.PasswordHash != "h" || url.OriginalURL != "https://a.com" {
+		t.Errorf("got %+v, %v, want unknown fields skipped", url, err)
+	}
+	if _, _, err := decodeEntry("abc", []byte{codecV3, kindURL, 0, 1, fieldPasswordHash, 9, 'h'}); err != errUnknownEncoding {
+		t.Errorf("got %v, want a truncated field rejected", err)
+	}
+}
+
+func TestCache_Countdown(t *testing.T) {
+	ctx := context.Background()
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mr.Close()
+	cache := NewCache(redis.NewClient(&redis.Options{Addr: mr.Addr()}), time.Hour)
+
+	for _, want := range []int64{1, 0, -1} {
+		n, err := cache.Countdown(ctx, "clicks:abc", 2, -1, time.Minute)
+		if err != nil || n != want {
+			t.Errorf("got %d, %v, want %d", n, err, want)
+		}
+	}
+	if n, _ := cache.Countdown(ctx, "clicks:abc", 2, 1, time.Minute); n != 0 {
+		t.Errorf("got %d, want a use given back", n)
+	}
+	if ttl := mr.TTL("{clicks:abc}"); ttl <= 0 || ttl > time.Minute {
+		t.Errorf("got ttl %v, want the one set when seeded", ttl)
+	}
+	mr.FastForward(time.Minute)
+	if n, _ := cache.Countdown(ctx, "clicks:abc", 5, -1, time.Minute); n != 4 {
+		t.Errorf("got %d, want an expired countdown seeded again", n)
+	}
 }
@@ -0,0 +1,190 @@
+package redis
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"goprl/internal/domain"
+	"time"
+)
+
+// Cached values are a two byte header (version, kind) followed by the body.
+// URL entries are always written as v3. Legacy JSON, v1 and v2 entries come
+// from binaries that didn't know every field a link can carry: a v1 entry
+// can't tell a link without a password from one cached before passwords
+// existed. They read as misses so the caller reloads the link from the store
+// and overwrites them. Refs carry no fields and stay v1.
+const (
+	codecV1 byte = 1
+	codecV2 byte = 2
+	codecV3 byte = 3
+
+	kindURL byte = 0
+	kindRef byte = 1
+)
+
+// Optional fields in a URL body. Readers skip tags they don't know, so a
+// field can be added without bumping the version as long as its absence
+// means the same thing to older readers. A field older readers must not
+// ignore, like a password, needs a new version.
+const (
+	fieldPasswordHash byte = 1
+	fieldMaxClicks    byte = 2
+	fieldClicks       byte = 3
+	fieldActivatesAt  byte = 4
+	fieldFallbackURL  byte = 5
+	fieldRules        byte = 6
+)
+
+var errUnknownEncoding = errors.New("unknown cache encoding")
+
+type field struct {
+	tag   byte
+	value []byte
+}
+
+func urlFields(url *domain.URL) []field {
+	var fields []field
+	if url.PasswordHash != "" {
+		fields = append(fields, field{fieldPasswordHash, []byte(url.PasswordHash)})
+	}
+	// Clicks goes stale as soon as it's cached, Countdown tracks the live count
+	if url.MaxClicks > 0 {
+		fields = append(fields, field{fieldMaxClicks, binary.AppendUvarint(nil, uint64(url.MaxClicks))})
+		fields = append(fields, field{fieldClicks, binary.AppendUvarint(nil, uint64(url.Clicks))})
+	}
+	// Activation is checked on every read, the entry stays valid either side
+	// of the launch
+	if !url.ActivatesAt.IsZero() {
+		fields = append(fields, field{fieldActivatesAt, binary.AppendVarint(nil, url.ActivatesAt.UnixMilli())})
+	}
+	if url.FallbackURL != "" {
+		fields = append(fields, field{fieldFallbackURL, []byte(url.FallbackURL)})
+	}
+	if len(url.Rules) > 0 {
+		// A slice of plain structs always marshals
+		rules, _ := json.Marshal(url.Rules)
+		fields = append(fields, field{fieldRules, rules})
+	}
+	return fields
+}
+
+// v3 URL body: varint expiry in unix millis (0 for none), a uvarint field
+// count and that many (tag, uvarint length, value) fields, then the original
+// URL. The short code is the key the entry is stored under so it's not
+// repeated. v2 had the same layout but was only written for links with
+// fields, v1 had no fields at all.
+func encodeURL(url *domain.URL) []byte {
+	fields := urlFields(url)
+	size := 2 + 2*binary.MaxVarintLen64 + len(url.OriginalURL)
+	for _, f := range fields {
+		size += 1 + binary.MaxVarintLen64 + len(f.value)
+	}
+	buf := make([]byte, 0, size)
+	buf = append(buf, codecV3, kindURL)
+	var expiry int64
+	if !url.ExpiresAt.IsZero() {
+		expiry = url.ExpiresAt.UnixMilli()
+	}
+	buf = binary.AppendVarint(buf, expiry)
+	buf = binary.AppendUvarint(buf, uint64(len(fields)))
+	for _, f := range fields {
+		buf = append(buf, f.tag)
+		buf = binary.AppendUvarint(buf, uint64(len(f.value)))
+		buf = append(buf, f.value...)
+	}
+	return append(buf, url.OriginalURL...)
+}
+
+// v1 ref body: the short code holding the full entry
+func encodeRef(code string) []byte {
+	buf := make([]byte, 0, 2+len(code))
+	buf = append(buf, codecV1, kindRef)
+	return append(buf, code...)
+}
+
+// Returns either the decoded URL or the short code a ref entry points at.
+// Entries written before v3 report domain.ErrURLNotFound.
+func decodeEntry(key string, data []byte) (*domain.URL, string, error) {
+	if len(data) > 0 && data[0] == '{' {
+		return nil, "", domain.ErrURLNotFound
+	}
+	if len(data) < 2 {
+		return nil, "", errUnknownEncoding
+	}
+	version, body := data[0], data[2:]
+	switch data[1] {
+	case kindURL:
+		if version == codecV1 || version == codecV2 {
+			return nil, "", domain.ErrURLNotFound
+		}
+		if version != codecV3 {
+			return nil, "", errUnknownEncoding
+		}
+		expiry, n := binary.Varint(body)
+		if n <= 0 {
+			return nil, "", errUnknownEncoding
+		}
+		body = body[n:]
+		url := &domain.URL{ShortURL: key}
+		if expiry != 0 {
+			url.ExpiresAt = time.UnixMilli(expiry)
+		}
+		body, err := decodeFields(url, body)
+		if err != nil {
+			return nil, "", err
+		}
+		url.OriginalURL = string(body)
+		return url, "", nil
+	case kindRef:
+		if version != codecV1 {
+			return nil, "", errUnknownEncoding
+		}
+		return nil, string(body), nil
+	}
+	return nil, "", errUnknownEncoding
+}
+
+// Fills url from the fields at the start of body and returns what follows
+func decodeFields(url *domain.URL, body []byte) ([]byte, error) {
+	count, n := binary.Uvarint(body)
+	if n <= 0 {
+		return nil, errUnknownEncoding
+	}
+	body = body[n:]
+	for range count {
+		if len(body) == 0 {
+			return nil, errUnknownEncoding
+		}
+		tag := body[0]
+		size, n := binary.Uvarint(body[1:])
+		if n <= 0 || uint64(len(body)-1-n) < size {
+			return nil, errUnknownEncoding
+		}
+		value := body[1+n : 1+n+int(size)]
+		body = body[1+n+int(size):]
+		switch tag {
+		case fieldPasswordHash:
+			url.PasswordHash = string(value)
+		case fieldMaxClicks:
+			url.MaxClicks = uvarintField(value)
+		case fieldClicks:
+			url.Clicks = uvarintField(value)
+		case fieldActivatesAt:
+			millis, _ := binary.Varint(value)
+			url.ActivatesAt = time.UnixMilli(millis)
+		case fieldFallbackURL:
+			url.FallbackURL = string(value)
+		case fieldRules:
+			if err := json.Unmarshal(value, &url.Rules); err != nil {
+				return nil, errUnknownEncoding
+			}
+		}
+	}
+	return body, nil
+}
+
+func uvarintField(value []byte) int64 {
+	n, _ := binary.Uvarint(value)
+	return int64(n)
+}
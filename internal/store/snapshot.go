@@ -0,0 +1,78 @@
+package store
+
+import (
+	"goprl/internal/domain"
+	"io"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+)
+
+// Writes via a temp file and rename so a crash mid-write never leaves a
+// truncated snapshot behind
+func SaveSnapshot(path string, src io.WriterTo) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := src.WriteTo(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func LoadSnapshot(path string, dst io.ReaderFrom) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = dst.ReadFrom(f)
+	return err
+}
+
+// Answers "maybe" for everything until marked ready, so a filter that is
+// still being rebuilt never produces false negatives. Callers fall through
+// to the cache and store while it warms.
+type WarmingBloom struct {
+	domain.Bloom
+	ready atomic.Bool
+}
+
+func NewWarmingBloom(bloom domain.Bloom) *WarmingBloom {
+	return &WarmingBloom{Bloom: bloom}
+}
+
+func (w *WarmingBloom) Contains(item string) bool {
+	if !w.ready.Load() {
+		return true
+	}
+	return w.Bloom.Contains(item)
+}
+
+// Remove is a no-op for filters that can't forget
+func (w *WarmingBloom) Remove(item string) {
+	if removable, ok := w.Bloom.(domain.RemovableBloom); ok {
+		removable.Remove(item)
+	}
+}
+
+func (w *WarmingBloom) Stats() domain.BloomStats {
+	if reporter, ok := w.Bloom.(domain.BloomReporter); ok {
+		return reporter.Stats()
+	}
+	return domain.BloomStats{}
+}
+
+func (w *WarmingBloom) SetReady() {
+	w.ready.Store(true)
+}
+
+func (w *WarmingBloom) Ready() bool {
+	return w.ready.Load()
+}
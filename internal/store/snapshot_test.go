@@ -0,0 +1,85 @@
+package store
+
+import (
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestBloomSnapshot_RoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bloom.snapshot")
+	bf := NewBloomFilterWithEstimates(1000, 0.01)
+	bf.Add("https://google.com")
+
+	if err := SaveSnapshot(path, bf); err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+
+	restored := NewBloomFilterWithEstimates(1000, 0.01)
+	if err := LoadSnapshot(path, restored); err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	if !restored.Contains("https://google.com") {
+		t.Error("expected restored filter to contain item")
+	}
+
+	resized := NewBloomFilterWithEstimates(2000, 0.01)
+	if err := LoadSnapshot(path, resized); err != ErrBloomSnapshot {
+		t.Errorf("got %v, want %v", err, ErrBloomSnapshot)
+	}
+}
+
+func TestBloomSnapshot_Variants(t *testing.T) {
+	dir := t.TempDir()
+
+	scalable := NewScalableBloomFilter(10, 0.01)
+	for i := range 50 {
+		scalable.Add("https://example.com/" + strconv.Itoa(i))
+	}
+	if err := SaveSnapshot(filepath.Join(dir, "scalable"), scalable); err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	restoredScalable := NewScalableBloomFilter(10, 0.01)
+	if err := LoadSnapshot(filepath.Join(dir, "scalable"), restoredScalable); err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	if restoredScalable.Stats() != scalable.Stats() || !restoredScalable.Contains("https://example.com/49") {
+		t.Errorf("got %+v, want %+v", restoredScalable.Stats(), scalable.Stats())
+	}
+
+	counting := NewCountingBloomFilterWithEstimates(100, 0.01)
+	counting.Add("https://google.com")
+	if err := SaveSnapshot(filepath.Join(dir, "counting"), counting); err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	restoredCounting := NewCountingBloomFilterWithEstimates(100, 0.01)
+	if err := LoadSnapshot(filepath.Join(dir, "counting"), restoredCounting); err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	restoredCounting.Remove("https://google.com")
+	if restoredCounting.Contains("https://google.com") {
+		t.Error("expected restored counters to support removal")
+	}
+
+	// Snapshots of one type never load into another
+	if err := LoadSnapshot(filepath.Join(dir, "counting"), NewScalableBloomFilter(10, 0.01)); err != ErrBloomSnapshot {
+		t.Errorf("got %v, want %v", err, ErrBloomSnapshot)
+	}
+}
+
+func TestWarmingBloom(t *testing.T) {
+	bloom := NewWarmingBloom(NewBloomFilter(1000, 3))
+
+	if !bloom.Contains("https://google.com") {
+		t.Error("expected warming filter to answer maybe")
+	}
+
+	bloom.SetReady()
+	if bloom.Contains("https://google.com") {
+		t.Error("expected ready filter to defer to the underlying filter")
+	}
+	bloom.Add("https://google.com")
+	if !bloom.Contains("https://google.com") {
+		t.Error("expected filter to contain added item")
+	}
+}
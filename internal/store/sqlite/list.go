@@ -0,0 +1,70 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql/driver"
+	"goprl/internal/domain"
+	"strings"
+	"time"
+
+	"modernc.org/sqlite"
+)
+
+// SQLite has no regex to pull the host out with, the Go parser does it and
+// agrees with the other stores by construction
+func init() {
+	sqlite.MustRegisterDeterministicScalarFunction("url_host", 1, func(_ *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+		raw, _ := args[0].(string)
+		return domain.URLHost(raw), nil
+	})
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func (s *Store) ListURLs(ctx context.Context, f domain.ListFilter) ([]*domain.URL, error) {
+	var where []string
+	var args []any
+	add := func(cond string, arg any) {
+		where = append(where, cond)
+		args = append(args, arg)
+	}
+	if f.Before > 0 {
+		add("id < ?", f.Before)
+	}
+	if f.Owner != "" {
+		add("owner = ?", f.Owner)
+	}
+	if !f.CreatedFrom.IsZero() {
+		add("created_at >= ?", f.CreatedFrom.UnixMilli())
+	}
+	if !f.CreatedTo.IsZero() {
+		add("created_at < ?", f.CreatedTo.UnixMilli())
+	}
+	switch f.Status {
+	case domain.StatusLive:
+		add("expires_at > ?", time.Now().UnixMilli())
+	case domain.StatusExpired:
+		add("expires_at <= ?", time.Now().UnixMilli())
+	}
+	if f.Domain != "" {
+		add("url_host(original_url) = ?", strings.ToLower(f.Domain))
+	}
+	if f.Search != "" {
+		// LIKE already ignores ASCII case
+		add(`original_url LIKE ? ESCAPE '\'`, "%"+likeEscaper.Replace(f.Search)+"%")
+	}
+
+	for _, tag := range f.Tags {
+		add("EXISTS (SELECT 1 FROM json_each(urls.tags) WHERE value = ?)", tag)
+	}
+
+	query := `SELECT ` + urlColumns + ` FROM urls`
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	rows, err := s.db.QueryContext(ctx, query+" ORDER BY id DESC LIMIT ?", append(args, f.Limit)...)
+	if err != nil {
+		return nil, err
+	}
+	return scanURLs(rows)
+}
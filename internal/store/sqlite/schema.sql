@@ -0,0 +1,44 @@
+-- Times are unix milliseconds, SQLite has no native timestamp type
+CREATE TABLE IF NOT EXISTS urls (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    short_code TEXT UNIQUE NOT NULL,
+    original_url TEXT NOT NULL,
+    created_at INTEGER NOT NULL,
+    expires_at INTEGER NOT NULL,
+    owner TEXT NOT NULL DEFAULT '',
+    url_hash BLOB,
+    -- JSON array and object
+    tags TEXT NOT NULL DEFAULT '[]',
+    metadata TEXT NOT NULL DEFAULT '{}',
+    -- Empty for public links
+    password_hash TEXT NOT NULL DEFAULT '',
+    -- 0 is unlimited
+    max_clicks INTEGER NOT NULL DEFAULT 0,
+    clicks INTEGER NOT NULL DEFAULT 0,
+    -- 0 for links that are live from the start
+    activates_at INTEGER NOT NULL DEFAULT 0,
+    fallback_url TEXT NOT NULL DEFAULT '',
+    -- JSON array, see domain.Rule
+    rules TEXT NOT NULL DEFAULT '[]'
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_urls_owner_url_hash ON urls(owner, url_hash);
+CREATE INDEX IF NOT EXISTS idx_urls_expires_at ON urls(expires_at);
+
+CREATE TABLE IF NOT EXISTS urls_archive (
+    id INTEGER PRIMARY KEY,
+    short_code TEXT NOT NULL,
+    original_url TEXT NOT NULL,
+    created_at INTEGER,
+    expires_at INTEGER,
+    archived_at INTEGER NOT NULL,
+    owner TEXT NOT NULL DEFAULT '',
+    tags TEXT NOT NULL DEFAULT '[]',
+    metadata TEXT NOT NULL DEFAULT '{}',
+    password_hash TEXT NOT NULL DEFAULT '',
+    max_clicks INTEGER NOT NULL DEFAULT 0,
+    clicks INTEGER NOT NULL DEFAULT 0,
+    activates_at INTEGER NOT NULL DEFAULT 0,
+    fallback_url TEXT NOT NULL DEFAULT '',
+    rules TEXT NOT NULL DEFAULT '[]'
+);
@@ -0,0 +1,461 @@
+package sqlite
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"goprl/internal/domain"
+	"strings"
+	"time"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+//go:embed schema.sql
+var schema string
+
+// Store keeps links in a single SQLite file through a pure Go driver, so the
+// binary runs with no database server.
+type Store struct {
+	db *sql.DB
+}
+
+// Open creates the file and its schema when missing. ":memory:" gives a
+// throwaway database.
+func Open(path string) (*Store, error) {
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+	db, err := sql.Open("sqlite", path+sep+"_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, err
+	}
+	// SQLite takes one writer at a time anyway, and every connection to
+	// :memory: would otherwise get its own empty database
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := addColumns(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Store{db: db}, nil
+}
+
+// Columns added after the first release. CREATE TABLE IF NOT EXISTS leaves
+// older files as they were and SQLite has no ADD COLUMN IF NOT EXISTS.
+var addedColumns = []struct{ name, definition string }{
+	{"tags", `TEXT NOT NULL DEFAULT '[]'`},
+	{"metadata", `TEXT NOT NULL DEFAULT '{}'`},
+	{"password_hash", `TEXT NOT NULL DEFAULT ''`},
+	{"max_clicks", `INTEGER NOT NULL DEFAULT 0`},
+	{"clicks", `INTEGER NOT NULL DEFAULT 0`},
+	{"activates_at", `INTEGER NOT NULL DEFAULT 0`},
+	{"fallback_url", `TEXT NOT NULL DEFAULT ''`},
+	{"rules", `TEXT NOT NULL DEFAULT '[]'`},
+}
+
+// The archive started with the first five columns and archived_at, owner
+// included it keeps everything a link carried
+var archiveAddedColumns = append([]struct{ name, definition string }{
+	{"owner", `TEXT NOT NULL DEFAULT ''`},
+}, addedColumns...)
+
+func addColumns(db *sql.DB) error {
+	if err := addTableColumns(db, "urls", addedColumns); err != nil {
+		return err
+	}
+	return addTableColumns(db, "urls_archive", archiveAddedColumns)
+}
+
+func addTableColumns(db *sql.DB, table string, columns []struct{ name, definition string }) error {
+	rows, err := db.Query(`SELECT name FROM pragma_table_info(?)`, table)
+	if err != nil {
+		return err
+	}
+	existing := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return err
+		}
+		existing[name] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, column := range columns {
+		if !existing[column.name] {
+			if _, err := db.Exec(`ALTER TABLE ` + table + ` ADD COLUMN ` + column.name + ` ` + column.definition); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Store) UpdateURL(ctx context.Context, code string, update domain.URLUpdate) (*domain.URL, error) {
+	var tags, metadata any
+	if update.Tags != nil {
+		encoded, err := tagsJSON(update.Tags)
+		if err != nil {
+			return nil, err
+		}
+		tags = encoded
+	}
+	if update.Metadata != nil {
+		encoded, err := metadataJSON(update.Metadata)
+		if err != nil {
+			return nil, err
+		}
+		metadata = encoded
+	}
+	query := `UPDATE urls SET tags = COALESCE(?, tags), metadata = COALESCE(?, metadata) WHERE short_code = ? RETURNING ` + urlColumns
+	return scanURL(s.db.QueryRowContext(ctx, query, tags, metadata, code))
+}
+
+// A single statement, SQLite serialises writers so clicks can't overtake
+// each other
+func (s *Store) UseClick(ctx context.Context, code string) error {
+	res, err := s.db.ExecContext(ctx, `UPDATE urls SET clicks = clicks + 1 WHERE short_code = ? AND clicks < max_clicks`, code)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return domain.ErrURLExhausted
+	}
+	return nil
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// CreateURL inserts the link. An expired link for the same URL gives up its
+// hash first so the unique index only ever covers live links. Links that
+// don't dedupe, or were imported already expired, have no hash.
+func (s *Store) CreateURL(ctx context.Context, url *domain.URL) error {
+	now := time.Now()
+	var hash []byte
+	if url.Dedupes() && url.ExpiresAt.After(now) {
+		hash = urlHash(url.OriginalURL)
+	}
+	createdAt := url.CreatedAt
+	if createdAt.IsZero() {
+		createdAt = now
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if hash != nil {
+		release := `UPDATE urls SET url_hash = NULL WHERE owner = ? AND url_hash = ? AND expires_at <= ?`
+		if _, err := tx.ExecContext(ctx, release, url.Owner, hash, now.UnixMilli()); err != nil {
+			return err
+		}
+	}
+
+	tags, err := tagsJSON(url.Tags)
+	if err != nil {
+		return err
+	}
+	metadata, err := metadataJSON(url.Metadata)
+	if err != nil {
+		return err
+	}
+	rules, err := rulesJSON(url.Rules)
+	if err != nil {
+		return err
+	}
+	query := `INSERT INTO urls (short_code, original_url, created_at, expires_at, owner, url_hash, tags, metadata, password_hash, max_clicks, clicks, activates_at, fallback_url, rules) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) RETURNING id`
+	row := tx.QueryRowContext(ctx, query, url.ShortURL, url.OriginalURL, createdAt.UnixMilli(), url.ExpiresAt.UnixMilli(), url.Owner, hash, tags, metadata, url.PasswordHash, url.MaxClicks, url.Clicks, activatesMillis(url.ActivatesAt), url.FallbackURL, rules)
+	if err := row.Scan(&url.ID); err != nil {
+		var sqliteErr *sqlite.Error
+		if errors.As(err, &sqliteErr) && sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE {
+			if strings.Contains(sqliteErr.Error(), "url_hash") {
+				return domain.ErrOriginalURLExists
+			}
+			return domain.ErrURLAlreadyExists
+		}
+		return err
+	}
+	url.CreatedAt = time.UnixMilli(createdAt.UnixMilli())
+
+	return tx.Commit()
+}
+
+func (s *Store) GetByShortURL(ctx context.Context, code string) (*domain.URL, error) {
+	query := `SELECT ` + urlColumns + ` FROM urls WHERE short_code = ?`
+	url, err := scanURL(s.db.QueryRowContext(ctx, query, code))
+	if err != nil {
+		return nil, err
+	}
+	if url.ExpiresAt.Before(time.Now()) {
+		return nil, domain.ErrURLExpired
+	}
+	return url, nil
+}
+
+// Links created through the public API have no owner
+func (s *Store) GetByOriginalURL(ctx context.Context, originalURL string) (*domain.URL, error) {
+	query := `SELECT ` + urlColumns + ` FROM urls WHERE owner = '' AND url_hash = ? AND expires_at > ?`
+	return scanURL(s.db.QueryRowContext(ctx, query, urlHash(originalURL), time.Now().UnixMilli()))
+}
+
+func (s *Store) GetMaxID(ctx context.Context) (int64, error) {
+	var maxID int64
+	err := s.db.QueryRowContext(ctx, `SELECT COALESCE(MAX(id), 0) FROM urls`).Scan(&maxID)
+	return maxID, err
+}
+
+func (s *Store) ListRecent(ctx context.Context, limit int) ([]*domain.URL, error) {
+	query := `SELECT ` + urlColumns + ` FROM urls WHERE expires_at > ? ORDER BY id DESC LIMIT ?`
+	rows, err := s.db.QueryContext(ctx, query, time.Now().UnixMilli(), limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanURLs(rows)
+}
+
+func (s *Store) EachOriginalURL(ctx context.Context, fn func(originalURL string)) error {
+	rows, err := s.db.QueryContext(ctx, `SELECT original_url FROM urls WHERE url_hash IS NOT NULL AND expires_at > ?`, time.Now().UnixMilli())
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	// Collected first, fn may run queries of its own and there is only one
+	// connection
+	var urls []string
+	for rows.Next() {
+		var originalURL string
+		if err := rows.Scan(&originalURL); err != nil {
+			return err
+		}
+		urls = append(urls, originalURL)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+	for _, originalURL := range urls {
+		fn(originalURL)
+	}
+	return nil
+}
+
+func (s *Store) EachURL(ctx context.Context, fn func(url *domain.URL) error) error {
+	query := `SELECT ` + urlColumns + ` FROM urls ORDER BY id`
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	// Read ahead of fn for the same single connection reason as EachOriginalURL
+	urls, err := scanURLs(rows)
+	if err != nil {
+		return err
+	}
+	for _, url := range urls {
+		if err := fn(url); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReapExpired removes links that expired before cutoff in batches of
+// batchSize, copying them to urls_archive first when archive is set. The file
+// has a single owner so there is no lock to contend for.
+func (s *Store) ReapExpired(ctx context.Context, cutoff time.Time, batchSize int, archive bool, onBatch func([]domain.ReapedURL)) (int, bool, error) {
+	reaped := 0
+	for {
+		batch, err := s.reapBatch(ctx, cutoff, batchSize, archive)
+		if err != nil {
+			return reaped, true, err
+		}
+		reaped += len(batch)
+		if len(batch) > 0 && onBatch != nil {
+			onBatch(batch)
+		}
+		if len(batch) < batchSize {
+			return reaped, true, nil
+		}
+	}
+}
+
+func (s *Store) reapBatch(ctx context.Context, cutoff time.Time, batchSize int, archive bool) ([]domain.ReapedURL, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `DELETE FROM urls WHERE id IN (SELECT id FROM urls WHERE expires_at < ? ORDER BY expires_at LIMIT ?)
+		RETURNING ` + urlColumns + `, url_hash IS NOT NULL`
+	rows, err := tx.QueryContext(ctx, query, cutoff.UnixMilli(), batchSize)
+	if err != nil {
+		return nil, err
+	}
+	batch, err := scanReaped(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	if archive {
+		insert := `INSERT OR IGNORE INTO urls_archive (` + urlColumns + `, archived_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+		now := time.Now().UnixMilli()
+		for _, url := range batch {
+			tags, err := tagsJSON(url.Tags)
+			if err != nil {
+				return nil, err
+			}
+			metadata, err := metadataJSON(url.Metadata)
+			if err != nil {
+				return nil, err
+			}
+			rules, err := rulesJSON(url.Rules)
+			if err != nil {
+				return nil, err
+			}
+			if _, err := tx.ExecContext(ctx, insert, url.ID, url.ShortURL, url.OriginalURL, url.CreatedAt.UnixMilli(), url.ExpiresAt.UnixMilli(),
+				url.Owner, tags, metadata, url.PasswordHash, url.MaxClicks, url.Clicks, activatesMillis(url.ActivatesAt), url.FallbackURL, rules, now); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return batch, tx.Commit()
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+// Tags, metadata and rules are stored as JSON text
+const urlColumns = `id, short_code, original_url, created_at, expires_at, owner, tags, metadata, password_hash, max_clicks, clicks, activates_at, fallback_url, rules`
+
+func scanURL(row scanner) (*domain.URL, error) {
+	var url domain.URL
+	var createdAt, expiresAt, activatesAt int64
+	var tags, metadata, rules string
+	err := row.Scan(&url.ID, &url.ShortURL, &url.OriginalURL, &createdAt, &expiresAt, &url.Owner, &tags, &metadata, &url.PasswordHash, &url.MaxClicks, &url.Clicks, &activatesAt, &url.FallbackURL, &rules)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.ErrURLNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	url.CreatedAt = time.UnixMilli(createdAt)
+	url.ExpiresAt = time.UnixMilli(expiresAt)
+	if activatesAt != 0 {
+		url.ActivatesAt = time.UnixMilli(activatesAt)
+	}
+	if err := json.Unmarshal([]byte(tags), &url.Tags); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(metadata), &url.Metadata); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(rules), &url.Rules); err != nil {
+		return nil, err
+	}
+	if len(url.Tags) == 0 {
+		url.Tags = nil
+	}
+	if len(url.Metadata) == 0 {
+		url.Metadata = nil
+	}
+	if len(url.Rules) == 0 {
+		url.Rules = nil
+	}
+	return &url, nil
+}
+
+func tagsJSON(tags []string) (string, error) {
+	if tags == nil {
+		return "[]", nil
+	}
+	data, err := json.Marshal(tags)
+	return string(data), err
+}
+
+func metadataJSON(metadata map[string]any) (string, error) {
+	if metadata == nil {
+		return "{}", nil
+	}
+	data, err := json.Marshal(metadata)
+	return string(data), err
+}
+
+func rulesJSON(rules []domain.Rule) (string, error) {
+	if rules == nil {
+		return "[]", nil
+	}
+	data, err := json.Marshal(rules)
+	return string(data), err
+}
+
+// 0 stands for a link that is live from the start
+func activatesMillis(activatesAt time.Time) int64 {
+	if activatesAt.IsZero() {
+		return 0
+	}
+	return activatesAt.UnixMilli()
+}
+
+func scanURLs(rows *sql.Rows) ([]*domain.URL, error) {
+	defer rows.Close()
+	var urls []*domain.URL
+	for rows.Next() {
+		url, err := scanURL(rows)
+		if err != nil {
+			return nil, err
+		}
+		urls = append(urls, url)
+	}
+	return urls, rows.Err()
+}
+
+// Reaped rows carry whether they held a url_hash after urlColumns
+type reapedRow struct {
+	*sql.Rows
+	deduped *bool
+}
+
+func (r reapedRow) Scan(dest ...any) error {
+	return r.Rows.Scan(append(dest, r.deduped)...)
+}
+
+func scanReaped(rows *sql.Rows) ([]domain.ReapedURL, error) {
+	defer rows.Close()
+	var batch []domain.ReapedURL
+	for rows.Next() {
+		var deduped bool
+		url, err := scanURL(reapedRow{rows, &deduped})
+		if err != nil {
+			return nil, err
+		}
+		batch = append(batch, domain.ReapedURL{URL: url, Deduped: deduped})
+	}
+	return batch, rows.Err()
+}
+
+// Same hash as the Postgres store so the dedupe rules match
+func urlHash(originalURL string) []byte {
+	sum := sha256.Sum256([]byte(domain.CanonicalURL(originalURL)))
+	return sum[:]
+}
@@ -3,32 +3,193 @@ package store
 import (
 	"context"
 	"database/sql"
+	"fmt"
+	"goprl/internal/store/memory"
 	"goprl/internal/store/postgres"
 	"goprl/internal/store/redis"
+	"goprl/internal/store/sqlite"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
 	goredis "github.com/go-redis/redis/v8"
+	"github.com/jackc/pgx/v5/pgxpool"
 	_ "github.com/jackc/pgx/v5/stdlib"
 )
 
+// DatabaseKind picks the URLStore implementation from the DATABASE_URL scheme:
+// memory:// keeps links in process, sqlite://path uses a local file and
+// anything else is a Postgres connection string.
+func DatabaseKind(url string) string {
+	switch {
+	case strings.HasPrefix(url, "memory:"):
+		return "memory"
+	case strings.HasPrefix(url, "sqlite:"):
+		return "sqlite"
+	}
+	return "postgres"
+}
+
+func NewMemoryStore() *memory.Store {
+	return memory.NewStore()
+}
+
+// In process stand-in for Redis when REDIS_URL is unset
+func NewLocalCache(maxTTL time.Duration, maxEntries int) *memory.Cache {
+	return memory.NewCache(maxTTL, maxEntries)
+}
+
+// sqlite://goprl.db is relative to the working directory, sqlite:///var/lib/goprl.db absolute
+func NewSQLiteStore(url string) (*sqlite.Store, error) {
+	path := strings.TrimPrefix(strings.TrimPrefix(url, "sqlite:"), "//")
+	if path == "" {
+		return nil, fmt.Errorf("sqlite path is empty")
+	}
+	return sqlite.Open(path)
+}
+
 func NewPostgresStore(url string) (*postgres.Store, error) {
-	db, err := sql.Open("pgx", url)
+	return NewReplicatedPostgresStore(url, nil, postgres.ReplicaOptions{})
+}
+
+// Replicas aren't pinged, one that is down at startup just stays out of
+// rotation until a health check sees it
+func NewReplicatedPostgresStore(url string, replicaURLs []string, opts postgres.ReplicaOptions) (*postgres.Store, error) {
+	primary, err := sql.Open("pgx", url)
 	if err != nil {
 		return nil, err
 	}
-	if err := db.Ping(); err != nil {
+	if err := primary.Ping(); err != nil {
+		primary.Close()
 		return nil, err
 	}
-	return postgres.NewStore(db), nil
+	replicas := make([]*sql.DB, 0, len(replicaURLs))
+	for _, replicaURL := range replicaURLs {
+		db, err := sql.Open("pgx", replicaURL)
+		if err != nil {
+			primary.Close()
+			for _, r := range replicas {
+				r.Close()
+			}
+			return nil, fmt.Errorf("replica: %w", err)
+		}
+		replicas = append(replicas, db)
+	}
+	return postgres.NewReplicatedStore(primary, replicas, opts), nil
+}
+
+func NewPostgresPoolStore(url string, opts postgres.PoolOptions) (*postgres.PoolStore, error) {
+	cfg, err := postgres.NewPoolConfig(url, opts)
+	if err != nil {
+		return nil, err
+	}
+	pool, err := pgxpool.NewWithConfig(context.Background(), cfg)
+	if err != nil {
+		return nil, err
+	}
+	if err := pool.Ping(context.Background()); err != nil {
+		pool.Close()
+		return nil, err
+	}
+	return postgres.NewPoolStore(pool), nil
 }
 
-func NewRedisStore(url string) (*redis.Cache, error) {
-	opt, err := goredis.ParseURL(url)
+// Supported REDIS_URL forms:
+//
+//	redis://[:password@]host:port/db (rediss:// for TLS)
+//	redis-sentinel://[:password@]host:port[,host:port...]/db?master=name
+//	redis-cluster://[:password@]host:port[,host:port...]
+func NewRedisStore(url string, maxTTL time.Duration) (*redis.Cache, error) {
+	rdb, err := newRedisClient(url)
 	if err != nil {
 		return nil, err
 	}
-	rdb := goredis.NewClient(opt)
 	if err := rdb.Ping(context.Background()).Err(); err != nil {
+		rdb.Close()
+		return nil, err
+	}
+	return redis.NewCache(rdb, maxTTL), nil
+}
+
+// For deployments configuring Sentinel or Cluster explicitly rather than by URL
+func NewRedisStoreFromOptions(opt *goredis.UniversalOptions, maxTTL time.Duration) (*redis.Cache, error) {
+	rdb := goredis.NewUniversalClient(opt)
+	if err := rdb.Ping(context.Background()).Err(); err != nil {
+		rdb.Close()
+		return nil, err
+	}
+	return redis.NewCache(rdb, maxTTL), nil
+}
+
+func newRedisClient(rawURL string) (goredis.UniversalClient, error) {
+	switch {
+	case strings.HasPrefix(rawURL, "redis-sentinel://"):
+		opt, err := parseMultiHostURL(rawURL)
+		if err != nil {
+			return nil, err
+		}
+		if opt.MasterName == "" {
+			return nil, fmt.Errorf("redis sentinel URL missing master name")
+		}
+		return goredis.NewFailoverClient(opt.Failover()), nil
+	case strings.HasPrefix(rawURL, "redis-cluster://"):
+		opt, err := parseMultiHostURL(rawURL)
+		if err != nil {
+			return nil, err
+		}
+		if opt.DB != 0 {
+			return nil, fmt.Errorf("redis cluster only supports database 0")
+		}
+		// Cluster even with a single seed node, NewUniversalClient would pick a plain client
+		return goredis.NewClusterClient(opt.Cluster()), nil
+	}
+	opt, err := goredis.ParseURL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	return goredis.NewClient(opt), nil
+}
+
+func parseMultiHostURL(rawURL string) (*goredis.UniversalOptions, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
 		return nil, err
 	}
-	return redis.NewCache(rdb), nil
+	opt := &goredis.UniversalOptions{
+		MasterName: u.Query().Get("master"),
+	}
+	for _, addr := range strings.Split(u.Host, ",") {
+		if addr == "" {
+			continue
+		}
+		if err := validateRedisAddr(addr); err != nil {
+			return nil, err
+		}
+		opt.Addrs = append(opt.Addrs, addr)
+	}
+	if len(opt.Addrs) == 0 {
+		return nil, fmt.Errorf("redis URL has no hosts")
+	}
+	if u.User != nil {
+		opt.Username = u.User.Username()
+		opt.Password, _ = u.User.Password()
+	}
+	if db := strings.Trim(u.Path, "/"); db != "" {
+		if opt.DB, err = strconv.Atoi(db); err != nil {
+			return nil, fmt.Errorf("invalid redis database number: %q", db)
+		}
+	}
+	return opt, nil
+}
+
+func validateRedisAddr(addr string) error {
+	i := strings.LastIndex(addr, ":")
+	if i <= 0 {
+		return fmt.Errorf("redis address %q must be host:port", addr)
+	}
+	if _, err := strconv.Atoi(addr[i+1:]); err != nil {
+		return fmt.Errorf("redis address %q has invalid port", addr)
+	}
+	return nil
 }
@@ -0,0 +1,241 @@
+package transfer
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"goprl/internal/domain"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Format string
+
+const (
+	JSONL Format = "jsonl"
+	CSV   Format = "csv"
+)
+
+var ErrUnknownFormat = errors.New("format must be jsonl or csv")
+var ErrInvalidRecord = errors.New("invalid record")
+
+func ParseFormat(s string) (Format, error) {
+	switch Format(strings.ToLower(s)) {
+	case JSONL, "":
+		return JSONL, nil
+	case CSV:
+		return CSV, nil
+	}
+	return "", ErrUnknownFormat
+}
+
+func (f Format) ContentType() string {
+	if f == CSV {
+		return "text/csv"
+	}
+	return "application/x-ndjson"
+}
+
+// CSV columns, in export order. Imports match columns by header name so
+// files from elsewhere only need the required ones.
+var csvColumns = []string{"short_code", "original_url", "created_at", "expires_at", "owner", "tags", "metadata", "password_hash", "max_clicks", "clicks", "activates_at", "fallback_url", "rules"}
+
+var requiredColumns = []string{"short_code", "original_url", "expires_at"}
+
+// The API never shows password hashes, exports carry them so protected links
+// stay protected after a round trip
+type jsonRecord struct {
+	*domain.URL
+	PasswordHash string `json:"password_hash,omitempty"`
+}
+
+type Encoder struct {
+	json *json.Encoder
+	csv  *csv.Writer
+	buf  *bufio.Writer
+}
+
+func NewEncoder(w io.Writer, format Format) *Encoder {
+	buf := bufio.NewWriter(w)
+	e := &Encoder{buf: buf}
+	if format == CSV {
+		e.csv = csv.NewWriter(buf)
+	} else {
+		e.json = json.NewEncoder(buf)
+	}
+	return e
+}
+
+func (e *Encoder) WriteHeader() error {
+	if e.csv != nil {
+		return e.csv.Write(csvColumns)
+	}
+	return nil
+}
+
+// CSV joins tags with commas and writes metadata and rules as JSON
+func (e *Encoder) Encode(url *domain.URL) error {
+	if e.json != nil {
+		return e.json.Encode(jsonRecord{URL: url, PasswordHash: url.PasswordHash})
+	}
+	var metadata []byte
+	if len(url.Metadata) > 0 {
+		var err error
+		if metadata, err = json.Marshal(url.Metadata); err != nil {
+			return err
+		}
+	}
+	var rules []byte
+	if len(url.Rules) > 0 {
+		var err error
+		if rules, err = json.Marshal(url.Rules); err != nil {
+			return err
+		}
+	}
+	var activatesAt string
+	if !url.ActivatesAt.IsZero() {
+		activatesAt = url.ActivatesAt.UTC().Format(time.RFC3339)
+	}
+	return e.csv.Write([]string{
+		url.ShortURL,
+		url.OriginalURL,
+		url.CreatedAt.UTC().Format(time.RFC3339),
+		url.ExpiresAt.UTC().Format(time.RFC3339),
+		url.Owner,
+		strings.Join(url.Tags, ","),
+		string(metadata),
+		url.PasswordHash,
+		strconv.FormatInt(url.MaxClicks, 10),
+		strconv.FormatInt(url.Clicks, 10),
+		activatesAt,
+		url.FallbackURL,
+		string(rules),
+	})
+}
+
+func (e *Encoder) Flush() error {
+	if e.csv != nil {
+		e.csv.Flush()
+		if err := e.csv.Error(); err != nil {
+			return err
+		}
+	}
+	return e.buf.Flush()
+}
+
+// Decoder reads links back, one per line or CSV record. Line reports where
+// the last record started for error messages.
+type Decoder struct {
+	scanner *bufio.Scanner
+	csv     *csv.Reader
+	columns map[string]int
+	line    int
+}
+
+func NewDecoder(r io.Reader, format Format) *Decoder {
+	d := &Decoder{}
+	if format == CSV {
+		d.csv = csv.NewReader(r)
+		d.csv.FieldsPerRecord = -1
+	} else {
+		d.scanner = bufio.NewScanner(r)
+		d.scanner.Buffer(make([]byte, 64<<10), 1<<20)
+	}
+	return d
+}
+
+func (d *Decoder) Line() int {
+	return d.line
+}
+
+// Next returns io.EOF after the last record. Errors from a malformed record
+// wrap ErrInvalidRecord and leave the decoder usable for the next one.
+func (d *Decoder) Next() (*domain.URL, error) {
+	if d.csv != nil {
+		return d.nextCSV()
+	}
+	for d.scanner.Scan() {
+		d.line++
+		line := strings.TrimSpace(d.scanner.Text())
+		if line == "" {
+			continue
+		}
+		rec := jsonRecord{URL: &domain.URL{}}
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidRecord, err)
+		}
+		rec.URL.PasswordHash = rec.PasswordHash
+		return rec.URL, nil
+	}
+	if err := d.scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+func (d *Decoder) nextCSV() (*domain.URL, error) {
+	if d.columns == nil {
+		header, err := d.csv.Read()
+		if err != nil {
+			return nil, err
+		}
+		d.columns = make(map[string]int)
+		for i, name := range header {
+			d.columns[strings.ToLower(strings.TrimSpace(name))] = i
+		}
+		for _, name := range requiredColumns {
+			if _, ok := d.columns[name]; !ok {
+				return nil, fmt.Errorf("csv header is missing %s", name)
+			}
+		}
+	}
+	record, err := d.csv.Read()
+	if err != nil {
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			d.line = parseErr.StartLine
+			return nil, fmt.Errorf("%w: %v", ErrInvalidRecord, parseErr.Err)
+		}
+		return nil, err
+	}
+	d.line, _ = d.csv.FieldPos(0)
+	field := func(name string) string {
+		if i, ok := d.columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+	url := &domain.URL{ShortURL: field("short_code"), OriginalURL: field("original_url"), Owner: field("owner"), PasswordHash: field("password_hash"), FallbackURL: field("fallback_url")}
+	if tags := field("tags"); tags != "" {
+		url.Tags = strings.Split(tags, ",")
+	}
+	if metadata := field("metadata"); metadata != "" {
+		if err := json.Unmarshal([]byte(metadata), &url.Metadata); err != nil {
+			return nil, fmt.Errorf("%w: metadata must be a JSON object", ErrInvalidRecord)
+		}
+	}
+	if rules := field("rules"); rules != "" {
+		if err := json.Unmarshal([]byte(rules), &url.Rules); err != nil {
+			return nil, fmt.Errorf("%w: rules must be a JSON array", ErrInvalidRecord)
+		}
+	}
+	for name, dst := range map[string]*int64{"max_clicks": &url.MaxClicks, "clicks": &url.Clicks} {
+		if value := field(name); value != "" {
+			if *dst, err = strconv.ParseInt(value, 10, 64); err != nil {
+				return nil, fmt.Errorf("%w: %s must be an integer", ErrInvalidRecord, name)
+			}
+		}
+	}
+	for name, dst := range map[string]*time.Time{"created_at": &url.CreatedAt, "expires_at": &url.ExpiresAt, "activates_at": &url.ActivatesAt} {
+		if value := field(name); value != "" {
+			if *dst, err = time.Parse(time.RFC3339, value); err != nil {
+				return nil, fmt.Errorf("%w: %s must be RFC 3339", ErrInvalidRecord, name)
+			}
+		}
+	}
+	return url, nil
+}
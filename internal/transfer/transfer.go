@@ -0,0 +1,225 @@
+package transfer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"goprl/internal/domain"
+	"goprl/internal/passcode"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Links per insert when importing
+const defaultBatchSize = 500
+
+var errCodeTaken = errors.New("short code already taken")
+
+// Problems listed in a report, the counts keep going past it
+const maxProblems = 1000
+
+// Links moves links in and out of a store. Imports keep the short codes they
+// were given instead of drawing new ones from the counter.
+type Links struct {
+	Store    domain.URLStore
+	Exporter domain.URLExporter
+	// Called for every imported link, e.g. to add it to the bloom filter
+	OnImported func(url *domain.URL)
+	BatchSize  int
+}
+
+type Problem struct {
+	Line      int    `json:"line"`
+	ShortCode string `json:"short_code,omitempty"`
+	Error     string `json:"error"`
+}
+
+// Conflicts are links the store turned down, Invalid are records that never
+// made it that far
+type Report struct {
+	Imported  int       `json:"imported"`
+	Conflicts int       `json:"conflicts"`
+	Invalid   int       `json:"invalid"`
+	Problems  []Problem `json:"problems"`
+}
+
+func (r *Report) add(p Problem) {
+	if len(r.Problems) < maxProblems {
+		r.Problems = append(r.Problems, p)
+	}
+}
+
+// Export writes every link, expired ones included, and returns how many
+func (l *Links) Export(ctx context.Context, w io.Writer, format Format) (int, error) {
+	enc := NewEncoder(w, format)
+	if err := enc.WriteHeader(); err != nil {
+		return 0, err
+	}
+	n := 0
+	err := l.Exporter.EachURL(ctx, func(url *domain.URL) error {
+		n++
+		return enc.Encode(url)
+	})
+	if err != nil {
+		return n, err
+	}
+	return n, enc.Flush()
+}
+
+type importPending struct {
+	line int
+	url  *domain.URL
+}
+
+// Import reads links until the end of r. Bad records and conflicts are
+// reported and skipped, only a failing reader or store stops the import.
+func (l *Links) Import(ctx context.Context, r io.Reader, format Format) (*Report, error) {
+	size := l.BatchSize
+	if size <= 0 {
+		size = defaultBatchSize
+	}
+	report := &Report{Problems: []Problem{}}
+	dec := NewDecoder(r, format)
+	// The batch insert can't tell two rows with the same code apart
+	seen := make(map[string]bool)
+	var batch []importPending
+	for {
+		u, err := dec.Next()
+		if err == io.EOF {
+			break
+		}
+		if errors.Is(err, ErrInvalidRecord) {
+			report.Invalid++
+			report.add(Problem{Line: dec.Line(), Error: err.Error()})
+			continue
+		}
+		if err != nil {
+			return report, err
+		}
+		if err := validate(u); err != nil {
+			report.Invalid++
+			report.add(Problem{Line: dec.Line(), ShortCode: u.ShortURL, Error: err.Error()})
+			continue
+		}
+		if seen[u.ShortURL] {
+			report.Conflicts++
+			report.add(Problem{Line: dec.Line(), ShortCode: u.ShortURL, Error: errCodeTaken.Error()})
+			continue
+		}
+		seen[u.ShortURL] = true
+		u.ID = 0
+		batch = append(batch, importPending{line: dec.Line(), url: u})
+		if len(batch) == size {
+			if err := l.insert(ctx, batch, report); err != nil {
+				return report, err
+			}
+			batch = batch[:0]
+		}
+	}
+	if len(batch) > 0 {
+		if err := l.insert(ctx, batch, report); err != nil {
+			return report, err
+		}
+	}
+	return report, nil
+}
+
+func (l *Links) insert(ctx context.Context, batch []importPending, report *Report) error {
+	urls := make([]*domain.URL, len(batch))
+	for i, p := range batch {
+		urls[i] = p.url
+	}
+	var errs []error
+	if batchStore, ok := l.Store.(domain.URLBatchStore); ok {
+		var err error
+		if errs, err = batchStore.CreateURLs(ctx, urls); err != nil {
+			return err
+		}
+	} else {
+		errs = make([]error, len(urls))
+		for i, u := range urls {
+			errs[i] = l.Store.CreateURL(ctx, u)
+		}
+	}
+
+	for i, err := range errs {
+		p := batch[i]
+		switch {
+		case err == nil:
+			report.Imported++
+			if l.OnImported != nil {
+				l.OnImported(p.url)
+			}
+		case errors.Is(err, domain.ErrURLAlreadyExists):
+			report.Conflicts++
+			report.add(Problem{Line: p.line, ShortCode: p.url.ShortURL, Error: errCodeTaken.Error()})
+		case errors.Is(err, domain.ErrOriginalURLExists):
+			report.Conflicts++
+			report.add(Problem{Line: p.line, ShortCode: p.url.ShortURL, Error: err.Error()})
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Codes from other shorteners are kept as they are, as long as they fit in a
+// path segment
+func validate(u *domain.URL) error {
+	if u.ShortURL == "" || len(u.ShortURL) > 64 || strings.ContainsAny(u.ShortURL, "/?# \t") {
+		return fmt.Errorf("short_code must be 1 to 64 characters with no /, ?, # or spaces")
+	}
+	if domain.ReservedCode(u.ShortURL) {
+		return fmt.Errorf("short_code %q is reserved", u.ShortURL)
+	}
+	parsed, err := url.Parse(u.OriginalURL)
+	if err != nil || parsed.Host == "" {
+		return domain.ErrInvalidURL
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return domain.ErrInvalidScheme
+	}
+	if u.ExpiresAt.IsZero() {
+		return fmt.Errorf("expires_at is required")
+	}
+	tags, err := domain.NormalizeTags(u.Tags)
+	if err != nil {
+		return err
+	}
+	u.Tags = tags
+	if err := domain.ValidateMetadata(u.Metadata); err != nil {
+		return err
+	}
+	if u.MaxClicks < 0 || u.Clicks < 0 {
+		return fmt.Errorf("max_clicks and clicks must not be negative")
+	}
+	// Passwords only ever travel hashed
+	if u.PasswordHash != "" && !passcode.Valid(u.PasswordHash) {
+		return fmt.Errorf("password_hash is not a supported hash or its iteration count is out of range")
+	}
+	if !u.ActivatesAt.IsZero() && !u.ActivatesAt.Before(u.ExpiresAt) {
+		return domain.ErrInvalidActivation
+	}
+	if u.FallbackURL != "" && !webURL(u.FallbackURL) {
+		return fmt.Errorf("fallback_url must be an http or https URL")
+	}
+	if u.Rules, err = domain.NormalizeRules(u.Rules); err != nil {
+		return err
+	}
+	for _, rule := range u.Rules {
+		if !webURL(rule.URL) {
+			return domain.ErrInvalidRules
+		}
+	}
+	if u.CreatedAt.IsZero() || u.CreatedAt.After(time.Now()) {
+		u.CreatedAt = time.Now()
+	}
+	return nil
+}
+
+func webURL(s string) bool {
+	parsed, err := url.Parse(s)
+	return err == nil && parsed.Host != "" && (parsed.Scheme == "http" || parsed.Scheme == "https")
+}
@@ -0,0 +1,138 @@
+package transfer
+
+import (
+	"bytes"
+	"context"
+	"goprl/internal/domain"
+	"goprl/internal/store/memory"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExportImportRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	for _, format := range []Format{JSONL, CSV} {
+		t.Run(string(format), func(t *testing.T) {
+			src := memory.NewStore()
+			created := time.Now().Add(-48 * time.Hour).Truncate(time.Second)
+			src.CreateURL(ctx, &domain.URL{ShortURL: "abc", OriginalURL: "https://a.com", CreatedAt: created, ExpiresAt: time.Now().Add(time.Hour).Truncate(time.Second),
+				Tags: []string{"email", "spring"}, Metadata: map[string]any{"note": "launch, v2"}, MaxClicks: 5,
+				ActivatesAt: created.Add(time.Hour), FallbackURL: "https://a.com/soon", Rules: []domain.Rule{{OS: "ios", URL: "https://apps.apple.com/app/id1"}}})
+			src.UseClick(ctx, "abc")
+			src.CreateURL(ctx, &domain.URL{ShortURL: "old", OriginalURL: "https://b.com", CreatedAt: created, ExpiresAt: time.Now().Add(-time.Hour).Truncate(time.Second), Owner: "team",
+				PasswordHash: "pbkdf2-sha256$600000$c2FsdA$a2V5"})
+
+			var buf bytes.Buffer
+			n, err := (&Links{Exporter: src}).Export(ctx, &buf, format)
+			if err != nil || n != 2 {
+				t.Fatalf("got %d, %v, want 2 links exported", n, err)
+			}
+
+			dst := memory.NewStore()
+			var imported []string
+			links := &Links{Store: dst, OnImported: func(url *domain.URL) { imported = append(imported, url.ShortURL) }}
+			report, err := links.Import(ctx, &buf, format)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if report.Imported != 2 || len(report.Problems) != 0 || len(imported) != 2 {
+				t.Fatalf("got %+v, want both links imported", report)
+			}
+			got, err := dst.GetByShortURL(ctx, "abc")
+			if err != nil || got.OriginalURL != "https://a.com" || !got.CreatedAt.Equal(created) {
+				t.Errorf("got %+v, %v, want the link with its original creation time", got, err)
+			}
+			if len(got.Tags) != 2 || got.Tags[1] != "spring" || got.Metadata["note"] != "launch, v2" {
+				t.Errorf("got tags %v metadata %v, want both carried over", got.Tags, got.Metadata)
+			}
+			if got.MaxClicks != 5 || got.Clicks != 1 {
+				t.Errorf("got %d of %d clicks, want the used click carried over", got.Clicks, got.MaxClicks)
+			}
+			if !got.ActivatesAt.Equal(created.Add(time.Hour)) || got.FallbackURL != "https://a.com/soon" {
+				t.Errorf("got activates_at %v fallback %q, want both carried over", got.ActivatesAt, got.FallbackURL)
+			}
+			if len(got.Rules) != 1 || got.Rules[0].URL != "https://apps.apple.com/app/id1" {
+				t.Errorf("got rules %+v, want them carried over", got.Rules)
+			}
+			if _, err := dst.GetByShortURL(ctx, "old"); err != domain.ErrURLExpired {
+				t.Errorf("got %v, want the expired link kept as expired", err)
+			}
+			var old *domain.URL
+			dst.EachURL(ctx, func(url *domain.URL) error {
+				if url.ShortURL == "old" {
+					old = url
+				}
+				return nil
+			})
+			if old == nil || old.PasswordHash != "pbkdf2-sha256$600000$c2FsdA$a2V5" {
+				t.Errorf("got %+v, want the password hash carried over", old)
+			}
+		})
+	}
+}
+
+func TestImportReport(t *testing.T) {
+	ctx := context.Background()
+	store := memory.NewStore()
+	expires := time.Now().Add(time.Hour)
+	store.CreateURL(ctx, &domain.URL{ShortURL: "taken", OriginalURL: "https://existing.com", ExpiresAt: expires})
+	store.CreateURL(ctx, &domain.URL{ShortURL: "live", OriginalURL: "https://live.com", ExpiresAt: expires})
+
+	input := strings.Join([]string{
+		`{"short_code":"new","original_url":"https://new.com","expires_at":"2099-01-01T00:00:00Z"}`,
+		`{"short_code":"taken","original_url":"https://other.com","expires_at":"2099-01-01T00:00:00Z"}`,
+		`{"short_code":"dup","original_url":"https://live.com","expires_at":"2099-01-01T00:00:00Z"}`,
+		`{"short_code":"new","original_url":"https://again.com","expires_at":"2099-01-01T00:00:00Z"}`,
+		`{"short_code":"a/b","original_url":"https://c.com","expires_at":"2099-01-01T00:00:00Z"}`,
+		`{"short_code":"noexp","original_url":"https://d.com"}`,
+		`{"short_code":"ftp","original_url":"ftp://e.com","expires_at":"2099-01-01T00:00:00Z"}`,
+		`{"short_code":"plain","original_url":"https://f.com","expires_at":"2099-01-01T00:00:00Z","password_hash":"hunter2"}`,
+		`{"short_code":"weak","original_url":"https://g.com","expires_at":"2099-01-01T00:00:00Z","password_hash":"pbkdf2-sha256$1$c2FsdA$a2V5"}`,
+		`{"short_code":"api","original_url":"https://h.com","expires_at":"2099-01-01T00:00:00Z"}`,
+		`not json`,
+		``,
+		`{"short_code":"last","original_url":"https://last.com","expires_at":"2099-01-01T00:00:00Z"}`,
+	}, "\n")
+
+	report, err := (&Links{Store: store, BatchSize: 2}).Import(ctx, strings.NewReader(input), JSONL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if report.Imported != 2 || report.Conflicts != 3 || report.Invalid != 7 {
+		t.Fatalf("got %+v, want 2 imported, 3 conflicts and 7 invalid", report)
+	}
+	lines := make(map[int]string)
+	for _, p := range report.Problems {
+		lines[p.Line] = p.Error
+	}
+	for _, line := range []int{2, 3, 4, 5, 6, 7, 8, 9, 10, 11} {
+		if lines[line] == "" {
+			t.Errorf("got no problem for line %d, want one: %+v", line, report.Problems)
+		}
+	}
+	if lines[3] != domain.ErrOriginalURLExists.Error() || lines[2] != errCodeTaken.Error() {
+		t.Errorf("got %q and %q, want the two kinds of conflict told apart", lines[2], lines[3])
+	}
+	if _, err := store.GetByShortURL(ctx, "last"); err != nil {
+		t.Errorf("got %v, want records after the bad ones imported", err)
+	}
+}
+
+func TestDecodeCSVByHeader(t *testing.T) {
+	input := "expires_at,original_url,short_code\n2099-01-01T00:00:00Z,https://a.com,abc\nyesterday,https://b.com,def\n"
+	dec := NewDecoder(strings.NewReader(input), CSV)
+
+	url, err := dec.Next()
+	if err != nil || url.ShortURL != "abc" || url.OriginalURL != "https://a.com" || url.ExpiresAt.Year() != 2099 {
+		t.Fatalf("got %+v, %v, want columns matched by name", url, err)
+	}
+	if _, err := dec.Next(); err == nil || dec.Line() != 3 {
+		t.Errorf("got %v on line %d, want an invalid time on line 3", err, dec.Line())
+	}
+
+	_, err = NewDecoder(strings.NewReader("url,code\n"), CSV).Next()
+	if err == nil || !strings.Contains(err.Error(), "short_code") {
+		t.Errorf("got %v, want the missing column named", err)
+	}
+}
@@ -0,0 +1,54 @@
+// Package useragent sorts User-Agent headers into the operating systems and
+// device classes redirect rules match on. It's a handful of substring checks,
+// enough to route app links, not a full agent database.
+package useragent
+
+import (
+	"strings"
+
+	"goprl/internal/domain"
+)
+
+// Crawlers and the fetchers behind link previews in chat apps
+var botMarkers = []string{
+	"bot", "crawler", "spider", "slurp", "facebookexternalhit", "embedly", "preview",
+	"whatsapp", "headless", "curl/", "wget/", "python-requests", "go-http-client",
+}
+
+func Parse(ua string) domain.Visitor {
+	ua = strings.ToLower(ua)
+	var v domain.Visitor
+	for _, marker := range botMarkers {
+		if strings.Contains(ua, marker) {
+			v.Bot = true
+			break
+		}
+	}
+
+	// Order matters, Android agents also say Linux and iOS ones say Mac OS X
+	switch {
+	case strings.Contains(ua, "iphone") || strings.Contains(ua, "ipad") || strings.Contains(ua, "ipod"):
+		v.OS = "ios"
+	case strings.Contains(ua, "android"):
+		v.OS = "android"
+	case strings.Contains(ua, "cros "):
+		v.OS = "chromeos"
+	case strings.Contains(ua, "windows"):
+		v.OS = "windows"
+	case strings.Contains(ua, "macintosh") || strings.Contains(ua, "mac os x"):
+		v.OS = "macos"
+	case strings.Contains(ua, "linux"):
+		v.OS = "linux"
+	}
+
+	// Android tablets leave "Mobile" out of their agent
+	switch {
+	case strings.Contains(ua, "ipad") || strings.Contains(ua, "tablet") || v.OS == "android" && !strings.Contains(ua, "mobile"):
+		v.Device = "tablet"
+	case strings.Contains(ua, "mobi") || strings.Contains(ua, "iphone") || strings.Contains(ua, "ipod"):
+		v.Device = "mobile"
+	case v.OS != "":
+		v.Device = "desktop"
+	}
+	return v
+}
@@ -0,0 +1,41 @@
+package useragent
+
+import (
+	"testing"
+
+	"goprl/internal/domain"
+)
+
+func TestParse(t *testing.T) {
+	for _, tc := range []struct {
+		ua   string
+		want domain.Visitor
+	}{
+		{"Mozilla/5.0 (iPhone; CPU iPhone OS 17_4 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4 Mobile/15E148 Safari/604.1",
+			domain.Visitor{OS: "ios", Device: "mobile"}},
+		{"Mozilla/5.0 (iPad; CPU OS 17_4 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4 Mobile/15E148 Safari/604.1",
+			domain.Visitor{OS: "ios", Device: "tablet"}},
+		{"Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Mobile Safari/537.36",
+			domain.Visitor{OS: "android", Device: "mobile"}},
+		{"Mozilla/5.0 (Linux; Android 13; SM-X710) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36",
+			domain.Visitor{OS: "android", Device: "tablet"}},
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36",
+			domain.Visitor{OS: "windows", Device: "desktop"}},
+		{"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4 Safari/605.1.15",
+			domain.Visitor{OS: "macos", Device: "desktop"}},
+		{"Mozilla/5.0 (X11; CrOS x86_64 14541.0.0) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36",
+			domain.Visitor{OS: "chromeos", Device: "desktop"}},
+		{"Mozilla/5.0 (X11; Ubuntu; Linux x86_64; rv:125.0) Gecko/20100101 Firefox/125.0",
+			domain.Visitor{OS: "linux", Device: "desktop"}},
+		{"Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)",
+			domain.Visitor{Bot: true}},
+		{"facebookexternalhit/1.1 (+http://www.facebook.com/externalhit_uatext.php)",
+			domain.Visitor{Bot: true}},
+		{"curl/8.5.0", domain.Visitor{Bot: true}},
+		{"", domain.Visitor{}},
+	} {
+		if got := Parse(tc.ua); got != tc.want {
+			t.Errorf("%q: got %+v, want %+v", tc.ua, got, tc.want)
+		}
+	}
+}
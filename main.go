@@ -3,6 +3,7 @@ package main
 import (
 	"goprl/internal/app"
 	"goprl/internal/config"
+	"os"
 )
 
 func main() {
@@ -15,6 +16,13 @@ func main() {
 		panic("APP creation failed: " + err.Error())
 	}
 	defer app.Close()
+	// goprl <command> [flags] runs a maintenance command and exits
+	if len(os.Args) > 1 {
+		if err := app.RunCommand(os.Args[1], os.Args[2:]); err != nil {
+			panic("COMMAND failed: " + err.Error())
+		}
+		return
+	}
 	if err := app.Run(); err != nil {
 		panic("APP run failed: " + err.Error())
 	}